@@ -0,0 +1,652 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rknightion/adsb2loki/pkg/backfill"
+	"github.com/rknightion/adsb2loki/pkg/common"
+	"github.com/rknightion/adsb2loki/pkg/events"
+	"github.com/rknightion/adsb2loki/pkg/flightaware"
+	"github.com/rknightion/adsb2loki/pkg/loki"
+	"github.com/rknightion/adsb2loki/pkg/models"
+	"github.com/rknightion/adsb2loki/pkg/receiver"
+	"github.com/rknightion/adsb2loki/pkg/session"
+)
+
+// Exit codes of every command
+const (
+	exitOK      = 0 // The command completed
+	exitFailure = 1 // The command failed or was interrupted before completing
+	exitUsage   = 2 // Invalid flags or configuration
+)
+
+// configError marks a setup error caused by invalid configuration, as opposed to a service that
+// couldn't be reached
+type configError struct {
+	err error
+}
+
+func (e configError) Error() string { return e.err.Error() }
+
+func (e configError) Unwrap() error { return e.err }
+
+// setupExitCode is the exit code of a failed setup
+func setupExitCode(err error) int {
+	var cfgErr configError
+	if errors.As(err, &cfgErr) {
+		return exitUsage
+	}
+	return exitFailure
+}
+
+// command is a subcommand of the CLI
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) int
+}
+
+// commands lists the subcommands in the order they are shown in the usage
+var commands = []command{
+	{"run", "Poll aircraft.json and push entries to the configured sinks (default)", cmdRun},
+	{"replay", "Replay a recording through the pipeline with its original timestamps", cmdReplay},
+	{"backfill", "Push readsb globe_history traces to Loki", cmdBackfill},
+	{"validate-config", "Check the configuration without connecting to anything", cmdValidateConfig},
+	{"inspect", "Fetch one aircraft.json snapshot and print it as decoded", cmdInspect},
+	{"push-test", "Push a synthetic entry to each sink and report the result", cmdPushTest},
+	{"version", "Print the version", cmdVersion},
+}
+
+// stdout receives command output, replaced in tests
+var stdout io.Writer = os.Stdout
+
+// durationKeys are the environment variables holding durations, checked by validate-config
+var durationKeys = []string{
+	"ALERT_DEDUP_WINDOW", "EVENT_LOST_TIMEOUT", "MQTT_TIMEOUT", "POLL_INTERVAL", "SESSION_GAP_TIMEOUT", "SEVERITY_STALE_AFTER", "STATE_TTL", "STATS_INTERVAL",
+}
+
+// runCLI runs the command named by the first argument and returns its exit code.
+// Without a command, or when the first argument is a flag, the daemon runs.
+func runCLI(args []string) int {
+	if len(args) > 0 && (args[0] == "-h" || args[0] == "-help" || args[0] == "--help") {
+		usage(stdout)
+		return exitOK
+	}
+
+	name := "run"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+	if name == "help" {
+		usage(stdout)
+		return exitOK
+	}
+
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd.run(args)
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", name)
+	usage(os.Stderr)
+	return exitUsage
+}
+
+// usage prints the list of commands
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: adsb2loki [command] [flags]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, cmd := range commands {
+		fmt.Fprintf(tw, "  %s\t%s\n", cmd.name, cmd.summary)
+	}
+	tw.Flush()
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Configuration is read from the environment and .env, flags override it.")
+	fmt.Fprintln(w, "Run 'adsb2loki <command> -h' for the flags of a command.")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Exit codes: 0 success, 1 failure, 2 invalid flags or configuration.")
+}
+
+// newFlagSet creates the flag set of a command, with a usage line listing its arguments
+func newFlagSet(name, arguments string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: adsb2loki %s\n\nFlags:\n", strings.TrimSpace(name+" [flags] "+arguments))
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parseFlags parses args, returning the exit code to use if parsing stopped
+func parseFlags(fs *flag.FlagSet, args []string) (int, bool) {
+	err := fs.Parse(args)
+	if errors.Is(err, flag.ErrHelp) {
+		return exitOK, false
+	}
+	if err != nil {
+		return exitUsage, false
+	}
+	return exitOK, true
+}
+
+// signalContext returns a context cancelled on SIGINT or SIGTERM
+func signalContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+}
+
+// cmdRun polls aircraft.json until interrupted
+func cmdRun(args []string) int {
+	fs := newFlagSet("run", "")
+	aircraftURL := fs.String("url", os.Getenv("AIRCRAFT_JSON_URL"), "aircraft.json URL to poll")
+	httpAddr := fs.String("http", os.Getenv("HTTP_LISTEN_ADDR"), "address serving metrics, health and the API, disabled when empty")
+	interval := fs.Duration("interval", getDurationOrDefault("POLL_INTERVAL", pollInterval), "time between fetches, taken from receiver.json unless set here or in POLL_INTERVAL")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	intervalSet := os.Getenv("POLL_INTERVAL") != ""
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "interval" {
+			intervalSet = true
+		}
+	})
+
+	// REPLAY_FILE replaces polling, as before subcommands existed
+	if replayFile := os.Getenv("REPLAY_FILE"); replayFile != "" {
+		return cmdReplay([]string{"-http", *httpAddr, replayFile})
+	}
+	if *aircraftURL == "" {
+		log.Print("AIRCRAFT_JSON_URL or -url is required")
+		return exitUsage
+	}
+	if *interval <= 0 {
+		log.Print("-interval must be positive")
+		return exitUsage
+	}
+	network, address, isStream, err := streamAddress(*aircraftURL)
+	if err != nil {
+		log.Print(err)
+		return exitUsage
+	}
+	path, isFile := flightaware.FilePath(*aircraftURL)
+	var source streamSource
+	if isStream {
+		if source, err = newStream(network, address); err != nil {
+			log.Print(err)
+			return exitUsage
+		}
+	}
+
+	ctx, stop := signalContext()
+	defer stop()
+
+	// Take the station location and poll interval from the decoder unless configured. Streams
+	// have no receiver.json or stats.json next to them, those need to be configured.
+	var station *receiver.Receiver
+	if !isStream || os.Getenv("RECEIVER_JSON_URL") != "" {
+		station = fetchStation(ctx, *aircraftURL)
+	}
+	var statsURL string
+	if !isStream || os.Getenv("STATS_JSON_URL") != "" {
+		statsURL = receiverFileURL("STATS_JSON_URL", *aircraftURL, "stats.json")
+	}
+	if station != nil && !intervalSet && station.Refresh > 0 {
+		*interval = max(station.RefreshInterval(), minPollInterval)
+	}
+	switch {
+	case isStream:
+		log.Printf("Reading stream %s, processing every %v", redactURL(*aircraftURL), *interval)
+	case isFile:
+		log.Printf("Watching %s", path)
+	default:
+		log.Printf("Polling %s every %v", redactURL(*aircraftURL), *interval)
+	}
+
+	p, err := setupPipeline(ctx, pipelineOptions{
+		httpAddr:    *httpAddr,
+		interval:    *interval,
+		input:       inputName,
+		inputTarget: redactURL(*aircraftURL),
+		recordFile:  os.Getenv("RECORD_FILE"),
+		station:     station,
+		statsURL:    statsURL,
+	})
+	if err != nil {
+		log.Print(err)
+		return setupExitCode(err)
+	}
+	defer p.Close()
+
+	switch {
+	case isStream:
+		err = p.stream(ctx, source, *interval)
+	case isFile:
+		err = p.watch(ctx, flightaware.NewFetcher(*aircraftURL), path)
+	default:
+		err = p.poll(ctx, flightaware.NewFetcher(*aircraftURL), *interval)
+	}
+	if err != nil {
+		log.Print(err)
+		return exitFailure
+	}
+	return exitOK
+}
+
+// cmdReplay feeds a recording through the pipeline, then exits
+func cmdReplay(args []string) int {
+	defaultSpeed := 1.0
+	if value := os.Getenv("REPLAY_SPEED"); value != "" {
+		var err error
+		if defaultSpeed, err = strconv.ParseFloat(value, 64); err != nil {
+			log.Printf("Invalid REPLAY_SPEED: %v", err)
+			return exitUsage
+		}
+	}
+
+	fs := newFlagSet("replay", "[file]")
+	speed := fs.Float64("speed", defaultSpeed, "1 replays in real time, 10 ten times faster, 0 as fast as possible")
+	httpAddr := fs.String("http", os.Getenv("HTTP_LISTEN_ADDR"), "address serving metrics, health and the API, disabled when empty")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+
+	path := fs.Arg(0)
+	if path == "" {
+		path = os.Getenv("REPLAY_FILE")
+	}
+	if path == "" || fs.NArg() > 1 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	ctx, stop := signalContext()
+	defer stop()
+
+	p, err := setupPipeline(ctx, pipelineOptions{
+		httpAddr:    *httpAddr,
+		interval:    pollInterval,
+		input:       replayInputName,
+		inputTarget: path,
+	})
+	if err != nil {
+		log.Print(err)
+		return setupExitCode(err)
+	}
+	defer p.Close()
+
+	if err := replayFromFile(ctx, p.processor, path, *speed, p.monitor); err != nil {
+		log.Printf("Replay failed: %v", err)
+		return exitFailure
+	}
+	return exitOK
+}
+
+// cmdBackfill pushes readsb globe_history traces to Loki
+func cmdBackfill(args []string) int {
+	fs := newFlagSet("backfill", "")
+	dir := fs.String("dir", os.Getenv("BACKFILL_DIR"), "globe_history directory written by readsb")
+	fromFlag := fs.String("from", "", "first day to backfill, YYYY-MM-DD")
+	toFlag := fs.String("to", "", "last day to backfill, YYYY-MM-DD (default -from)")
+	checkpoint := fs.String("checkpoint", os.Getenv("BACKFILL_CHECKPOINT"), "file recording progress, to resume an interrupted backfill")
+	batchSize := fs.Int("batch-size", backfill.DefaultBatchSize, "entries per push")
+	rate := fs.Float64("rate", 0, "maximum entries per second, 0 for no limit")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+
+	lokiURL := os.Getenv("LOKI_URL")
+	if *dir == "" || *fromFlag == "" || lokiURL == "" {
+		log.Print("backfill requires -dir, -from and LOKI_URL")
+		return exitUsage
+	}
+	from, err := backfill.ParseDay(*fromFlag)
+	if err != nil {
+		log.Print(err)
+		return exitUsage
+	}
+	to := from
+	if *toFlag != "" {
+		if to, err = backfill.ParseDay(*toFlag); err != nil {
+			log.Print(err)
+			return exitUsage
+		}
+	}
+
+	ctx, stop := signalContext()
+	defer stop()
+
+	b := backfill.New(*dir, loki.NewClient(lokiURL))
+	b.Checkpoint = *checkpoint
+	b.BatchSize = *batchSize
+	b.Rate = *rate
+
+	// Entries carry sessions and levels like live ones
+	b.Processor.Sessions = session.NewTracker(getDurationOrDefault("SESSION_GAP_TIMEOUT", session.DefaultGapTimeout))
+	rules, err := setupSeverity()
+	if err != nil {
+		log.Printf("Failed to configure severity rules: %v", err)
+		return exitUsage
+	}
+	b.Processor.Severity = rules
+	b.Processor.LevelLabel = strings.ToLower(getEnvOrDefault("LOKI_LEVEL_LABEL", "false")) == "true"
+
+	stats, err := b.Run(ctx, from, to)
+	log.Printf("Backfilled %d entries from %d traces over %d days, %d rejected", stats.Entries, stats.Files, stats.Days, stats.Rejected)
+	if err != nil {
+		log.Printf("Backfill failed: %v", err)
+		return exitFailure
+	}
+	return exitOK
+}
+
+// cmdValidateConfig reports every problem with the configuration
+func cmdValidateConfig(args []string) int {
+	fs := newFlagSet("validate-config", "")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+
+	errs := validateConfig()
+	for _, err := range errs {
+		fmt.Fprintf(os.Stderr, "Invalid configuration: %v\n", err)
+	}
+	if len(errs) > 0 {
+		return exitUsage
+	}
+	fmt.Fprintf(stdout, "Configuration is valid (mode %s, config version %s)\n", strings.ToLower(getEnvOrDefault("MODE", "loki")), configVersion())
+	return exitOK
+}
+
+// validateConfig parses the configuration the way run does, without connecting to anything
+func validateConfig() []error {
+	var errs []error
+	check := func(err error) {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	switch mode := strings.ToLower(getEnvOrDefault("MODE", "loki")); mode {
+	case "loki":
+		if os.Getenv("LOKI_URL") == "" {
+			check(errors.New("LOKI_URL is required in Loki mode"))
+		} else {
+			check(checkURL("LOKI_URL", os.Getenv("LOKI_URL")))
+		}
+	case "otel":
+	default:
+		check(fmt.Errorf("invalid MODE '%s'. Must be 'loki' or 'otel'", mode))
+	}
+
+	if aircraftURL := os.Getenv("AIRCRAFT_JSON_URL"); aircraftURL != "" {
+		if network, _, isStream, err := streamAddress(aircraftURL); err != nil {
+			check(fmt.Errorf("invalid AIRCRAFT_JSON_URL: %w", err))
+		} else if network == "mqtt" {
+			_, err := setupSubscriber(aircraftURL)
+			check(err)
+		} else if !isStream {
+			check(checkURL("AIRCRAFT_JSON_URL", aircraftURL))
+		}
+	} else if os.Getenv("REPLAY_FILE") == "" {
+		check(errors.New("AIRCRAFT_JSON_URL is required"))
+	}
+
+	if os.Getenv("MQTT_BROKER") != "" {
+		_, err := setupMQTT()
+		check(err)
+	}
+	if os.Getenv("INFLUX_URL") != "" {
+		_, err := setupInflux()
+		check(err)
+	}
+	if os.Getenv("ELASTIC_URL") != "" {
+		_, err := setupElastic()
+		check(err)
+	}
+
+	for _, key := range []string{"RECEIVER_JSON_URL", "STATS_JSON_URL"} {
+		if value := os.Getenv(key); value != "" && value != "off" {
+			check(checkURL(key, value))
+		}
+	}
+
+	_, err := setupSeverity()
+	check(err)
+	_, _, err = setupAlerts()
+	check(err)
+	_, err = events.ParseAirports(os.Getenv("AIRPORTS"))
+	check(err)
+	_, err = setupResource()
+	check(err)
+
+	for _, key := range []string{"READY_MAX_MISSED_INTERVALS", "STREAM_BUFFER_SIZE", "ALERT_WEBHOOK_RETRIES"} {
+		_, err := getIntOrDefault(key, 0)
+		check(err)
+	}
+	for _, key := range durationKeys {
+		if value := os.Getenv(key); value != "" {
+			if _, err := time.ParseDuration(value); err != nil {
+				check(fmt.Errorf("invalid %s: %w", key, err))
+			}
+		}
+	}
+	if value := os.Getenv("REPLAY_SPEED"); value != "" {
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			check(fmt.Errorf("invalid REPLAY_SPEED: %w", err))
+		}
+	}
+	return errs
+}
+
+// redactURL replaces the password of a URL, so it can be logged and reported in /status
+func redactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	return u.Redacted()
+}
+
+// checkURL checks that value is an absolute http or https URL
+func checkURL(key, value string) error {
+	u, err := url.Parse(value)
+	if err != nil {
+		return fmt.Errorf("invalid %s: %w", key, err)
+	}
+	if u.Scheme == "file" && u.Path != "" {
+		return nil
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid %s: expected an http, https or file URL, got %q", key, value)
+	}
+	return nil
+}
+
+// cmdInspect prints one decoded snapshot, as JSON or as a table
+func cmdInspect(args []string) int {
+	fs := newFlagSet("inspect", "")
+	aircraftURL := fs.String("url", os.Getenv("AIRCRAFT_JSON_URL"), "aircraft.json URL to fetch")
+	hexes := fs.String("hex", "", "comma separated ICAO hex codes to show, all when empty")
+	table := fs.Bool("table", false, "print a table instead of JSON")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if *aircraftURL == "" {
+		log.Print("AIRCRAFT_JSON_URL or -url is required")
+		return exitUsage
+	}
+
+	ctx, stop := signalContext()
+	defer stop()
+
+	data, err := flightaware.Fetch(ctx, *aircraftURL)
+	if err != nil {
+		log.Print(err)
+		return exitFailure
+	}
+
+	// Keep only the requested aircraft
+	if want := splitList(strings.ToLower(*hexes)); len(want) > 0 {
+		filtered := data.Aircraft[:0]
+		for _, a := range data.Aircraft {
+			for _, hex := range want {
+				if strings.ToLower(a.Hex) == hex {
+					filtered = append(filtered, a)
+					break
+				}
+			}
+		}
+		data.Aircraft = filtered
+	}
+
+	if *table {
+		printAircraftTable(stdout, data)
+		return exitOK
+	}
+	enc := json.NewEncoder(stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(data); err != nil {
+		log.Print(err)
+		return exitFailure
+	}
+	return exitOK
+}
+
+// printAircraftTable prints a summary line and one row per aircraft, sorted by hex
+func printAircraftTable(w io.Writer, data *models.AutoGenerated) {
+	positioned := 0
+	for i := range data.Aircraft {
+		if data.Aircraft[i].HasPosition() {
+			positioned++
+		}
+	}
+	fmt.Fprintf(w, "%d aircraft, %d with position, %d messages at %s\n\n",
+		len(data.Aircraft), positioned, data.Messages, time.Unix(int64(data.Now), 0).UTC().Format(time.RFC3339))
+
+	aircraft := append([]models.Aircraft(nil), data.Aircraft...)
+	sort.Slice(aircraft, func(i, j int) bool { return aircraft[i].Hex < aircraft[j].Hex })
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "HEX\tFLIGHT\tSQUAWK\tALT\tGS\tTRACK\tLAT\tLON\tSOURCE\tSEEN")
+	for _, a := range aircraft {
+		alt := "-"
+		if a.OnGround() {
+			alt = models.AltitudeGround
+		} else if v, ok := a.Altitude(); ok {
+			alt = strconv.FormatFloat(v, 'f', 0, 64)
+		}
+		gs := "-"
+		if v, ok := models.Float(a.Gs); ok {
+			gs = strconv.FormatFloat(v, 'f', 0, 64)
+		}
+		lat, lon := "-", "-"
+		if a.HasPosition() {
+			lat, lon = strconv.FormatFloat(a.Lat, 'f', 4, 64), strconv.FormatFloat(a.Lon, 'f', 4, 64)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%.0f\t%s\t%s\t%s\t%.1f\n",
+			a.Hex, dash(a.Callsign()), dash(a.Squawk), alt, gs, a.Track, lat, lon, a.Source(), a.Seen)
+	}
+	tw.Flush()
+}
+
+// dash returns s, or "-" if it is empty
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// cmdPushTest pushes a synthetic entry to each sink and reports the outcome
+func cmdPushTest(args []string) int {
+	fs := newFlagSet("push-test", "")
+	timeout := fs.Duration("timeout", 10*time.Second, "time allowed for each push")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+
+	ctx, stop := signalContext()
+	defer stop()
+
+	sinks, otelClient, err := setupSinks(ctx, nil, *timeout)
+	if err != nil {
+		log.Print(err)
+		return setupExitCode(err)
+	}
+
+	code := exitOK
+	for _, s := range sinks {
+		start := time.Now()
+		err := pushTest(ctx, s, *timeout)
+		if s.close != nil {
+			s.close()
+		}
+		// OpenTelemetry exports in the background, so only a flush reports whether the entry was delivered
+		if otelClient != nil && s.name == "otel" {
+			flushCtx, cancel := context.WithTimeout(ctx, *timeout)
+			if flushErr := otelClient.Shutdown(flushCtx); err == nil && flushErr != nil {
+				err = fmt.Errorf("failed to flush: %w", flushErr)
+			}
+			cancel()
+		}
+		if err != nil {
+			fmt.Fprintf(stdout, "%s: failed: %v\n", s.name, err)
+			code = exitFailure
+			continue
+		}
+		fmt.Fprintf(stdout, "%s: ok in %v\n", s.name, time.Since(start).Round(time.Millisecond))
+	}
+	return code
+}
+
+// pushTest pushes one synthetic entry to a sink
+func pushTest(ctx context.Context, s sink, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	now := time.Now()
+	line, err := json.Marshal(models.Aircraft{Hex: "000000", Flight: "TEST", Type: "push_test", Seen: 0})
+	if err != nil {
+		return fmt.Errorf("failed to marshal test entry: %w", err)
+	}
+	entry := common.LogEntry{
+		Timestamp: now,
+		Line:      string(line),
+		Labels: map[string]string{
+			"app":    "flightaware",
+			"source": common.PushTestSource,
+		},
+		StructuredMetadata: map[string]string{
+			"hex":    "000000",
+			"flight": "TEST",
+		},
+	}
+
+	return s.logger.PushLogs(ctx, []common.LogEntry{entry})
+}
+
+// cmdVersion prints the build version
+func cmdVersion(args []string) int {
+	fs := newFlagSet("version", "")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	fmt.Fprintln(stdout, buildVersion())
+	return exitOK
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rknightion/adsb2loki/pkg/models"
+)
+
+// captureStdout collects command output for the duration of a test
+func captureStdout(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	previous := stdout
+	stdout = &buf
+	t.Cleanup(func() { stdout = previous })
+	return &buf
+}
+
+func TestRunCLI(t *testing.T) {
+	out := captureStdout(t)
+
+	tests := []struct {
+		name string
+		args []string
+		want int
+	}{
+		{name: "help", args: []string{"help"}, want: exitOK},
+		{name: "help flag", args: []string{"-h"}, want: exitOK},
+		{name: "command help", args: []string{"inspect", "-h"}, want: exitOK},
+		{name: "unknown command", args: []string{"fly"}, want: exitUsage},
+		{name: "unknown flag", args: []string{"version", "-nope"}, want: exitUsage},
+		{name: "version", args: []string{"version"}, want: exitOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := runCLI(tt.args); code != tt.want {
+				t.Errorf("Expected exit code %d, got %d", tt.want, code)
+			}
+		})
+	}
+
+	if !strings.Contains(out.String(), "validate-config") {
+		t.Errorf("Expected the usage to list the commands, got %q", out.String())
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		want []string // Expected substrings of the errors, none for a valid configuration
+	}{
+		{
+			name: "valid",
+			env:  map[string]string{"LOKI_URL": "http://loki:3100", "AIRCRAFT_JSON_URL": "http://piaware/data/aircraft.json"},
+		},
+		{
+			name: "local file",
+			env:  map[string]string{"LOKI_URL": "http://loki:3100", "AIRCRAFT_JSON_URL": "file:///run/readsb/aircraft.json"},
+		},
+		{
+			name: "sbs stream",
+			env:  map[string]string{"LOKI_URL": "http://loki:3100", "AIRCRAFT_JSON_URL": "sbs+unix:///run/readsb/sbs.sock"},
+		},
+		{
+			name: "beast stream",
+			env:  map[string]string{"LOKI_URL": "http://loki:3100", "AIRCRAFT_JSON_URL": "beast://readsb:30005"},
+			want: []string{"beast streams aren't supported"},
+		},
+		{
+			name: "mqtt input",
+			env: map[string]string{
+				"LOKI_URL":          "http://loki:3100",
+				"AIRCRAFT_JSON_URL": "mqtt://broker:1883",
+				"MQTT_INPUT_TOPICS": "adsb/{receiver}/aircraft",
+			},
+		},
+		{
+			name: "mqtt input without topics",
+			env:  map[string]string{"LOKI_URL": "http://loki:3100", "AIRCRAFT_JSON_URL": "mqtt://broker:1883"},
+			want: []string{"invalid MQTT_INPUT_TOPICS"},
+		},
+		{
+			name: "mqtt sink",
+			env: map[string]string{
+				"LOKI_URL":          "http://loki:3100",
+				"AIRCRAFT_JSON_URL": "http://piaware/data/aircraft.json",
+				"MQTT_BROKER":       "ssl://mqtt:8883",
+				"MQTT_QOS":          "1",
+			},
+		},
+		{
+			name: "invalid mqtt settings",
+			env: map[string]string{
+				"LOKI_URL":          "http://loki:3100",
+				"AIRCRAFT_JSON_URL": "http://piaware/data/aircraft.json",
+				"MQTT_BROKER":       "tcp://mqtt:1883",
+				"MQTT_QOS":          "3",
+			},
+			want: []string{"invalid MQTT_QOS"},
+		},
+		{
+			name: "influx sink",
+			env: map[string]string{
+				"LOKI_URL":          "http://loki:3100",
+				"AIRCRAFT_JSON_URL": "http://piaware/data/aircraft.json",
+				"INFLUX_URL":        "udp://influxdb:8089",
+			},
+		},
+		{
+			name: "invalid influx settings",
+			env: map[string]string{
+				"LOKI_URL":          "http://loki:3100",
+				"AIRCRAFT_JSON_URL": "http://piaware/data/aircraft.json",
+				"INFLUX_URL":        "http://influxdb:8086",
+				"INFLUX_BATCH_SIZE": "many",
+			},
+			want: []string{"invalid INFLUX_BATCH_SIZE"},
+		},
+		{
+			name: "elasticsearch sink",
+			env: map[string]string{
+				"LOKI_URL":          "http://loki:3100",
+				"AIRCRAFT_JSON_URL": "http://piaware/data/aircraft.json",
+				"ELASTIC_URL":       "https://opensearch:9200",
+				"ELASTIC_RETRIES":   "three",
+			},
+			want: []string{"invalid ELASTIC_RETRIES"},
+		},
+		{
+			name: "replay without url",
+			env:  map[string]string{"LOKI_URL": "http://loki:3100", "REPLAY_FILE": "capture.jsonl.gz"},
+		},
+		{
+			name: "missing urls",
+			env:  map[string]string{},
+			want: []string{"LOKI_URL is required", "AIRCRAFT_JSON_URL is required"},
+		},
+		{
+			name: "invalid values",
+			env: map[string]string{
+				"MODE":                "kafka",
+				"AIRCRAFT_JSON_URL":   "piaware/data/aircraft.json",
+				"SESSION_GAP_TIMEOUT": "ten minutes",
+				"AIRPORTS":            "EGLL:51.47",
+				"STATION_LAT":         "north",
+			},
+			want: []string{"invalid MODE", "invalid AIRCRAFT_JSON_URL", "invalid airport", "invalid STATION_LAT", "invalid SESSION_GAP_TIMEOUT"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, key := range []string{"MODE", "LOKI_URL", "AIRCRAFT_JSON_URL", "REPLAY_FILE"} {
+				t.Setenv(key, "")
+				os.Unsetenv(key)
+			}
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+
+			errs := validateConfig()
+			if len(errs) != len(tt.want) {
+				t.Fatalf("Expected %d errors, got %v", len(tt.want), errs)
+			}
+			for i, want := range tt.want {
+				if !strings.Contains(errs[i].Error(), want) {
+					t.Errorf("Expected error %d to mention %q, got %v", i, want, errs[i])
+				}
+			}
+		})
+	}
+}
+
+func TestCmdInspect(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"now":1716547431,"messages":1000,"aircraft":[
+			{"hex":"4ca614","flight":"EIN581  ","alt_baro":3000,"gs":180,"lat":53.4,"lon":-6.2,"type":"adsb_icao"},
+			{"hex":"3c6444","alt_baro":"ground"}]}`))
+	}))
+	defer server.Close()
+
+	t.Run("json", func(t *testing.T) {
+		out := captureStdout(t)
+		if code := cmdInspect([]string{"-url", server.URL, "-hex", "4CA614"}); code != exitOK {
+			t.Fatalf("Expected exit code 0, got %d", code)
+		}
+		var data models.AutoGenerated
+		if err := json.Unmarshal(out.Bytes(), &data); err != nil {
+			t.Fatalf("Expected JSON output: %v", err)
+		}
+		if len(data.Aircraft) != 1 || data.Aircraft[0].Hex != "4ca614" {
+			t.Errorf("Expected only 4ca614, got %+v", data.Aircraft)
+		}
+	})
+
+	t.Run("table", func(t *testing.T) {
+		out := captureStdout(t)
+		if code := cmdInspect([]string{"-url", server.URL, "-table"}); code != exitOK {
+			t.Fatalf("Expected exit code 0, got %d", code)
+		}
+		for _, want := range []string{"2 aircraft, 1 with position", "EIN581", "ground", "adsb_icao"} {
+			if !strings.Contains(out.String(), want) {
+				t.Errorf("Expected the table to contain %q, got:\n%s", want, out.String())
+			}
+		}
+	})
+
+	t.Run("unreachable", func(t *testing.T) {
+		captureStdout(t)
+		if code := cmdInspect([]string{"-url", "http://127.0.0.1:1/aircraft.json"}); code != exitFailure {
+			t.Errorf("Expected exit code 1, got %d", code)
+		}
+	})
+}
+
+func TestCmdPushTest(t *testing.T) {
+	status := http.StatusNoContent
+	var received int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received++
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+	t.Setenv("MODE", "loki")
+
+	out := captureStdout(t)
+	t.Setenv("LOKI_URL", server.URL)
+	if code := cmdPushTest(nil); code != exitOK || received != 1 {
+		t.Errorf("Expected one successful push, got exit code %d and %d pushes", code, received)
+	}
+	if !strings.Contains(out.String(), "loki: ok") {
+		t.Errorf("Expected the push to be reported, got %q", out.String())
+	}
+
+	status = http.StatusUnauthorized
+	if code := cmdPushTest(nil); code != exitFailure {
+		t.Errorf("Expected exit code 1 for a rejected push, got %d", code)
+	}
+	if !strings.Contains(out.String(), "loki: failed") {
+		t.Errorf("Expected the failure to be reported, got %q", out.String())
+	}
+
+	t.Setenv("MQTT_BROKER", "tcp://127.0.0.1:1")
+	t.Setenv("MQTT_TIMEOUT", "100ms")
+	if code := cmdPushTest(nil); code != exitFailure {
+		t.Errorf("Expected exit code 1 for an unreachable broker, got %d", code)
+	}
+
+	t.Setenv("MQTT_BROKER", "")
+	t.Setenv("LOKI_URL", "")
+	if code := cmdPushTest(nil); code != exitUsage {
+		t.Errorf("Expected exit code 2 without LOKI_URL, got %d", code)
+	}
+}
+
+func TestCmdBackfill(t *testing.T) {
+	dir := t.TempDir()
+	traces := filepath.Join(dir, "2024", "05", "24", "traces", "14")
+	if err := os.MkdirAll(traces, 0o755); err != nil {
+		t.Fatalf("Failed to create traces directory: %v", err)
+	}
+	trace := `{"icao":"4ca614","timestamp":1716508800,"trace":[[60,53.4,-6.2,3000,180,280,0,0,{"flight":"EIN581"},"adsb_icao"],[65,53.41,-6.21,3100,180,280,0,0,null,"adsb_icao"]]}`
+	if err := os.WriteFile(filepath.Join(traces, "trace_full_4ca614.json"), []byte(trace), 0o644); err != nil {
+		t.Fatalf("Failed to write trace: %v", err)
+	}
+
+	values := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			Streams []struct {
+				Values [][]interface{} `json:"values"`
+			} `json:"streams"`
+		}
+		json.NewDecoder(r.Body).Decode(&payload)
+		for _, s := range payload.Streams {
+			values += len(s.Values)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+	t.Setenv("LOKI_URL", server.URL)
+
+	tests := []struct {
+		name string
+		args []string
+		want int
+	}{
+		{name: "missing range", args: []string{"-dir", dir}, want: 2},
+		{name: "invalid day", args: []string{"-dir", dir, "-from", "24/05/2024"}, want: 2},
+		{name: "backfill", args: []string{"-dir", dir, "-from", "2024-05-24", "-checkpoint", filepath.Join(dir, "checkpoint.json")}, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := cmdBackfill(tt.args); code != tt.want {
+				t.Errorf("Expected exit code %d, got %d", tt.want, code)
+			}
+		})
+	}
+
+	if values != 2 {
+		t.Errorf("Expected 2 entries pushed, got %d", values)
+	}
+}
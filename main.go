@@ -2,95 +2,904 @@ package main
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"log"
+	"net/http"
+	"net/url"
 	"os"
-	"os/signal"
+	"runtime/debug"
+	"sort"
+	"strconv"
 	"strings"
-	"syscall"
 	"time"
 
 	"github.com/joho/godotenv"
+	"github.com/rknightion/adsb2loki/pkg/alert"
 	"github.com/rknightion/adsb2loki/pkg/common"
+	"github.com/rknightion/adsb2loki/pkg/elastic"
+	"github.com/rknightion/adsb2loki/pkg/events"
 	"github.com/rknightion/adsb2loki/pkg/flightaware"
+	"github.com/rknightion/adsb2loki/pkg/health"
+	"github.com/rknightion/adsb2loki/pkg/influx"
 	"github.com/rknightion/adsb2loki/pkg/loki"
+	"github.com/rknightion/adsb2loki/pkg/metrics"
+	"github.com/rknightion/adsb2loki/pkg/models"
+	"github.com/rknightion/adsb2loki/pkg/mqtt"
 	"github.com/rknightion/adsb2loki/pkg/otel"
+	"github.com/rknightion/adsb2loki/pkg/receiver"
+	"github.com/rknightion/adsb2loki/pkg/replay"
+	"github.com/rknightion/adsb2loki/pkg/sbs"
+	"github.com/rknightion/adsb2loki/pkg/session"
+	"github.com/rknightion/adsb2loki/pkg/severity"
+	"github.com/rknightion/adsb2loki/pkg/state"
+	"github.com/rknightion/adsb2loki/pkg/stream"
+	"github.com/rknightion/adsb2loki/pkg/watch"
+	"github.com/rknightion/adsb2loki/pkg/web"
 )
 
+// version is set at build time with -ldflags "-X main.version=..."
+var version string
+
+// pollInterval is how often aircraft.json is fetched, unless configured or taken from receiver.json
+const pollInterval = 5 * time.Second
+
+// minPollInterval bounds the poll interval taken from receiver.json
+const minPollInterval = time.Second
+
+// inputName identifies the aircraft.json input in status reports
+const inputName = "aircraft_json"
+
+// replayInputName identifies a replayed recording in status reports
+const replayInputName = "replay"
+
+// configPrefixes are the environment variable prefixes making up the configuration
+var configPrefixes = []string{
+	"AIRCRAFT_", "AIRPORTS", "ALERT_", "BACKFILL_", "ELASTIC_", "EVENT_", "HTTP_", "INFLUX_", "LOKI_", "MODE", "MQTT_", "OTEL_", "POLL_", "READY_", "RECEIVER_", "RECORD_",
+	"REPLAY_", "SESSION_", "SEVERITY_", "STATE_", "STATION_", "STATS_", "STREAM_", "WEB_",
+}
+
 func main() {
 	// Load .env file
 	if err := godotenv.Load(); err != nil {
 		log.Printf("Warning: .env file not found: %v", err)
 	}
 
-	// Create a context that we can cancel
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+	os.Exit(runCLI(os.Args[1:]))
+}
 
-	// Initialize logger based on MODE environment variable
-	mode := strings.ToLower(getEnvOrDefault("MODE", "loki"))
-	var logger common.Logger
-	var otelClient *otel.Client
+// sink is a named destination for log entries
+type sink struct {
+	name   string
+	logger common.Logger
+	close  func() // Optional, releases the sink's connections
+}
 
+// setupSinks creates the logger selected by MODE, plus the MQTT, InfluxDB and Elasticsearch
+// sinks when MQTT_BROKER, INFLUX_URL and ELASTIC_URL are set. The OpenTelemetry client is
+// returned as well in otel mode, since it also exports flight spans and metrics. station, when
+// known, provides the station location if it isn't configured. retryTime bounds the retries of
+// a push, so that a sink that is down doesn't hold up the others.
+func setupSinks(ctx context.Context, station *receiver.Receiver, retryTime time.Duration) ([]sink, *otel.Client, error) {
+	var sinks []sink
+	var otelClient *otel.Client
+	mode := strings.ToLower(getEnvOrDefault("MODE", "loki"))
 	switch mode {
 	case "otel":
-		log.Println("Running in OpenTelemetry mode")
-		client, err := otel.NewClient(ctx, "adsb2loki")
+		res, err := setupResource()
 		if err != nil {
-			log.Fatalf("Failed to create OpenTelemetry client: %v", err)
+			return nil, nil, configError{fmt.Errorf("failed to configure OpenTelemetry resource: %w", err)}
+		}
+		if !res.HasLocation && station != nil && station.HasLocation() {
+			res.Lat, res.Lon, res.HasLocation = *station.Lat, *station.Lon, true
 		}
-		otelClient = client
-		logger = client
-		defer func() {
+		otelClient, err = otel.NewClient(ctx, res)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create OpenTelemetry client: %w", err)
+		}
+		sinks = append(sinks, sink{name: mode, logger: otelClient})
+	case "loki":
+		lokiURL := os.Getenv("LOKI_URL")
+		if lokiURL == "" {
+			return nil, nil, configError{errors.New("LOKI_URL environment variable is required in Loki mode")}
+		}
+		sinks = append(sinks, sink{name: mode, logger: loki.NewClient(lokiURL)})
+	default:
+		return nil, nil, configError{fmt.Errorf("invalid MODE '%s'. Must be 'loki' or 'otel'", mode)}
+	}
+
+	if os.Getenv("MQTT_BROKER") != "" {
+		cfg, err := setupMQTT()
+		if err != nil {
+			return nil, nil, configError{err}
+		}
+		client, err := mqtt.NewClient(cfg)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create MQTT client: %w", err)
+		}
+		sinks = append(sinks, sink{name: "mqtt", logger: client, close: client.Close})
+	}
+
+	if os.Getenv("INFLUX_URL") != "" {
+		cfg, err := setupInflux()
+		if err != nil {
+			return nil, nil, configError{err}
+		}
+		cfg.RetryTime = retryTime
+		client, err := influx.NewClient(cfg)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create InfluxDB client: %w", err)
+		}
+		sinks = append(sinks, sink{name: "influx", logger: client, close: client.Close})
+	}
+
+	if os.Getenv("ELASTIC_URL") != "" {
+		cfg, err := setupElastic()
+		if err != nil {
+			return nil, nil, configError{err}
+		}
+		cfg.RetryTime = retryTime
+		client, err := elastic.NewClient(cfg)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create Elasticsearch client: %w", err)
+		}
+		sinks = append(sinks, sink{name: "elasticsearch", logger: client})
+	}
+	return sinks, otelClient, nil
+}
+
+// setupElastic configures the Elasticsearch sink from the environment
+func setupElastic() (elastic.Config, error) {
+	cfg := elastic.Config{
+		URL:                os.Getenv("ELASTIC_URL"),
+		Username:           os.Getenv("ELASTIC_USERNAME"),
+		Password:           os.Getenv("ELASTIC_PASSWORD"),
+		APIKey:             os.Getenv("ELASTIC_API_KEY"),
+		IndexPrefix:        getEnvOrDefault("ELASTIC_INDEX_PREFIX", elastic.DefaultIndexPrefix),
+		Template:           strings.ToLower(getEnvOrDefault("ELASTIC_TEMPLATE", "true")) == "true",
+		InsecureSkipVerify: strings.ToLower(getEnvOrDefault("ELASTIC_TLS_INSECURE_SKIP_VERIFY", "false")) == "true",
+	}
+	if err := checkURL("ELASTIC_URL", cfg.URL); err != nil {
+		return cfg, err
+	}
+	var err error
+	if cfg.BatchSize, err = getIntOrDefault("ELASTIC_BATCH_SIZE", elastic.DefaultBatchSize); err != nil {
+		return cfg, err
+	}
+	if cfg.MaxRetries, err = getIntOrDefault("ELASTIC_RETRIES", 3); err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
+
+// setupInflux configures the InfluxDB sink from the environment
+func setupInflux() (influx.Config, error) {
+	cfg := influx.Config{
+		URL:         os.Getenv("INFLUX_URL"),
+		Org:         os.Getenv("INFLUX_ORG"),
+		Bucket:      os.Getenv("INFLUX_BUCKET"),
+		Token:       os.Getenv("INFLUX_TOKEN"),
+		Measurement: getEnvOrDefault("INFLUX_MEASUREMENT", influx.DefaultMeasurement),
+		Tags:        splitList(os.Getenv("INFLUX_TAGS")),
+		Fields:      splitList(os.Getenv("INFLUX_FIELDS")),
+		Receiver:    getEnvOrDefault("INFLUX_RECEIVER", os.Getenv("STATION_NAME")),
+		Gzip:        strings.ToLower(getEnvOrDefault("INFLUX_GZIP", "true")) == "true",
+	}
+	var err error
+	if cfg.BatchSize, err = getIntOrDefault("INFLUX_BATCH_SIZE", influx.DefaultBatchSize); err != nil {
+		return cfg, err
+	}
+	if cfg.MaxRetries, err = getIntOrDefault("INFLUX_RETRIES", 3); err != nil {
+		return cfg, err
+	}
+
+	// Check the URL without opening a socket, so validate-config can use this
+	u, err := url.Parse(cfg.URL)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "udp") {
+		return cfg, fmt.Errorf("invalid INFLUX_URL %q, expected an http, https or udp URL", cfg.URL)
+	}
+	if u.Scheme != "udp" && cfg.Bucket == "" {
+		return cfg, errors.New("INFLUX_BUCKET is required with an HTTP INFLUX_URL")
+	}
+	return cfg, nil
+}
+
+// newStream creates the stream source of a network and address returned by streamAddress
+func newStream(network, address string) (streamSource, error) {
+	if network != "mqtt" {
+		return sbs.NewClient(network, address), nil
+	}
+	cfg, err := setupSubscriber(address)
+	if err != nil {
+		return nil, err
+	}
+	subscriber, err := mqtt.NewSubscriber(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create MQTT subscriber: %w", err)
+	}
+	return subscriber, nil
+}
+
+// setupSubscriber configures the MQTT input from its mqtt:// or mqtts:// URL, whose user info
+// holds the credentials, and the environment
+func setupSubscriber(rawURL string) (mqtt.SubscriberConfig, error) {
+	var cfg mqtt.SubscriberConfig
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return cfg, fmt.Errorf("invalid input URL: %w", err)
+	}
+	if u.User != nil {
+		cfg.Username = u.User.Username()
+		cfg.Password, _ = u.User.Password()
+	}
+	cfg.Broker = (&url.URL{Scheme: u.Scheme, Host: u.Host}).String()
+
+	if cfg.Subscriptions, err = mqtt.ParseSubscriptions(os.Getenv("MQTT_INPUT_TOPICS")); err != nil {
+		return cfg, fmt.Errorf("invalid MQTT_INPUT_TOPICS: %w", err)
+	}
+	qos, err := getIntOrDefault("MQTT_INPUT_QOS", 1)
+	if err != nil {
+		return cfg, err
+	}
+	if qos < 0 || qos > 2 {
+		return cfg, fmt.Errorf("invalid MQTT_INPUT_QOS %d, must be 0, 1 or 2", qos)
+	}
+	cfg.QoS = byte(qos)
+
+	hostname, _ := os.Hostname()
+	cfg.ClientID = getEnvOrDefault("MQTT_INPUT_CLIENT_ID", "adsb2loki-input-"+hostname)
+	cfg.Timeout = getDurationOrDefault("MQTT_TIMEOUT", mqtt.DefaultTimeout)
+
+	caFile, certFile, keyFile := os.Getenv("MQTT_INPUT_TLS_CA"), os.Getenv("MQTT_INPUT_TLS_CERT"), os.Getenv("MQTT_INPUT_TLS_KEY")
+	insecure := strings.ToLower(getEnvOrDefault("MQTT_INPUT_TLS_INSECURE_SKIP_VERIFY", "false")) == "true"
+	if caFile != "" || certFile != "" || keyFile != "" || insecure {
+		if cfg.TLS, err = mqtt.TLSConfig(caFile, certFile, keyFile, insecure); err != nil {
+			return cfg, err
+		}
+	}
+	return cfg, nil
+}
+
+// setupMQTT configures the MQTT sink from the environment
+func setupMQTT() (mqtt.Config, error) {
+	cfg := mqtt.Config{
+		Broker:   os.Getenv("MQTT_BROKER"),
+		Username: os.Getenv("MQTT_USERNAME"),
+		Password: os.Getenv("MQTT_PASSWORD"),
+		Topic:    getEnvOrDefault("MQTT_TOPIC", mqtt.DefaultTopic),
+		Receiver: os.Getenv("MQTT_RECEIVER"),
+		Retain:   strings.ToLower(getEnvOrDefault("MQTT_RETAIN", "true")) == "true",
+		Timeout:  getDurationOrDefault("MQTT_TIMEOUT", mqtt.DefaultTimeout),
+	}
+	if u, err := url.Parse(cfg.Broker); err != nil || u.Scheme == "" {
+		return cfg, fmt.Errorf("invalid MQTT_BROKER %q, expected a URL such as tcp://localhost:1883", cfg.Broker)
+	}
+	if cfg.Receiver == "" {
+		cfg.Receiver = os.Getenv("STATION_NAME")
+	}
+	if cfg.Receiver == "" {
+		cfg.Receiver, _ = os.Hostname()
+	}
+	cfg.ClientID = getEnvOrDefault("MQTT_CLIENT_ID", "adsb2loki-"+cfg.Receiver)
+
+	qos, err := getIntOrDefault("MQTT_QOS", 0)
+	if err != nil {
+		return cfg, err
+	}
+	if qos < 0 || qos > 2 {
+		return cfg, fmt.Errorf("invalid MQTT_QOS %d, must be 0, 1 or 2", qos)
+	}
+	cfg.QoS = byte(qos)
+
+	caFile, certFile, keyFile := os.Getenv("MQTT_TLS_CA"), os.Getenv("MQTT_TLS_CERT"), os.Getenv("MQTT_TLS_KEY")
+	insecure := strings.ToLower(getEnvOrDefault("MQTT_TLS_INSECURE_SKIP_VERIFY", "false")) == "true"
+	if caFile != "" || certFile != "" || keyFile != "" || insecure {
+		if cfg.TLS, err = mqtt.TLSConfig(caFile, certFile, keyFile, insecure); err != nil {
+			return cfg, err
+		}
+	}
+	return cfg, nil
+}
+
+// pipelineOptions configures setupPipeline
+type pipelineOptions struct {
+	httpAddr    string             // Serves metrics, health and the API when set
+	interval    time.Duration      // Expected time between snapshots, for readiness
+	input       string             // Input name reported in /status
+	inputTarget string             // URL or file of the input
+	recordFile  string             // Records every snapshot when set
+	station     *receiver.Receiver // receiver.json of the decoder, when known
+	statsURL    string             // Polls stats.json when set
+}
+
+// pipeline is a processor with its sinks, optional components and HTTP server
+type pipeline struct {
+	processor  *flightaware.Processor
+	otelClient *otel.Client
+	metrics    *metrics.Metrics
+	monitor    *health.Monitor
+	serverErr  chan error // Receives the error if the HTTP server fails
+	closers    []func()
+}
+
+// Close stops the HTTP server and flushes the sinks, in reverse order of creation
+func (p *pipeline) Close() {
+	for i := len(p.closers) - 1; i >= 0; i-- {
+		p.closers[i]()
+	}
+}
+
+// setupPipeline builds the processor and its components from the environment.
+// Background goroutines stop when ctx is cancelled.
+func setupPipeline(ctx context.Context, opts pipelineOptions) (*pipeline, error) {
+	p := &pipeline{serverErr: make(chan error, 1)}
+	ok := false
+	defer func() {
+		if !ok {
+			p.Close()
+		}
+	}()
+
+	sinks, otelClient, err := setupSinks(ctx, opts.station, opts.interval)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range sinks {
+		if s.close != nil {
+			p.closers = append(p.closers, s.close)
+		}
+	}
+	p.otelClient = otelClient
+	if otelClient != nil {
+		log.Println("Running in OpenTelemetry mode")
+		p.closers = append(p.closers, func() {
 			shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
 			defer shutdownCancel()
 			if err := otelClient.Shutdown(shutdownCtx); err != nil {
 				log.Printf("Failed to shutdown OpenTelemetry: %v", err)
 			}
-		}()
-	case "loki":
+		})
+	} else {
 		log.Println("Running in Loki mode")
-		lokiURL := os.Getenv("LOKI_URL")
-		if lokiURL == "" {
-			log.Fatal("LOKI_URL environment variable is required in Loki mode")
+	}
+
+	// Expose Prometheus metrics, health and status when an HTTP listen address is configured
+	mux := http.NewServeMux()
+	if opts.httpAddr != "" {
+		p.metrics = metrics.New()
+		mux.Handle("/metrics", p.metrics.Handler())
+
+		maxMissed, err := getIntOrDefault("READY_MAX_MISSED_INTERVALS", health.DefaultMaxMissed)
+		if err != nil {
+			return nil, configError{fmt.Errorf("failed to configure readiness: %w", err)}
+		}
+		p.monitor = health.NewMonitor(opts.interval, maxMissed, buildVersion(), configVersion())
+		mux.HandleFunc("/healthz", p.monitor.HandleHealthz)
+		mux.HandleFunc("/readyz", p.monitor.HandleReadyz)
+		mux.HandleFunc("/status", p.monitor.HandleStatus)
+		p.monitor.AddInput(opts.input, opts.inputTarget)
+
+		for i, s := range sinks {
+			sinks[i].logger = p.monitor.Logger(s.name, p.metrics.Logger(s.name, s.logger))
 		}
-		logger = loki.NewClient(lokiURL)
-	default:
-		log.Fatalf("Invalid MODE '%s'. Must be 'loki' or 'otel'", mode)
 	}
 
+	// Push to every sink
+	var logger common.Logger = sinks[0].logger
+	if len(sinks) > 1 {
+		multi := make(common.MultiLogger, len(sinks))
+		for i, s := range sinks {
+			multi[i] = s.logger
+		}
+		logger = multi
+	}
+
+	// Track continuous sightings of each aircraft so entries carry a session ID
+	processor := flightaware.NewProcessor(logger)
+	p.processor = processor
+	processor.Sessions = session.NewTracker(getDurationOrDefault("SESSION_GAP_TIMEOUT", session.DefaultGapTimeout))
+	if otelClient != nil {
+		// Export each session as a span when OTEL_TRACES_EXPORTER=otlp
+		processor.Flights = otelClient.Flights()
+		processor.Recorders = append(processor.Recorders, otelClient)
+	}
+
+	// Classify entries by severity, as a level label or structured metadata
+	rules, err := setupSeverity()
+	if err != nil {
+		return nil, configError{fmt.Errorf("failed to configure severity rules: %w", err)}
+	}
+	processor.Severity = rules
+	processor.LevelLabel = strings.ToLower(getEnvOrDefault("LOKI_LEVEL_LABEL", "false")) == "true"
+
+	// Detect lifecycle events such as takeoffs, landings and go-arounds near configured airports
+	airports, err := events.ParseAirports(os.Getenv("AIRPORTS"))
+	if err != nil {
+		return nil, configError{fmt.Errorf("invalid AIRPORTS: %w", err)}
+	}
+	processor.Events = events.NewDetector(getDurationOrDefault("EVENT_LOST_TIMEOUT", events.DefaultLostTimeout), airports)
+
+	// Raise alerts for emergencies, watchlisted aircraft and geofence entries
+	alerts, dispatcher, err := setupAlerts()
+	if err != nil {
+		return nil, configError{fmt.Errorf("failed to configure alerts: %w", err)}
+	}
+	processor.Alerts = alerts
+	if dispatcher != nil {
+		processor.Notifier = dispatcher
+		go dispatcher.Run(ctx)
+		if p.metrics != nil {
+			p.metrics.RegisterQueue("alerts", dispatcher.Len, dispatcher.Dropped)
+		}
+		if p.monitor != nil {
+			p.monitor.RegisterBacklog("alerts", dispatcher.Len)
+		}
+	}
+
+	// Capture every fetched snapshot so it can be replayed later
+	if opts.recordFile != "" {
+		recorder, err := replay.NewRecorder(opts.recordFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create recorder: %w", err)
+		}
+		p.closers = append(p.closers, func() {
+			if err := recorder.Close(); err != nil {
+				log.Printf("Failed to close recording: %v", err)
+			}
+		})
+		processor.Recorders = append(processor.Recorders, recorder)
+	}
+
+	if p.metrics != nil {
+		processor.Recorders = append(processor.Recorders, p.metrics)
+	}
+
+	// Poll the decoder's own statistics, exported as metrics and pushed with a source label of "stats"
+	if opts.statsURL != "" {
+		poller := receiver.NewPoller(opts.statsURL, getDurationOrDefault("STATS_INTERVAL", receiver.DefaultStatsInterval), logger)
+		if p.metrics != nil {
+			poller.Recorders = append(poller.Recorders, p.metrics)
+		}
+		if otelClient != nil {
+			poller.Recorders = append(poller.Recorders, otelClient)
+		}
+		go poller.Run(ctx)
+	}
+
+	if opts.httpAddr == "" {
+		ok = true
+		return p, nil
+	}
+
+	// Keep the current state of every aircraft and serve it over the HTTP API
+	processor.State = state.NewStore(getDurationOrDefault("STATE_TTL", state.DefaultTTL))
+	processor.State.Register(mux)
+
+	bufferSize, err := getIntOrDefault("STREAM_BUFFER_SIZE", stream.DefaultBufferSize)
+	if err != nil {
+		return nil, configError{fmt.Errorf("failed to configure stream: %w", err)}
+	}
+	processor.Stream = stream.NewHub(bufferSize)
+	processor.Stream.AllowedOrigins = splitList(os.Getenv("STREAM_ALLOWED_ORIGINS"))
+	processor.Stream.Register(mux)
+
+	// Serve the live map at /
+	if strings.ToLower(getEnvOrDefault("WEB_UI", "true")) == "true" {
+		web.Register(mux)
+	}
+
+	server := &http.Server{Addr: opts.httpAddr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		log.Printf("Serving HTTP on %s", opts.httpAddr)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			p.serverErr <- fmt.Errorf("HTTP server failed: %w", err)
+		}
+	}()
+	p.closers = append(p.closers, func() {
+		shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer shutdownCancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.Printf("Failed to shutdown HTTP server: %v", err)
+		}
+	})
+
+	ok = true
+	return p, nil
+}
+
+// poll fetches aircraft.json every interval until ctx is cancelled or the HTTP server fails
+func (p *pipeline) poll(ctx context.Context, fetcher *flightaware.Fetcher, interval time.Duration) error {
 	// Create a ticker to fetch data periodically
-	ticker := time.NewTicker(5 * time.Second)
+	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
-	// Handle graceful shutdown
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-
-	// Start the main loop
 	for {
 		select {
 		case <-ticker.C:
-			start := time.Now()
-			err := flightaware.FetchAndPushToLoki(ctx, logger)
-			duration := time.Since(start)
+			p.fetch(ctx, fetcher)
+		case err := <-p.serverErr:
+			return err
+		case <-ctx.Done():
+			log.Println("Received shutdown signal, exiting...")
+			return nil
+		}
+	}
+}
 
-			if err != nil {
-				log.Printf("Error fetching and pushing data: %v", err)
-				if otelClient != nil {
-					otelClient.RecordPushError(ctx)
+// watch reads a local aircraft.json whenever the decoder rewrites it, until ctx is cancelled or
+// the HTTP server fails
+func (p *pipeline) watch(ctx context.Context, fetcher *flightaware.Fetcher, path string) error {
+	changes, err := watch.File(ctx, path)
+	if err != nil {
+		return fmt.Errorf("failed to watch %s: %w", path, err)
+	}
+
+	for {
+		select {
+		case _, ok := <-changes:
+			if !ok {
+				log.Println("Received shutdown signal, exiting...")
+				return nil
+			}
+			p.fetch(ctx, fetcher)
+		case err := <-p.serverErr:
+			return err
+		}
+	}
+}
+
+// fetch fetches and processes one snapshot, logging failures
+func (p *pipeline) fetch(ctx context.Context, fetcher *flightaware.Fetcher) {
+	start := time.Now()
+	err := fetchAndProcess(ctx, p.processor, fetcher, p.metrics, p.monitor)
+	duration := time.Since(start)
+
+	if err != nil {
+		log.Printf("Error fetching and pushing data: %v", err)
+		if p.otelClient != nil {
+			p.otelClient.RecordPushError(ctx)
+		}
+	} else if p.otelClient != nil {
+		p.otelClient.RecordFetchDuration(ctx, duration)
+	}
+}
+
+// streamSource is an input pushing updates, merged into the latest state of each aircraft
+type streamSource interface {
+	Run(ctx context.Context)
+	Snapshot(now time.Time) *models.AutoGenerated
+	Err() error // Why the source isn't receiving, nil while it is
+}
+
+// stream reads a stream and processes a snapshot of the tracked aircraft every interval,
+// until ctx is cancelled or the HTTP server fails
+func (p *pipeline) stream(ctx context.Context, client streamSource, interval time.Duration) error {
+	go client.Run(ctx)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			// Aircraft are kept for a while after a disconnect, so they end like with a stalled aircraft.json
+			data := client.Snapshot(time.Now())
+			err := client.Err()
+			if p.monitor != nil {
+				p.monitor.RecordFetch(inputName, len(data.Aircraft), err)
+			}
+			if err := p.processor.Process(ctx, data, time.Now()); err != nil {
+				log.Printf("Error pushing data: %v", err)
+				if p.otelClient != nil {
+					p.otelClient.RecordPushError(ctx)
 				}
-			} else if otelClient != nil {
-				otelClient.RecordFetchDuration(ctx, duration)
 			}
-		case <-sigChan:
-			log.Println("Received shutdown signal, exiting...")
-			return
+		case err := <-p.serverErr:
+			return err
 		case <-ctx.Done():
-			return
+			log.Println("Received shutdown signal, exiting...")
+			return nil
 		}
 	}
 }
 
+// streamAddress returns the network and address of a stream URL: sbs+unix:///path for a
+// Unix socket, sbs://host:port and sbs+tcp://host:port for TCP, or mqtt://host:port and
+// mqtts://host:port for an MQTT broker, whose network is "mqtt". ok is false for other URLs,
+// which are fetched. Beast streams are rejected, decoding them needs a full Mode S decoder.
+func streamAddress(rawURL string) (network, address string, ok bool, err error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", "", false, fmt.Errorf("invalid input URL: %w", err)
+	}
+	switch u.Scheme {
+	case "mqtt", "mqtts":
+		if u.Host == "" {
+			return "", "", false, fmt.Errorf("invalid input URL %q: missing host:port", rawURL)
+		}
+		return "mqtt", rawURL, true, nil
+	case "sbs", "sbs+tcp":
+		if u.Host == "" {
+			return "", "", false, fmt.Errorf("invalid input URL %q: missing host:port", rawURL)
+		}
+		return "tcp", u.Host, true, nil
+	case "sbs+unix":
+		if u.Path == "" {
+			return "", "", false, fmt.Errorf("invalid input URL %q: missing socket path", rawURL)
+		}
+		return "unix", u.Path, true, nil
+	case "beast", "beast+tcp", "beast+unix":
+		return "", "", false, errors.New("beast streams aren't supported, use the decoder's SBS output (port 30003) with an sbs:// URL instead")
+	}
+	return "", "", false, nil
+}
+
+// receiverFileURL returns the URL of a decoder file such as stats.json from the environment variable key,
+// defaulting to the directory of aircraft.json. A value of "off" disables the file.
+func receiverFileURL(key, aircraftURL, name string) string {
+	value := os.Getenv(key)
+	if value == "off" {
+		return ""
+	}
+	if value != "" {
+		return value
+	}
+
+	u, err := receiver.FileURL(aircraftURL, name)
+	if err != nil {
+		log.Printf("Not using %s: %v", name, err)
+		return ""
+	}
+	return u
+}
+
+// fetchStation fetches receiver.json, returning nil if it is disabled or unavailable
+func fetchStation(ctx context.Context, aircraftURL string) *receiver.Receiver {
+	url := receiverFileURL("RECEIVER_JSON_URL", aircraftURL, "receiver.json")
+	if url == "" {
+		return nil
+	}
+
+	station, err := receiver.FetchReceiver(ctx, url)
+	if err != nil {
+		log.Printf("Failed to fetch receiver.json, not auto-configuring: %v", err)
+		return nil
+	}
+	log.Printf("Receiver %s refreshes every %v", station.Version, station.RefreshInterval())
+	return station
+}
+
+// replayFromFile feeds a recording through the processor with the original timestamps
+func replayFromFile(ctx context.Context, processor *flightaware.Processor, path string, speed float64, monitor *health.Monitor) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open recording: %w", err)
+	}
+	defer file.Close()
+
+	reader, err := replay.NewReader(file)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	log.Printf("Replaying %s at speed %g", path, speed)
+	n, err := replay.Replay(ctx, reader, speed, func(ctx context.Context, data *models.AutoGenerated, ts time.Time) error {
+		if monitor != nil {
+			monitor.RecordFetch(replayInputName, len(data.Aircraft), nil)
+		}
+		return processor.Process(ctx, data, ts)
+	})
+	log.Printf("Replayed %d snapshots", n)
+	return err
+}
+
+// fetchAndProcess fetches one aircraft.json snapshot and runs it through the processor. Snapshots
+// that haven't changed aren't processed again, but aircraft gone in the meantime still expire.
+// Fetches are recorded in m and monitor when they aren't nil.
+func fetchAndProcess(ctx context.Context, processor *flightaware.Processor, fetcher *flightaware.Fetcher, m *metrics.Metrics, monitor *health.Monitor) error {
+	start := time.Now()
+	data, err := fetcher.Fetch(ctx)
+	if errors.Is(err, flightaware.ErrNotModified) {
+		if m != nil {
+			m.RecordUnchanged(time.Since(start))
+		}
+		if monitor != nil {
+			monitor.RecordUnchanged(inputName)
+		}
+		return processor.Expire(ctx, time.Now())
+	}
+	if m != nil {
+		m.RecordFetch(time.Since(start), err)
+		if errors.Is(err, flightaware.ErrDecode) {
+			m.RecordDecodeFailure()
+		}
+	}
+	if monitor != nil {
+		aircraft := 0
+		if data != nil {
+			aircraft = len(data.Aircraft)
+		}
+		monitor.RecordFetch(inputName, aircraft, err)
+	}
+	if err != nil {
+		return err
+	}
+	return processor.Process(ctx, data, time.Now())
+}
+
+// setupResource describes the service and receiver station for OpenTelemetry resources
+func setupResource() (otel.Resource, error) {
+	res := otel.Resource{
+		ServiceName:    "adsb2loki",
+		ServiceVersion: buildVersion(),
+		StationName:    os.Getenv("STATION_NAME"),
+		SDR:            os.Getenv("STATION_SDR"),
+		Tags:           parseKeyValues(os.Getenv("STATION_TAGS")),
+	}
+
+	lat, lon := os.Getenv("STATION_LAT"), os.Getenv("STATION_LON")
+	if lat != "" || lon != "" {
+		var err error
+		if res.Lat, err = strconv.ParseFloat(lat, 64); err != nil {
+			return res, fmt.Errorf("invalid STATION_LAT: %w", err)
+		}
+		if res.Lon, err = strconv.ParseFloat(lon, 64); err != nil {
+			return res, fmt.Errorf("invalid STATION_LON: %w", err)
+		}
+		res.HasLocation = true
+	}
+
+	if value := os.Getenv("STATION_ANTENNA_HEIGHT"); value != "" {
+		height, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return res, fmt.Errorf("invalid STATION_ANTENNA_HEIGHT: %w", err)
+		}
+		res.AntennaHeight = height
+	}
+
+	return res, nil
+}
+
+// configVersion returns a short hash of the configuration, so instances running with different settings can be told apart
+func configVersion() string {
+	var config []string
+	for _, kv := range os.Environ() {
+		for _, prefix := range configPrefixes {
+			if strings.HasPrefix(kv, prefix) {
+				config = append(config, kv)
+				break
+			}
+		}
+	}
+	sort.Strings(config)
+
+	sum := sha256.Sum256([]byte(strings.Join(config, "\n")))
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+// buildVersion returns the version set at build time, falling back to the module version or VCS revision
+func buildVersion() string {
+	if version != "" {
+		return version
+	}
+
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "dev"
+	}
+	if info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+
+	var revision, modified string
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			revision = setting.Value
+		case "vcs.modified":
+			modified = setting.Value
+		}
+	}
+	if revision == "" {
+		return "dev"
+	}
+	if len(revision) > 8 {
+		revision = revision[:8]
+	}
+	if modified == "true" {
+		revision += "-dirty"
+	}
+	return "dev-" + revision
+}
+
+// setupAlerts builds the alert manager and, when webhooks are configured, the dispatcher delivering to them
+func setupAlerts() (*alert.Manager, *alert.Dispatcher, error) {
+	geofences, err := alert.ParseGeofences(os.Getenv("ALERT_GEOFENCES"))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	manager := alert.NewManager(alert.Config{
+		WatchHexes:     splitList(os.Getenv("ALERT_WATCH_HEXES")),
+		WatchCallsigns: splitList(os.Getenv("ALERT_WATCH_CALLSIGNS")),
+		Geofences:      geofences,
+		DedupWindow:    getDurationOrDefault("ALERT_DEDUP_WINDOW", alert.DefaultDedupWindow),
+	})
+
+	urls := splitList(os.Getenv("ALERT_WEBHOOK_URLS"))
+	if len(urls) == 0 {
+		return manager, nil, nil
+	}
+
+	retries, err := getIntOrDefault("ALERT_WEBHOOK_RETRIES", 3)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var notifiers []alert.Notifier
+	for _, url := range urls {
+		webhook, err := alert.NewWebhook(alert.WebhookConfig{
+			URL:        url,
+			Template:   os.Getenv("ALERT_WEBHOOK_TEMPLATE"),
+			Headers:    parseKeyValues(os.Getenv("ALERT_WEBHOOK_HEADERS")),
+			MaxRetries: retries,
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		notifiers = append(notifiers, webhook)
+	}
+
+	return manager, alert.NewDispatcher(notifiers, 100), nil
+}
+
+// setupSeverity builds the severity rules, overriding the defaults from the environment
+func setupSeverity() (*severity.Rules, error) {
+	rules := severity.DefaultRules()
+
+	if value := os.Getenv("SEVERITY_SQUAWK_LEVELS"); value != "" {
+		rules.SquawkLevels = make(map[string]severity.Level)
+		for squawk, name := range parseKeyValues(value) {
+			level, err := severity.ParseLevel(name)
+			if err != nil {
+				return nil, fmt.Errorf("invalid SEVERITY_SQUAWK_LEVELS: %w", err)
+			}
+			rules.SquawkLevels[squawk] = level
+		}
+	}
+
+	levels := map[string]*severity.Level{
+		"SEVERITY_EMERGENCY_LEVEL": &rules.EmergencyLevel,
+		"SEVERITY_DEGRADED_LEVEL":  &rules.DegradedLevel,
+		"SEVERITY_STALE_LEVEL":     &rules.StaleLevel,
+	}
+	for key, target := range levels {
+		value := os.Getenv(key)
+		if value == "" {
+			continue
+		}
+		level, err := severity.ParseLevel(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", key, err)
+		}
+		*target = level
+	}
+
+	var err error
+	if rules.MinNacP, err = getIntOrDefault("SEVERITY_MIN_NACP", rules.MinNacP); err != nil {
+		return nil, err
+	}
+	if rules.MinSil, err = getIntOrDefault("SEVERITY_MIN_SIL", rules.MinSil); err != nil {
+		return nil, err
+	}
+	rules.StaleAfter = getDurationOrDefault("SEVERITY_STALE_AFTER", rules.StaleAfter)
+
+	return &rules, nil
+}
+
 // getEnvOrDefault returns the value of the environment variable or a default value
 func getEnvOrDefault(key, defaultValue string) string {
 	if value, exists := os.LookupEnv(key); exists {
@@ -98,3 +907,54 @@ func getEnvOrDefault(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+// getDurationOrDefault parses the environment variable as a duration, falling back to a default value
+func getDurationOrDefault(key string, defaultValue time.Duration) time.Duration {
+	value, exists := os.LookupEnv(key)
+	if !exists || value == "" {
+		return defaultValue
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("Warning: invalid duration %q for %s, using %v", value, key, defaultValue)
+		return defaultValue
+	}
+	return d
+}
+
+// getIntOrDefault parses the environment variable as an integer, falling back to a default value
+func getIntOrDefault(key string, defaultValue int) (int, error) {
+	value, exists := os.LookupEnv(key)
+	if !exists || value == "" {
+		return defaultValue, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", key, err)
+	}
+	return n, nil
+}
+
+// splitList splits a comma separated value, dropping empty items
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// parseKeyValues parses a comma separated list of key=value pairs
+func parseKeyValues(value string) map[string]string {
+	pairs := make(map[string]string)
+	for _, item := range splitList(value) {
+		k, v, ok := strings.Cut(item, "=")
+		if !ok {
+			continue
+		}
+		pairs[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+	return pairs
+}
@@ -0,0 +1,237 @@
+package alert
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rknightion/adsb2loki/pkg/geo"
+	"github.com/rknightion/adsb2loki/pkg/models"
+)
+
+// Reason identifies why an alert was raised
+type Reason string
+
+const (
+	ReasonSquawk    Reason = "squawk"
+	ReasonEmergency Reason = "emergency"
+	ReasonWatchlist Reason = "watchlist"
+	ReasonGeofence  Reason = "geofence"
+)
+
+// DefaultDedupWindow is how long a trigger must be absent before the same alert is raised again
+const DefaultDedupWindow = 30 * time.Minute
+
+// emergencySquawks maps the emergency transponder codes to their meaning
+var emergencySquawks = map[string]string{
+	"7500": "hijack",
+	"7600": "radio failure",
+	"7700": "general emergency",
+}
+
+// Alert is a notable condition of a single aircraft
+type Alert struct {
+	Reason    Reason    `json:"reason"`
+	Detail    string    `json:"detail"`
+	Message   string    `json:"message"`
+	Time      time.Time `json:"time"`
+	Hex       string    `json:"hex"`
+	Flight    string    `json:"flight,omitempty"`
+	Squawk    string    `json:"squawk,omitempty"`
+	Emergency string    `json:"emergency,omitempty"`
+	Altitude  *float64  `json:"altitude,omitempty"`
+	Lat       float64   `json:"lat,omitempty"`
+	Lon       float64   `json:"lon,omitempty"`
+}
+
+// Geofence is a named area that raises an alert when an aircraft enters it
+type Geofence struct {
+	Name string
+	geo.Circle
+}
+
+// ParseGeofences parses a comma separated list of NAME:LAT:LON:RADIUS_NM geofences
+func ParseGeofences(s string) ([]Geofence, error) {
+	var fences []Geofence
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		parts := strings.Split(item, ":")
+		if len(parts) != 4 {
+			return nil, fmt.Errorf("invalid geofence %q: expected NAME:LAT:LON:RADIUS_NM", item)
+		}
+
+		fence := Geofence{Name: parts[0]}
+		var err error
+		if fence.Lat, err = strconv.ParseFloat(parts[1], 64); err != nil {
+			return nil, fmt.Errorf("invalid latitude for geofence %s: %w", fence.Name, err)
+		}
+		if fence.Lon, err = strconv.ParseFloat(parts[2], 64); err != nil {
+			return nil, fmt.Errorf("invalid longitude for geofence %s: %w", fence.Name, err)
+		}
+		if fence.Radius, err = strconv.ParseFloat(parts[3], 64); err != nil {
+			return nil, fmt.Errorf("invalid radius for geofence %s: %w", fence.Name, err)
+		}
+
+		fences = append(fences, fence)
+	}
+	return fences, nil
+}
+
+// Config holds the alert rules
+type Config struct {
+	WatchHexes     []string
+	WatchCallsigns []string
+	Geofences      []Geofence
+	DedupWindow    time.Duration
+}
+
+// trigger is a condition that was observed for an aircraft
+type trigger struct {
+	reason Reason
+	detail string
+}
+
+// Manager evaluates alert rules against aircraft and suppresses repeated triggers
+type Manager struct {
+	mu             sync.Mutex
+	watchHexes     map[string]bool
+	watchCallsigns map[string]bool
+	geofences      []Geofence
+	dedupWindow    time.Duration
+	active         map[string]time.Time // Last time each trigger was observed, keyed by hex and trigger
+	inside         map[string]time.Time // Last time each aircraft was inside a geofence, keyed by hex and fence name
+}
+
+// NewManager creates a new alert manager from the given rules
+func NewManager(cfg Config) *Manager {
+	m := &Manager{
+		watchHexes:     make(map[string]bool),
+		watchCallsigns: make(map[string]bool),
+		geofences:      cfg.Geofences,
+		dedupWindow:    cfg.DedupWindow,
+		active:         make(map[string]time.Time),
+		inside:         make(map[string]time.Time),
+	}
+	if m.dedupWindow <= 0 {
+		m.dedupWindow = DefaultDedupWindow
+	}
+	for _, hex := range cfg.WatchHexes {
+		if hex = strings.ToLower(strings.TrimSpace(hex)); hex != "" {
+			m.watchHexes[hex] = true
+		}
+	}
+	for _, callsign := range cfg.WatchCallsigns {
+		if callsign = strings.ToUpper(strings.TrimSpace(callsign)); callsign != "" {
+			m.watchCallsigns[callsign] = true
+		}
+	}
+	return m
+}
+
+// Evaluate checks an aircraft against the rules and returns the alerts that are not duplicates
+func (m *Manager) Evaluate(aircraft *models.Aircraft, ts time.Time) []Alert {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	hex := strings.ToLower(aircraft.Hex)
+	callsign := aircraft.Callsign()
+
+	var triggers []trigger
+	if meaning, ok := emergencySquawks[aircraft.Squawk]; ok {
+		triggers = append(triggers, trigger{ReasonSquawk, aircraft.Squawk + " " + meaning})
+	}
+	if aircraft.Emergency != "" && aircraft.Emergency != "none" {
+		triggers = append(triggers, trigger{ReasonEmergency, aircraft.Emergency})
+	}
+	if m.watchHexes[hex] {
+		triggers = append(triggers, trigger{ReasonWatchlist, hex})
+	}
+	if callsign != "" && m.watchCallsigns[strings.ToUpper(callsign)] {
+		triggers = append(triggers, trigger{ReasonWatchlist, strings.ToUpper(callsign)})
+	}
+
+	// Geofences only trigger on entry, not while the aircraft stays inside
+	if aircraft.HasPosition() {
+		for _, fence := range m.geofences {
+			key := hex + "|" + fence.Name
+			if !fence.Contains(aircraft.Lat, aircraft.Lon) {
+				delete(m.inside, key)
+				continue
+			}
+			if last, ok := m.inside[key]; !ok || ts.Sub(last) > m.dedupWindow {
+				triggers = append(triggers, trigger{ReasonGeofence, fence.Name})
+			}
+			m.inside[key] = ts
+		}
+	}
+
+	var alerts []Alert
+	for _, t := range triggers {
+		key := hex + "|" + string(t.reason) + "|" + t.detail
+		last, seen := m.active[key]
+		m.active[key] = ts
+		if seen && ts.Sub(last) <= m.dedupWindow {
+			continue
+		}
+		alerts = append(alerts, newAlert(aircraft, hex, callsign, t, ts))
+	}
+
+	return alerts
+}
+
+// Expire forgets triggers and geofence memberships that have not been observed within the dedup window
+func (m *Manager) Expire(now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for key, last := range m.active {
+		if now.Sub(last) > m.dedupWindow {
+			delete(m.active, key)
+		}
+	}
+	for key, last := range m.inside {
+		if now.Sub(last) > m.dedupWindow {
+			delete(m.inside, key)
+		}
+	}
+}
+
+// newAlert builds an alert for a trigger with a human readable message
+func newAlert(aircraft *models.Aircraft, hex, callsign string, t trigger, ts time.Time) Alert {
+	a := Alert{
+		Reason:    t.reason,
+		Detail:    t.detail,
+		Time:      ts,
+		Hex:       hex,
+		Flight:    callsign,
+		Squawk:    aircraft.Squawk,
+		Emergency: aircraft.Emergency,
+		Lat:       aircraft.Lat,
+		Lon:       aircraft.Lon,
+	}
+	if alt, ok := aircraft.Altitude(); ok {
+		a.Altitude = &alt
+	}
+
+	name := hex
+	if callsign != "" {
+		name = fmt.Sprintf("%s (%s)", callsign, hex)
+	}
+	switch t.reason {
+	case ReasonSquawk:
+		a.Message = fmt.Sprintf("%s squawking %s", name, t.detail)
+	case ReasonEmergency:
+		a.Message = fmt.Sprintf("%s declared emergency: %s", name, t.detail)
+	case ReasonWatchlist:
+		a.Message = fmt.Sprintf("watchlisted aircraft %s seen", name)
+	case ReasonGeofence:
+		a.Message = fmt.Sprintf("%s entered geofence %s", name, t.detail)
+	}
+	return a
+}
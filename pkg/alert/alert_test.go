@@ -0,0 +1,108 @@
+package alert
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rknightion/adsb2loki/pkg/geo"
+	"github.com/rknightion/adsb2loki/pkg/models"
+)
+
+func TestManagerEmergencySquawk(t *testing.T) {
+	m := NewManager(Config{DedupWindow: 10 * time.Minute})
+	ts := time.Unix(1748083431, 0)
+	aircraft := &models.Aircraft{Hex: "4CA614", Flight: "EIN581  ", Squawk: "7700", Emergency: "general", AltBaro: float64(12000)}
+
+	alerts := m.Evaluate(aircraft, ts)
+	if len(alerts) != 2 {
+		t.Fatalf("Expected squawk and emergency alerts, got %+v", alerts)
+	}
+	if alerts[0].Reason != ReasonSquawk || alerts[0].Detail != "7700 general emergency" {
+		t.Errorf("Expected 7700 squawk alert, got %+v", alerts[0])
+	}
+	if alerts[0].Message != "EIN581 (4ca614) squawking 7700 general emergency" {
+		t.Errorf("Unexpected message %q", alerts[0].Message)
+	}
+	if alerts[1].Reason != ReasonEmergency || alerts[1].Detail != "general" {
+		t.Errorf("Expected emergency alert, got %+v", alerts[1])
+	}
+
+	// Repeat triggers while the condition persists are suppressed
+	if alerts := m.Evaluate(aircraft, ts.Add(5*time.Second)); len(alerts) != 0 {
+		t.Errorf("Expected duplicates to be suppressed, got %+v", alerts)
+	}
+	for offset := 5 * time.Minute; offset <= time.Hour; offset += 5 * time.Minute {
+		if alerts := m.Evaluate(aircraft, ts.Add(offset)); len(alerts) != 0 {
+			t.Fatalf("Expected continuous trigger to stay suppressed, got %+v", alerts)
+		}
+	}
+
+	// After the trigger has been absent for the window it fires again
+	if alerts := m.Evaluate(aircraft, ts.Add(2*time.Hour)); len(alerts) != 2 {
+		t.Errorf("Expected alerts to fire again after the window, got %+v", alerts)
+	}
+}
+
+func TestManagerIgnoresNormalAircraft(t *testing.T) {
+	m := NewManager(Config{})
+	aircraft := &models.Aircraft{Hex: "abc123", Squawk: "1234", Emergency: "none"}
+	if alerts := m.Evaluate(aircraft, time.Now()); len(alerts) != 0 {
+		t.Errorf("Expected no alerts, got %+v", alerts)
+	}
+}
+
+func TestManagerWatchlist(t *testing.T) {
+	m := NewManager(Config{WatchHexes: []string{"43C6F1"}, WatchCallsigns: []string{"rrr123"}})
+	ts := time.Now()
+
+	alerts := m.Evaluate(&models.Aircraft{Hex: "43c6f1"}, ts)
+	if len(alerts) != 1 || alerts[0].Reason != ReasonWatchlist || alerts[0].Detail != "43c6f1" {
+		t.Errorf("Expected hex watchlist alert, got %+v", alerts)
+	}
+
+	alerts = m.Evaluate(&models.Aircraft{Hex: "abc123", Flight: "RRR123 "}, ts)
+	if len(alerts) != 1 || alerts[0].Detail != "RRR123" {
+		t.Errorf("Expected callsign watchlist alert, got %+v", alerts)
+	}
+}
+
+func TestManagerGeofenceEntry(t *testing.T) {
+	fence := Geofence{Name: "home", Circle: geo.Circle{Lat: 51.5, Lon: -0.1, Radius: 5}}
+	m := NewManager(Config{Geofences: []Geofence{fence}, DedupWindow: time.Minute})
+	ts := time.Unix(1748083431, 0)
+
+	if alerts := m.Evaluate(&models.Aircraft{Hex: "abc123", Lat: 52.5, Lon: -0.1}, ts); len(alerts) != 0 {
+		t.Fatalf("Expected no alert outside the fence, got %+v", alerts)
+	}
+
+	alerts := m.Evaluate(&models.Aircraft{Hex: "abc123", Lat: 51.51, Lon: -0.1}, ts.Add(time.Second))
+	if len(alerts) != 1 || alerts[0].Reason != ReasonGeofence || alerts[0].Detail != "home" {
+		t.Fatalf("Expected geofence entry alert, got %+v", alerts)
+	}
+
+	// Staying inside doesn't trigger again
+	if alerts := m.Evaluate(&models.Aircraft{Hex: "abc123", Lat: 51.5, Lon: -0.1}, ts.Add(30*time.Second)); len(alerts) != 0 {
+		t.Errorf("Expected no alert while inside, got %+v", alerts)
+	}
+
+	// Leaving and re-entering after the window triggers again
+	m.Evaluate(&models.Aircraft{Hex: "abc123", Lat: 52.5, Lon: -0.1}, ts.Add(3*time.Minute))
+	alerts = m.Evaluate(&models.Aircraft{Hex: "abc123", Lat: 51.5, Lon: -0.1}, ts.Add(10*time.Minute))
+	if len(alerts) != 1 {
+		t.Errorf("Expected re-entry alert, got %+v", alerts)
+	}
+}
+
+func TestParseGeofences(t *testing.T) {
+	fences, err := ParseGeofences("home:51.5:-0.1:5, airport:53.42:-6.27:10")
+	if err != nil {
+		t.Fatalf("Failed to parse geofences: %v", err)
+	}
+	if len(fences) != 2 || fences[1].Name != "airport" || fences[1].Radius != 10 {
+		t.Errorf("Unexpected geofences %+v", fences)
+	}
+
+	if _, err := ParseGeofences("home:51.5:-0.1"); err == nil {
+		t.Error("Expected error for missing radius")
+	}
+}
@@ -0,0 +1,192 @@
+package alert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync/atomic"
+	"text/template"
+	"time"
+)
+
+// Notifier delivers alerts to an external system
+type Notifier interface {
+	Notify(ctx context.Context, alert Alert) error
+}
+
+// WebhookConfig configures a generic JSON webhook
+type WebhookConfig struct {
+	URL        string
+	Template   string // Optional Go text/template for the body, the alert is marshalled as JSON when empty
+	Headers    map[string]string
+	MaxRetries int
+	Backoff    time.Duration // Initial delay between retries, doubled after each attempt
+}
+
+// Webhook posts alerts as JSON to a URL
+type Webhook struct {
+	url        string
+	template   *template.Template
+	headers    map[string]string
+	maxRetries int
+	backoff    time.Duration
+	client     *http.Client
+}
+
+// NewWebhook creates a new webhook notifier
+func NewWebhook(cfg WebhookConfig) (*Webhook, error) {
+	w := &Webhook{
+		url:        cfg.URL,
+		headers:    cfg.Headers,
+		maxRetries: cfg.MaxRetries,
+		backoff:    cfg.Backoff,
+		client: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+	}
+	if w.backoff <= 0 {
+		w.backoff = time.Second
+	}
+
+	if cfg.Template != "" {
+		tmpl, err := template.New("webhook").Funcs(template.FuncMap{"json": toJSON}).Parse(cfg.Template)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse webhook template: %w", err)
+		}
+		w.template = tmpl
+	}
+
+	return w, nil
+}
+
+// Notify posts the alert, retrying on network errors and 429/5xx responses
+func (w *Webhook) Notify(ctx context.Context, alert Alert) error {
+	body, err := w.render(alert)
+	if err != nil {
+		return err
+	}
+
+	backoff := w.backoff
+	for attempt := 0; ; attempt++ {
+		retry, err := w.post(ctx, body)
+		if err == nil {
+			return nil
+		}
+		if !retry || attempt >= w.maxRetries {
+			return err
+		}
+
+		select {
+		case <-time.After(backoff):
+			backoff *= 2
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// render builds the request body for an alert
+func (w *Webhook) render(alert Alert) ([]byte, error) {
+	if w.template == nil {
+		data, err := json.Marshal(alert)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal alert: %w", err)
+		}
+		return data, nil
+	}
+
+	var buf bytes.Buffer
+	if err := w.template.Execute(&buf, alert); err != nil {
+		return nil, fmt.Errorf("failed to render webhook template: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// post sends a single request and reports whether a failure is worth retrying
+func (w *Webhook) post(ctx context.Context, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range w.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return true, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return retry, fmt.Errorf("webhook returned status %d", resp.StatusCode)
+}
+
+// toJSON is the template function that quotes a value as JSON
+func toJSON(v interface{}) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// Dispatcher delivers alerts to notifiers in the background so slow webhooks don't hold up the pipeline
+type Dispatcher struct {
+	notifiers []Notifier
+	queue     chan Alert
+	dropped   atomic.Uint64
+}
+
+// NewDispatcher creates a new dispatcher buffering up to size alerts
+func NewDispatcher(notifiers []Notifier, size int) *Dispatcher {
+	return &Dispatcher{
+		notifiers: notifiers,
+		queue:     make(chan Alert, size),
+	}
+}
+
+// Enqueue queues an alert for delivery, dropping it if the queue is full
+func (d *Dispatcher) Enqueue(alert Alert) {
+	select {
+	case d.queue <- alert:
+	default:
+		d.dropped.Add(1)
+		log.Printf("Alert queue full, dropping alert: %s", alert.Message)
+	}
+}
+
+// Len returns the number of alerts waiting for delivery
+func (d *Dispatcher) Len() int {
+	return len(d.queue)
+}
+
+// Dropped returns the number of alerts dropped because the queue was full
+func (d *Dispatcher) Dropped() uint64 {
+	return d.dropped.Load()
+}
+
+// Run delivers queued alerts until the context is cancelled
+func (d *Dispatcher) Run(ctx context.Context) {
+	for {
+		select {
+		case alert := <-d.queue:
+			for _, n := range d.notifiers {
+				if err := n.Notify(ctx, alert); err != nil {
+					log.Printf("Failed to deliver alert: %v", err)
+				}
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package alert
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func testAlert() Alert {
+	return Alert{
+		Reason:  ReasonSquawk,
+		Detail:  "7700 general emergency",
+		Message: "EIN581 (4ca614) squawking 7700 general emergency",
+		Time:    time.Unix(1748083431, 0).UTC(),
+		Hex:     "4ca614",
+		Flight:  "EIN581",
+		Squawk:  "7700",
+	}
+}
+
+func TestWebhookDefaultBody(t *testing.T) {
+	var received Alert
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			t.Errorf("Expected method POST, got %s", r.Method)
+		}
+		if r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("Expected Content-Type application/json, got %s", r.Header.Get("Content-Type"))
+		}
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			t.Errorf("Expected configured Authorization header, got %q", r.Header.Get("Authorization"))
+		}
+		if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+			t.Errorf("Failed to decode body: %v", err)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	webhook, err := NewWebhook(WebhookConfig{URL: server.URL, Headers: map[string]string{"Authorization": "Bearer secret"}})
+	if err != nil {
+		t.Fatalf("Failed to create webhook: %v", err)
+	}
+
+	if err := webhook.Notify(context.Background(), testAlert()); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if received.Hex != "4ca614" || received.Reason != ReasonSquawk {
+		t.Errorf("Unexpected alert received: %+v", received)
+	}
+}
+
+func TestWebhookTemplate(t *testing.T) {
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		body = string(data)
+	}))
+	defer server.Close()
+
+	webhook, err := NewWebhook(WebhookConfig{URL: server.URL, Template: `{"text": {{json .Message}}, "hex": "{{.Hex}}"}`})
+	if err != nil {
+		t.Fatalf("Failed to create webhook: %v", err)
+	}
+
+	if err := webhook.Notify(context.Background(), testAlert()); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	expected := `{"text": "EIN581 (4ca614) squawking 7700 general emergency", "hex": "4ca614"}`
+	if body != expected {
+		t.Errorf("Expected body %s, got %s", expected, body)
+	}
+}
+
+func TestWebhookInvalidTemplate(t *testing.T) {
+	if _, err := NewWebhook(WebhookConfig{URL: "http://localhost", Template: "{{.Missing"}); err == nil {
+		t.Error("Expected error for invalid template")
+	}
+}
+
+func TestWebhookRetry(t *testing.T) {
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if atomic.AddInt32(&attempts, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	webhook, err := NewWebhook(WebhookConfig{URL: server.URL, MaxRetries: 3, Backoff: time.Millisecond})
+	if err != nil {
+		t.Fatalf("Failed to create webhook: %v", err)
+	}
+
+	if err := webhook.Notify(context.Background(), testAlert()); err != nil {
+		t.Fatalf("Expected delivery after retries, got %v", err)
+	}
+	if attempts != 3 {
+		t.Errorf("Expected 3 attempts, got %d", attempts)
+	}
+}
+
+func TestWebhookNoRetryOnClientError(t *testing.T) {
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	webhook, err := NewWebhook(WebhookConfig{URL: server.URL, MaxRetries: 3, Backoff: time.Millisecond})
+	if err != nil {
+		t.Fatalf("Failed to create webhook: %v", err)
+	}
+
+	if err := webhook.Notify(context.Background(), testAlert()); err == nil {
+		t.Error("Expected error for bad request")
+	}
+	if attempts != 1 {
+		t.Errorf("Expected 1 attempt, got %d", attempts)
+	}
+}
+
+func TestDispatcher(t *testing.T) {
+	received := make(chan Alert, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		var a Alert
+		_ = json.NewDecoder(r.Body).Decode(&a)
+		received <- a
+	}))
+	defer server.Close()
+
+	webhook, err := NewWebhook(WebhookConfig{URL: server.URL})
+	if err != nil {
+		t.Fatalf("Failed to create webhook: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dispatcher := NewDispatcher([]Notifier{webhook}, 10)
+	go dispatcher.Run(ctx)
+
+	dispatcher.Enqueue(testAlert())
+	select {
+	case a := <-received:
+		if a.Hex != "4ca614" {
+			t.Errorf("Unexpected alert delivered: %+v", a)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for alert delivery")
+	}
+}
+
+func TestDispatcherDropsWhenFull(t *testing.T) {
+	dispatcher := NewDispatcher(nil, 1)
+
+	dispatcher.Enqueue(testAlert())
+	dispatcher.Enqueue(testAlert())
+
+	if dispatcher.Len() != 1 {
+		t.Errorf("Expected 1 queued alert, got %d", dispatcher.Len())
+	}
+	if dispatcher.Dropped() != 1 {
+		t.Errorf("Expected 1 dropped alert, got %d", dispatcher.Dropped())
+	}
+}
@@ -0,0 +1,428 @@
+package backfill
+
+import (
+	"container/heap"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/rknightion/adsb2loki/pkg/common"
+	"github.com/rknightion/adsb2loki/pkg/flightaware"
+	"github.com/rknightion/adsb2loki/pkg/models"
+)
+
+// Defaults for a Backfiller
+const (
+	DefaultBatchSize  = 1000
+	DefaultMaxRetries = 5
+	dayLayout         = "2006-01-02"
+)
+
+// Checkpoint records how far a backfill got, so an interrupted run can resume
+type Checkpoint struct {
+	Day    string `json:"day"`    // Day being processed, as YYYY-MM-DD
+	Offset int    `json:"offset"` // Number of points of that day already pushed
+}
+
+// Stats summarises a backfill run
+type Stats struct {
+	Days     int // Days with a traces directory
+	Files    int // Trace files read
+	Points   int // Trace points processed, excluding those skipped by the checkpoint
+	Entries  int // Entries pushed
+	Batches  int // Successful pushes
+	Rejected int // Entries Loki refused, e.g. because they are too old
+}
+
+// Backfiller pushes the per-aircraft traces readsb writes with --write-globe-history to a logger
+// with their original timestamps. Points of a day are pushed in time order across all aircraft,
+// so each stream only moves forward and stays within Loki's out-of-order window.
+type Backfiller struct {
+	Dir       string        // globe_history directory, containing YYYY/MM/DD/traces
+	Logger    common.Logger // Destination, usually the Loki client
+	Processor *flightaware.Processor
+	// Labels are added to every entry, keeping backfilled streams apart from the live ones
+	Labels     map[string]string
+	BatchSize  int     // Entries per push
+	Rate       float64 // Maximum entries per second, 0 for no limit
+	MaxRetries int     // Retries of a push rejected with 429 or 5xx
+	Checkpoint string  // Optional checkpoint file to resume from and update
+
+	pending *batch
+	last    time.Time // When the previous push started
+	sleep   func(ctx context.Context, d time.Duration) error
+}
+
+// New creates a backfiller reading dir and pushing to logger. The processor converts points to
+// entries exactly like live snapshots; attach sessions or severity rules to it before running.
+func New(dir string, logger common.Logger) *Backfiller {
+	b := &Backfiller{
+		Dir:        dir,
+		Logger:     logger,
+		Labels:     map[string]string{"source": "backfill"},
+		BatchSize:  DefaultBatchSize,
+		MaxRetries: DefaultMaxRetries,
+		pending:    &batch{},
+		sleep:      sleep,
+	}
+	b.Processor = flightaware.NewProcessor(b.pending)
+	return b
+}
+
+// batch buffers the entries the processor produces until they are pushed
+type batch struct {
+	entries []common.LogEntry
+}
+
+func (c *batch) PushLogs(_ context.Context, entries []common.LogEntry) error {
+	c.entries = append(c.entries, entries...)
+	return nil
+}
+
+// Run backfills every day from from to to inclusive, in UTC
+func (b *Backfiller) Run(ctx context.Context, from, to time.Time) (Stats, error) {
+	var stats Stats
+
+	cp, err := b.loadCheckpoint()
+	if err != nil {
+		return stats, err
+	}
+	if cp.Day != "" {
+		log.Printf("Resuming backfill from %s at point %d", cp.Day, cp.Offset)
+	}
+
+	from = truncateDay(from)
+	to = truncateDay(to)
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		name := day.Format(dayLayout)
+		if cp.Day != "" && name < cp.Day {
+			continue
+		}
+		offset := 0
+		if name == cp.Day {
+			offset = cp.Offset
+		}
+
+		if err := b.runDay(ctx, day, offset, &stats); err != nil {
+			return stats, fmt.Errorf("failed to backfill %s: %w", name, err)
+		}
+	}
+	return stats, nil
+}
+
+// runDay pushes the points of one day, skipping the first offset
+func (b *Backfiller) runDay(ctx context.Context, day time.Time, offset int, stats *Stats) error {
+	name := day.Format(dayLayout)
+	files, err := filepath.Glob(filepath.Join(b.Dir, day.Format("2006/01/02"), "traces", "*", "trace_full_*.json"))
+	if err != nil {
+		return fmt.Errorf("failed to list traces: %w", err)
+	}
+	if len(files) == 0 {
+		return nil
+	}
+	sort.Strings(files)
+	stats.Days++
+
+	points, err := openDay(files, day)
+	if err != nil {
+		return err
+	}
+	stats.Files += len(files)
+	log.Printf("Backfilling %s from %d traces", name, len(files))
+
+	b.pending.entries = b.pending.entries[:0]
+	i := 0
+	for ; ; i++ {
+		p, ok, err := points.next()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			break
+		}
+		if i < offset {
+			continue
+		}
+		data := &models.AutoGenerated{
+			Now:      float64(p.time.UnixNano()) / float64(time.Second),
+			Aircraft: []models.Aircraft{p.aircraft},
+		}
+		if err := b.Processor.Process(ctx, data, p.time); err != nil {
+			return err
+		}
+		stats.Points++
+
+		if len(b.pending.entries) >= b.BatchSize {
+			if err := b.flush(ctx, stats); err != nil {
+				return err
+			}
+			if err := b.saveCheckpoint(Checkpoint{Day: name, Offset: i + 1}); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Push the remainder of the day
+	if len(b.pending.entries) == 0 {
+		return nil
+	}
+	if err := b.flush(ctx, stats); err != nil {
+		return err
+	}
+	return b.saveCheckpoint(Checkpoint{Day: name, Offset: i})
+}
+
+// dayPoint is a trace point converted to an aircraft, ready to be processed
+type dayPoint struct {
+	time     time.Time
+	aircraft models.Aircraft
+	index    int // Position within its trace, to keep the order stable
+}
+
+// traceCursor walks the points of one trace that fall on a day. Points are decoded one at a
+// time, so only the compact trace is kept in memory rather than every converted aircraft.
+type traceCursor struct {
+	trace   *Trace
+	next    int              // Index of the next point to decode
+	details *models.Aircraft // Details are only written when they change, so carry them forward
+	point   dayPoint         // Current point
+}
+
+// advance moves to the next point of the day, returning false once the trace is exhausted
+func (c *traceCursor) advance(day, end time.Time) (bool, error) {
+	for ; c.next < len(c.trace.Trace); c.next++ {
+		p, err := c.trace.Point(c.next)
+		if err != nil {
+			return false, err
+		}
+		if p.Details != nil {
+			c.details = p.Details
+		}
+		if p.Time.Before(day) || !p.Time.Before(end) {
+			continue
+		}
+		c.point = dayPoint{time: p.Time, aircraft: c.trace.Aircraft(p, c.details), index: c.next}
+		c.next++
+		return true, nil
+	}
+	return false, nil
+}
+
+// cursorHeap orders cursors by their current point: time, then hex, then position in the trace
+type cursorHeap []*traceCursor
+
+func (h cursorHeap) Len() int { return len(h) }
+
+func (h cursorHeap) Less(i, j int) bool {
+	a, b := h[i].point, h[j].point
+	if !a.time.Equal(b.time) {
+		return a.time.Before(b.time)
+	}
+	if a.aircraft.Hex != b.aircraft.Hex {
+		return a.aircraft.Hex < b.aircraft.Hex
+	}
+	return a.index < b.index
+}
+
+func (h cursorHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *cursorHeap) Push(x any) { *h = append(*h, x.(*traceCursor)) }
+
+func (h *cursorHeap) Pop() any {
+	old := *h
+	c := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return c
+}
+
+// dayMerge merges the traces of a day into a single time ordered sequence of points. readsb
+// writes each trace in time order, so a k-way merge yields the same order as sorting all points.
+type dayMerge struct {
+	day, end time.Time
+	cursors  cursorHeap
+}
+
+// openDay reads the trace files of a day and positions a cursor on the first point of each
+func openDay(files []string, day time.Time) (*dayMerge, error) {
+	m := &dayMerge{day: day, end: day.AddDate(0, 0, 1)}
+	for _, path := range files {
+		trace, err := readTrace(path)
+		if err != nil {
+			return nil, err
+		}
+		c := &traceCursor{trace: trace}
+		ok, err := c.advance(m.day, m.end)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode %s: %w", path, err)
+		}
+		if ok {
+			m.cursors = append(m.cursors, c)
+		}
+	}
+	heap.Init(&m.cursors)
+	return m, nil
+}
+
+// next returns the earliest remaining point, and false once all traces are exhausted
+func (m *dayMerge) next() (dayPoint, bool, error) {
+	if len(m.cursors) == 0 {
+		return dayPoint{}, false, nil
+	}
+	c := m.cursors[0]
+	p := c.point
+	ok, err := c.advance(m.day, m.end)
+	if err != nil {
+		return dayPoint{}, false, fmt.Errorf("failed to decode trace of %s: %w", c.trace.Icao, err)
+	}
+	if ok {
+		heap.Fix(&m.cursors, 0)
+	} else {
+		heap.Pop(&m.cursors)
+	}
+	return p, true, nil
+}
+
+// readTrace opens and decodes a single trace file
+func readTrace(path string) (*Trace, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open trace: %w", err)
+	}
+	defer file.Close()
+
+	trace, err := ParseTrace(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return trace, nil
+}
+
+// flush pushes the pending entries, pacing pushes to the rate limit and retrying rate limited
+// or failed pushes with backoff. Entries Loki refuses outright are counted and skipped.
+func (b *Backfiller) flush(ctx context.Context, stats *Stats) error {
+	if len(b.pending.entries) == 0 {
+		return nil
+	}
+	for i := range b.pending.entries {
+		for k, v := range b.Labels {
+			b.pending.entries[i].Labels[k] = v
+		}
+	}
+
+	backoff := time.Second
+	for attempt := 0; ; attempt++ {
+		// Space pushes so the average stays below the rate limit
+		if b.Rate > 0 && !b.last.IsZero() {
+			due := b.last.Add(time.Duration(float64(len(b.pending.entries)) / b.Rate * float64(time.Second)))
+			if err := b.sleep(ctx, time.Until(due)); err != nil {
+				return err
+			}
+		}
+		b.last = time.Now()
+
+		err := b.Logger.PushLogs(ctx, b.pending.entries)
+		if err == nil {
+			stats.Entries += len(b.pending.entries)
+			stats.Batches++
+			b.pending.entries = b.pending.entries[:0]
+			return nil
+		}
+
+		var statusErr *common.StatusError
+		if errors.As(err, &statusErr) && !statusErr.Retryable() {
+			log.Printf("Loki rejected %d backfill entries: %v", len(b.pending.entries), err)
+			stats.Rejected += len(b.pending.entries)
+			b.pending.entries = b.pending.entries[:0]
+			return nil
+		}
+		if attempt >= b.MaxRetries || ctx.Err() != nil {
+			return fmt.Errorf("failed to push logs: %w", err)
+		}
+
+		wait := backoff
+		if statusErr != nil && statusErr.RetryAfter > wait {
+			wait = statusErr.RetryAfter
+		}
+		log.Printf("Backfill push failed, retrying in %v: %v", wait, err)
+		if err := b.sleep(ctx, wait); err != nil {
+			return err
+		}
+		backoff = min(2*backoff, time.Minute)
+	}
+}
+
+// loadCheckpoint reads the checkpoint file, returning an empty checkpoint if there is none
+func (b *Backfiller) loadCheckpoint() (Checkpoint, error) {
+	var cp Checkpoint
+	if b.Checkpoint == "" {
+		return cp, nil
+	}
+
+	data, err := os.ReadFile(b.Checkpoint)
+	if errors.Is(err, os.ErrNotExist) {
+		return cp, nil
+	}
+	if err != nil {
+		return cp, fmt.Errorf("failed to read checkpoint: %w", err)
+	}
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return cp, fmt.Errorf("failed to decode checkpoint: %w", err)
+	}
+	return cp, nil
+}
+
+// saveCheckpoint atomically replaces the checkpoint file
+func (b *Backfiller) saveCheckpoint(cp Checkpoint) error {
+	if b.Checkpoint == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return fmt.Errorf("failed to marshal checkpoint: %w", err)
+	}
+	tmp := b.Checkpoint + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	if err := os.Rename(tmp, b.Checkpoint); err != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	return nil
+}
+
+// ParseDay parses a YYYY-MM-DD date in UTC
+func ParseDay(s string) (time.Time, error) {
+	day, err := time.Parse(dayLayout, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid day %q, expected YYYY-MM-DD: %w", s, err)
+	}
+	return day, nil
+}
+
+// truncateDay returns midnight UTC of the day t falls on
+func truncateDay(t time.Time) time.Time {
+	y, m, d := t.UTC().Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// sleep waits for d or until ctx is cancelled
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,230 @@
+package backfill
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rknightion/adsb2loki/pkg/common"
+	"github.com/rknightion/adsb2loki/pkg/models"
+)
+
+// Midnight of the test day, 2024-05-24
+const testDay = 1716508800
+
+const traceA = `{"icao":"4ca614","r":"EI-DEI","t":"A320","desc":"AIRBUS A-320","timestamp":1716508800,"trace":[
+[3600,53.421,-6.27,"ground",12.5,280.1,2,null,{"flight":"EIN581  ","squawk":"7000","category":"A3"},"adsb_icao",null,null,null,null],
+[3610,53.43,-6.3,1500,150,280.4,0,1792,null,"adsb_icao",1650,1856,145,2.1],
+[3620,53.44,-6.33,3000,180,281,4,2048,null,"adsb_icao",null,null,null,null]
+]}`
+
+const traceB = `{"icao":"~3c6444","t":"B738","timestamp":1716508800,"trace":[
+[3605,51.47,-0.45,36000,450,90,0,0,{"flight":"DLH400  ","category":"A3"},"mlat",null,null,null,null],
+[90000,51.5,-0.3,36000,450,90,0,0,null,"mlat",null,null,null,null]
+]}`
+
+// writeTrace writes a trace file into the globe_history layout, optionally gzip compressed
+func writeTrace(t *testing.T, dir, day, hex, content string, compress bool) {
+	t.Helper()
+	path := filepath.Join(dir, day, "traces", hex[len(hex)-2:], "trace_full_"+hex+".json")
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatalf("Failed to create traces directory: %v", err)
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("Failed to create trace: %v", err)
+	}
+	defer file.Close()
+
+	if !compress {
+		file.WriteString(content)
+		return
+	}
+	gz := gzip.NewWriter(file)
+	gz.Write([]byte(content))
+	gz.Close()
+}
+
+func testHistory(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	writeTrace(t, dir, "2024/05/24", "4ca614", traceA, true)
+	writeTrace(t, dir, "2024/05/24", "~3c6444", traceB, false)
+	return dir
+}
+
+// recordingLogger keeps every push and can fail a number of them
+type recordingLogger struct {
+	pushes [][]common.LogEntry
+	errs   []error // Returned by the next pushes, in order
+}
+
+func (l *recordingLogger) PushLogs(_ context.Context, entries []common.LogEntry) error {
+	if len(l.errs) > 0 {
+		err := l.errs[0]
+		l.errs = l.errs[1:]
+		if err != nil {
+			return err
+		}
+	}
+	l.pushes = append(l.pushes, append([]common.LogEntry(nil), entries...))
+	return nil
+}
+
+func (l *recordingLogger) entries() []common.LogEntry {
+	var all []common.LogEntry
+	for _, p := range l.pushes {
+		all = append(all, p...)
+	}
+	return all
+}
+
+func TestParseTrace(t *testing.T) {
+	trace, err := ParseTrace(strings.NewReader(traceA))
+	if err != nil {
+		t.Fatalf("Failed to parse trace: %v", err)
+	}
+	points, err := trace.Points()
+	if err != nil {
+		t.Fatalf("Failed to decode points: %v", err)
+	}
+	if len(points) != 3 {
+		t.Fatalf("Expected 3 points, got %d", len(points))
+	}
+
+	first := trace.Aircraft(points[0], points[0].Details)
+	if !first.OnGround() || first.Callsign() != "EIN581" || first.R != "EI-DEI" {
+		t.Errorf("Expected EIN581 on the ground with its registration, got %+v", first)
+	}
+	if !points[0].Time.Equal(time.Unix(testDay+3600, 0)) {
+		t.Errorf("Expected the point time to be offset from the trace timestamp, got %v", points[0].Time)
+	}
+
+	second := trace.Aircraft(points[1], points[0].Details)
+	if second.AltBaro != float64(1500) || second.BaroRate != float64(1792) || second.AltGeom != float64(1650) {
+		t.Errorf("Expected barometric altitude and rate with geometric altitude, got %+v", second)
+	}
+	if second.Roll != 2.1 || second.Ias != float64(145) || second.Squawk != "7000" {
+		t.Errorf("Expected roll, IAS and the carried squawk, got %+v", second)
+	}
+
+	// Flag 4 marks the vertical rate as geometric
+	third := trace.Aircraft(points[2], nil)
+	if third.GeomRate != float64(2048) || third.BaroRate != nil {
+		t.Errorf("Expected a geometric rate, got baro %v geom %v", third.BaroRate, third.GeomRate)
+	}
+}
+
+func TestRun(t *testing.T) {
+	dir := testHistory(t)
+	logger := &recordingLogger{}
+
+	b := New(dir, logger)
+	b.BatchSize = 2
+	day := time.Unix(testDay, 0)
+	stats, err := b.Run(context.Background(), day, day)
+	if err != nil {
+		t.Fatalf("Backfill failed: %v", err)
+	}
+
+	// The point of 3c6444 on the following day is skipped
+	if stats.Days != 1 || stats.Files != 2 || stats.Points != 4 || stats.Entries != 4 || stats.Batches != 2 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+
+	entries := logger.entries()
+	wantHex := []string{"4ca614", "3c6444", "4ca614", "4ca614"}
+	wantOffset := []int64{3600, 3605, 3610, 3620}
+	for i, e := range entries {
+		if !e.Timestamp.Equal(time.Unix(testDay+wantOffset[i], 0)) {
+			t.Errorf("Entry %d: expected original timestamp, got %v", i, e.Timestamp)
+		}
+		if e.StructuredMetadata["hex"] != wantHex[i] {
+			t.Errorf("Entry %d: expected hex %s, got %s", i, wantHex[i], e.StructuredMetadata["hex"])
+		}
+		if e.Labels["app"] != "flightaware" || e.Labels["source"] != "backfill" {
+			t.Errorf("Entry %d: expected backfill labels, got %v", i, e.Labels)
+		}
+	}
+
+	var aircraft models.Aircraft
+	if err := json.Unmarshal([]byte(entries[3].Line), &aircraft); err != nil {
+		t.Fatalf("Failed to decode entry line: %v", err)
+	}
+	if aircraft.Callsign() != "EIN581" || aircraft.T != "A320" {
+		t.Errorf("Expected details carried to later points, got %+v", aircraft)
+	}
+}
+
+func TestRunResumesFromCheckpoint(t *testing.T) {
+	dir := testHistory(t)
+	checkpoint := filepath.Join(t.TempDir(), "checkpoint.json")
+	day := time.Unix(testDay, 0)
+
+	// The second push fails for good, leaving a checkpoint after the first
+	logger := &recordingLogger{errs: []error{nil, errors.New("connection refused")}}
+	b := New(dir, logger)
+	b.BatchSize = 2
+	b.MaxRetries = 0
+	b.Checkpoint = checkpoint
+	if _, err := b.Run(context.Background(), day, day); err == nil {
+		t.Fatal("Expected the failed push to stop the backfill")
+	}
+
+	data, err := os.ReadFile(checkpoint)
+	if err != nil || string(data) != `{"day":"2024-05-24","offset":2}` {
+		t.Fatalf("Expected a checkpoint after two points, got %s and %v", data, err)
+	}
+
+	// A new run pushes only the remaining points
+	b = New(dir, logger)
+	b.BatchSize = 2
+	b.Checkpoint = checkpoint
+	stats, err := b.Run(context.Background(), day, day)
+	if err != nil {
+		t.Fatalf("Resumed backfill failed: %v", err)
+	}
+	if stats.Points != 2 {
+		t.Errorf("Expected 2 remaining points, got %d", stats.Points)
+	}
+	if n := len(logger.entries()); n != 4 {
+		t.Errorf("Expected each point pushed once, got %d entries", n)
+	}
+}
+
+func TestRunRetriesRateLimits(t *testing.T) {
+	dir := testHistory(t)
+	logger := &recordingLogger{errs: []error{
+		&common.StatusError{StatusCode: http.StatusTooManyRequests, RetryAfter: 5 * time.Second},
+		&common.StatusError{StatusCode: http.StatusBadRequest, Message: "entry too far behind"},
+	}}
+
+	b := New(dir, logger)
+	b.BatchSize = 2
+	var waits []time.Duration
+	b.sleep = func(_ context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		return nil
+	}
+
+	day := time.Unix(testDay, 0)
+	stats, err := b.Run(context.Background(), day, day)
+	if err != nil {
+		t.Fatalf("Backfill failed: %v", err)
+	}
+
+	// The rate limited batch is retried after Retry-After, the rejected one is skipped
+	if len(waits) != 1 || waits[0] != 5*time.Second {
+		t.Errorf("Expected one wait of 5s, got %v", waits)
+	}
+	if stats.Entries != 2 || stats.Rejected != 2 {
+		t.Errorf("Expected 2 pushed and 2 rejected entries, got %+v", stats)
+	}
+}
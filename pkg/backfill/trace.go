@@ -0,0 +1,205 @@
+package backfill
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/rknightion/adsb2loki/pkg/models"
+)
+
+// Trace point flags, from readsb's globe history format
+const (
+	FlagStale        = 1 << 0 // The position is stale
+	FlagNewLeg       = 1 << 1 // The point starts a new leg of the flight
+	FlagGeomRate     = 1 << 2 // The vertical rate is geometric rather than barometric
+	FlagGeomAltitude = 1 << 3 // The altitude is geometric rather than barometric
+)
+
+// Trace is a per-aircraft trace file written by readsb with --write-globe-history
+type Trace struct {
+	Icao      string            `json:"icao"`
+	R         string            `json:"r"`
+	T         string            `json:"t"`
+	Desc      string            `json:"desc"`
+	OwnOp     string            `json:"ownOp"`
+	Year      string            `json:"year"`
+	DbFlags   int               `json:"dbFlags"`
+	Timestamp float64           `json:"timestamp"` // Unix seconds the point offsets are relative to
+	Trace     []json.RawMessage `json:"trace"`
+}
+
+// Point is one decoded trace point
+type Point struct {
+	Time     time.Time
+	Lat      float64
+	Lon      float64
+	Altitude interface{} // Feet, "ground" or nil
+	Gs       interface{}
+	Track    interface{}
+	Flags    int
+	Rate     interface{} // Feet per minute, barometric unless FlagGeomRate is set
+	Details  *models.Aircraft
+	Source   string
+	AltGeom  interface{}
+	GeomRate interface{}
+	Ias      interface{}
+	Roll     interface{}
+}
+
+// ParseTrace decodes a trace file, gzip compressed or plain
+func ParseTrace(r io.Reader) (*Trace, error) {
+	br := bufio.NewReader(r)
+	var src io.Reader = br
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress trace: %w", err)
+		}
+		defer gz.Close()
+		src = gz
+	}
+
+	var trace Trace
+	if err := json.NewDecoder(src).Decode(&trace); err != nil {
+		return nil, fmt.Errorf("failed to decode trace: %w", err)
+	}
+	trace.Icao = strings.ToLower(strings.TrimPrefix(trace.Icao, "~"))
+	return &trace, nil
+}
+
+// Points decodes the compact point arrays:
+// [offset, lat, lon, altitude, gs, track, flags, rate, details, source, alt_geom, geom_rate, ias, roll]
+func (t *Trace) Points() ([]Point, error) {
+	points := make([]Point, 0, len(t.Trace))
+	for i := range t.Trace {
+		p, err := t.Point(i)
+		if err != nil {
+			return nil, err
+		}
+		points = append(points, p)
+	}
+	return points, nil
+}
+
+// Point decodes the i-th point, so a trace can be read without decoding all its points at once
+func (t *Trace) Point(i int) (Point, error) {
+	base := time.Unix(0, int64(t.Timestamp*float64(time.Second))).UTC()
+
+	var fields []json.RawMessage
+	if err := json.Unmarshal(t.Trace[i], &fields); err != nil {
+		return Point{}, fmt.Errorf("invalid trace point %d of %s: %w", i, t.Icao, err)
+	}
+	if len(fields) < 3 {
+		return Point{}, fmt.Errorf("invalid trace point %d of %s: expected at least 3 fields", i, t.Icao)
+	}
+
+	var offset float64
+	var p Point
+	if err := json.Unmarshal(fields[0], &offset); err != nil {
+		return Point{}, fmt.Errorf("invalid time of trace point %d of %s: %w", i, t.Icao, err)
+	}
+	if err := json.Unmarshal(fields[1], &p.Lat); err != nil {
+		return Point{}, fmt.Errorf("invalid latitude of trace point %d of %s: %w", i, t.Icao, err)
+	}
+	if err := json.Unmarshal(fields[2], &p.Lon); err != nil {
+		return Point{}, fmt.Errorf("invalid longitude of trace point %d of %s: %w", i, t.Icao, err)
+	}
+	p.Time = base.Add(time.Duration(math.Round(offset * float64(time.Second))))
+
+	// The remaining fields are optional and null when unknown
+	optional := []*interface{}{&p.Altitude, &p.Gs, &p.Track, nil, &p.Rate, nil, nil, &p.AltGeom, &p.GeomRate, &p.Ias, &p.Roll}
+	for j, target := range optional {
+		if target == nil || 3+j >= len(fields) {
+			continue
+		}
+		_ = json.Unmarshal(fields[3+j], target)
+	}
+	if len(fields) > 6 {
+		_ = json.Unmarshal(fields[6], &p.Flags)
+	}
+	if len(fields) > 8 && string(fields[8]) != "null" {
+		var details models.Aircraft
+		if err := json.Unmarshal(fields[8], &details); err == nil {
+			p.Details = &details
+		}
+	}
+	if len(fields) > 9 {
+		_ = json.Unmarshal(fields[9], &p.Source)
+	}
+	return p, nil
+}
+
+// Aircraft converts a point to an aircraft.json entry. details carries the most recent
+// details object of the trace, which readsb only writes when it changes.
+func (t *Trace) Aircraft(p Point, details *models.Aircraft) models.Aircraft {
+	var a models.Aircraft
+	if details != nil {
+		a = *details
+	}
+
+	a.Hex = t.Icao
+	a.Lat = p.Lat
+	a.Lon = p.Lon
+	a.Seen = 0
+	a.SeenPos = 0
+	if p.Flags&FlagGeomAltitude != 0 {
+		a.AltGeom = p.Altitude
+	} else {
+		a.AltBaro = p.Altitude
+	}
+	if p.AltGeom != nil {
+		a.AltGeom = p.AltGeom
+	}
+	if p.Gs != nil {
+		a.Gs = p.Gs
+	}
+	if track, ok := models.Float(p.Track); ok {
+		a.Track = track
+	}
+	if p.Rate != nil {
+		if p.Flags&FlagGeomRate != 0 {
+			a.GeomRate = p.Rate
+		} else {
+			a.BaroRate = p.Rate
+		}
+	}
+	if p.GeomRate != nil {
+		a.GeomRate = p.GeomRate
+	}
+	if p.Ias != nil {
+		a.Ias = p.Ias
+	}
+	if roll, ok := models.Float(p.Roll); ok {
+		a.Roll = roll
+	}
+	if p.Source != "" {
+		a.Type = p.Source
+	}
+
+	// Database fields live at the top level of the trace
+	if a.R == "" {
+		a.R = t.R
+	}
+	if a.T == "" {
+		a.T = t.T
+	}
+	if a.Desc == "" {
+		a.Desc = t.Desc
+	}
+	if a.OwnOp == "" {
+		a.OwnOp = t.OwnOp
+	}
+	if a.Year == "" {
+		a.Year = t.Year
+	}
+	if a.DbFlags == 0 {
+		a.DbFlags = t.DbFlags
+	}
+	return a
+}
@@ -0,0 +1,341 @@
+// Package bincraft decodes readsb's binCraft format, the compact binary equivalent of
+// aircraft.json that tar1090 serves as data/aircraft.binCraft and aircraft.binCraft.zst
+package bincraft
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/rknightion/adsb2loki/pkg/models"
+)
+
+const (
+	// headerSize is the minimum size of the header, which is padded to the record size
+	headerSize = 52
+
+	// recordSize is the minimum size of an aircraft record. readsb pads records to a
+	// multiple of 4 and stores the actual size in the header.
+	recordSize = 107
+)
+
+// zstdMagic starts every zstd frame
+var zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+// ErrFormat is returned when the data is not a valid binCraft snapshot
+var ErrFormat = errors.New("invalid binCraft data")
+
+// Header holds the snapshot-wide fields that precede the aircraft records
+type Header struct {
+	Now         float64 // Seconds since the epoch
+	Stride      int     // Size of the header and of each aircraft record
+	WithPos     int     // Aircraft with a position, over the whole globe for globe tiles
+	Index       int     // Globe tile index, zero for the whole receiver
+	Messages    int
+	ReceiverLat float64
+	ReceiverLon float64
+	Version     int // binCraft layout version, a date such as 20240218
+}
+
+// Enumerations, indexed by their value in the record
+var (
+	addrTypes = []string{
+		"adsb_icao", "adsb_icao_nt", "adsr_icao", "tisb_icao", "adsc", "mlat", "other",
+		"mode_s", "adsb_other", "adsr_other", "tisb_trackfile", "tisb_other", "mode_ac", "unknown",
+	}
+	emergencies = []string{"none", "general", "lifeguard", "minfuel", "nordo", "unlawful", "downed", "reserved"}
+	silTypes    = []string{"invalid", "unknown", "persample", "perhour"}
+	navModes    = []string{"autopilot", "vnav", "althold", "approach", "lnav", "tcas"}
+)
+
+// airground values
+const airGround = 1
+
+// Read decodes a binCraft snapshot, zstd compressed or plain
+func Read(r io.Reader) (*models.AutoGenerated, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read binCraft data: %w", err)
+	}
+	if bytes.HasPrefix(data, zstdMagic) {
+		if data, err = decompress(data); err != nil {
+			return nil, err
+		}
+	}
+	return Decode(data)
+}
+
+// decompress decompresses a zstd frame
+func decompress(data []byte) ([]byte, error) {
+	dec, err := zstd.NewReader(nil, zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create zstd decoder: %w", err)
+	}
+	defer dec.Close()
+
+	out, err := dec.DecodeAll(data, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress binCraft data: %w", err)
+	}
+	return out, nil
+}
+
+// Decode decodes an uncompressed binCraft snapshot into the aircraft.json model
+func Decode(data []byte) (*models.AutoGenerated, error) {
+	h, err := ParseHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	if (len(data)-h.Stride)%h.Stride != 0 {
+		return nil, fmt.Errorf("%w: %d bytes of records is not a multiple of %d", ErrFormat, len(data)-h.Stride, h.Stride)
+	}
+
+	snapshot := &models.AutoGenerated{
+		Now:      h.Now,
+		Messages: h.Messages,
+		Aircraft: make([]models.Aircraft, 0, (len(data)-h.Stride)/h.Stride),
+	}
+	for off := h.Stride; off < len(data); off += h.Stride {
+		snapshot.Aircraft = append(snapshot.Aircraft, decodeAircraft(data[off:off+h.Stride]))
+	}
+	return snapshot, nil
+}
+
+// ParseHeader decodes the header of an uncompressed binCraft snapshot
+func ParseHeader(data []byte) (Header, error) {
+	if len(data) < headerSize {
+		return Header{}, fmt.Errorf("%w: %d bytes is too short for the header", ErrFormat, len(data))
+	}
+	le := binary.LittleEndian
+	h := Header{
+		Now:         float64(le.Uint64(data[0:])) / 1000,
+		Stride:      int(le.Uint32(data[8:])),
+		WithPos:     int(le.Uint32(data[12:])),
+		Index:       int(le.Uint32(data[16:])),
+		Messages:    int(le.Uint32(data[28:])),
+		ReceiverLat: float64(int32(le.Uint32(data[32:]))) / 1e6,
+		ReceiverLon: float64(int32(le.Uint32(data[36:]))) / 1e6,
+		Version:     int(le.Uint32(data[40:])),
+	}
+	if h.Stride < recordSize || h.Stride > len(data) {
+		return Header{}, fmt.Errorf("%w: record size %d", ErrFormat, h.Stride)
+	}
+	return h, nil
+}
+
+// record reads the fields of one aircraft record
+type record []byte
+
+func (r record) u8(off int) uint8    { return r[off] }
+func (r record) u16(off int) uint16  { return binary.LittleEndian.Uint16(r[off:]) }
+func (r record) s16(off int) int16   { return int16(r.u16(off)) }
+func (r record) s32(off int) int32   { return int32(binary.LittleEndian.Uint32(r[off:])) }
+func (r record) bit(off, n int) bool { return r[off]&(1<<n) != 0 }
+
+// text reads a NUL padded string
+func (r record) text(off, n int) string {
+	s := r[off : off+n]
+	if i := bytes.IndexByte(s, 0); i >= 0 {
+		s = s[:i]
+	}
+	return string(s)
+}
+
+// Validity bits, as (byte, bit) pairs following readsb's struct binCraft
+var (
+	validCallsign    = [2]int{73, 3}
+	validAltBaro     = [2]int{73, 4}
+	validAltGeom     = [2]int{73, 5}
+	validPosition    = [2]int{73, 6}
+	validGs          = [2]int{73, 7}
+	validIas         = [2]int{74, 0}
+	validTas         = [2]int{74, 1}
+	validMach        = [2]int{74, 2}
+	validTrack       = [2]int{74, 3}
+	validTrackRate   = [2]int{74, 4}
+	validRoll        = [2]int{74, 5}
+	validMagHeading  = [2]int{74, 6}
+	validTrueHeading = [2]int{74, 7}
+	validBaroRate    = [2]int{75, 0}
+	validGeomRate    = [2]int{75, 1}
+	validNicBaro     = [2]int{75, 4}
+	validNacP        = [2]int{75, 5}
+	validNacV        = [2]int{75, 6}
+	validSil         = [2]int{75, 7}
+	validGva         = [2]int{76, 0}
+	validSda         = [2]int{76, 1}
+	validSquawk      = [2]int{76, 2}
+	validEmergency   = [2]int{76, 3}
+	validSpi         = [2]int{76, 4}
+	validNavQnh      = [2]int{76, 5}
+	validNavMcp      = [2]int{76, 6}
+	validNavFms      = [2]int{76, 7}
+	validNavHeading  = [2]int{77, 1}
+	validNavModes    = [2]int{77, 2}
+	validAlert       = [2]int{77, 3}
+	validWind        = [2]int{77, 4}
+	validTemp        = [2]int{77, 5}
+)
+
+func (r record) valid(v [2]int) bool { return r.bit(v[0], v[1]) }
+
+// decodeAircraft decodes one record, leaving out fields that readsb marks as invalid just as
+// it leaves them out of aircraft.json
+func decodeAircraft(r record) models.Aircraft {
+	addr := r.s32(0)
+	a := models.Aircraft{
+		Hex:      fmt.Sprintf("%06x", addr&0xffffff),
+		Seen:     float64(r.u16(6)) / 10,
+		Messages: int(r.u16(62)),
+		Rssi:     rssi(r.u8(105)),
+		Mlat:     []interface{}{},
+		Tisb:     []interface{}{},
+		DbFlags:  int(r.u16(86)),
+		T:        r.text(88, 4),
+		R:        r.text(92, 12),
+	}
+	if addr&(1<<24) != 0 {
+		a.Hex = "~" + a.Hex
+	}
+	if t := int(r.u8(67) >> 4); t < len(addrTypes) {
+		a.Type = addrTypes[t]
+	}
+	if c := r.u8(64); c != 0 {
+		a.Category = strings.ToUpper(strconv.FormatUint(uint64(c), 16))
+	}
+	if v := int(r.u8(69) >> 4); v != 0x0f {
+		a.Version = v
+	}
+
+	if r.valid(validCallsign) {
+		a.Flight = r.text(78, 8)
+	}
+	if r.u8(68)&0x0f == airGround {
+		a.AltBaro = models.AltitudeGround
+	} else if r.valid(validAltBaro) {
+		a.AltBaro = float64(r.s16(20)) * 25
+	}
+	if r.valid(validAltGeom) {
+		a.AltGeom = float64(r.s16(22)) * 25
+	}
+	if r.valid(validPosition) {
+		a.Lon = float64(r.s32(8)) / 1e6
+		a.Lat = float64(r.s32(12)) / 1e6
+		a.SeenPos = float64(r.u16(4)) / 10
+		a.Nic = int(r.u8(65))
+		a.Rc = int(r.u16(60))
+	}
+	if r.valid(validGs) {
+		a.Gs = float64(r.s16(34)) / 10
+	}
+	if r.valid(validIas) {
+		a.Ias = float64(r.u16(58))
+	}
+	if r.valid(validTas) {
+		a.Tas = float64(r.u16(56))
+	}
+	if r.valid(validMach) {
+		a.Mach = float64(r.s16(36)) / 1000
+	}
+	if r.valid(validTrack) {
+		a.Track = float64(r.s16(40)) / 90
+	}
+	if r.valid(validTrackRate) {
+		a.TrackRate = float64(r.s16(42)) / 100
+	}
+	if r.valid(validRoll) {
+		a.Roll = float64(r.s16(38)) / 100
+	}
+	if r.valid(validMagHeading) {
+		a.MagHeading = float64(r.s16(44)) / 90
+	}
+	if r.valid(validTrueHeading) {
+		a.TrueHeading = float64(r.s16(46)) / 90
+	}
+	if r.valid(validBaroRate) {
+		a.BaroRate = float64(r.s16(16)) * 8
+	}
+	if r.valid(validGeomRate) {
+		a.GeomRate = float64(r.s16(18)) * 8
+	}
+	if r.valid(validSquawk) {
+		a.Squawk = fmt.Sprintf("%04x", r.u16(32))
+	}
+	if r.valid(validEmergency) {
+		if e := int(r.u8(67) & 0x0f); e < len(emergencies) {
+			a.Emergency = emergencies[e]
+		}
+	}
+	if r.valid(validNavQnh) {
+		a.NavQnh = float64(r.s16(28)) / 10
+	}
+	if r.valid(validNavMcp) {
+		a.NavAltitudeMcp = float64(r.u16(24)) * 4
+	}
+	if r.valid(validNavFms) {
+		a.NavAltitudeFms = float64(r.u16(26)) * 4
+	}
+	if r.valid(validNavHeading) {
+		a.NavHeading = float64(r.s16(30)) / 90
+	}
+	if r.valid(validNavModes) {
+		a.NavModes = []string{}
+		for i, mode := range navModes {
+			if r.bit(66, i) {
+				a.NavModes = append(a.NavModes, mode)
+			}
+		}
+	}
+	if r.valid(validWind) {
+		a.Wd = float64(r.s16(48))
+		a.Ws = float64(r.s16(50))
+	}
+	if r.valid(validTemp) {
+		a.Oat = float64(r.s16(52))
+		a.Tat = float64(r.s16(54))
+	}
+
+	// Integrity and accuracy
+	if r.valid(validNicBaro) && r.bit(73, 0) {
+		a.NicBaro = 1
+	}
+	if r.valid(validNacP) {
+		a.NacP = int(r.u8(71) & 0x0f)
+	}
+	if r.valid(validNacV) {
+		a.NacV = int(r.u8(71) >> 4)
+	}
+	if r.valid(validSil) {
+		a.Sil = int(r.u8(72) & 0x03)
+		if t := int(r.u8(69) & 0x0f); t < len(silTypes) {
+			a.SilType = silTypes[t]
+		}
+	}
+	if r.valid(validGva) {
+		a.Gva = int(r.u8(72) >> 2 & 0x03)
+	}
+	if r.valid(validSda) {
+		a.Sda = int(r.u8(72) >> 4 & 0x03)
+	}
+	if r.valid(validAlert) && r.bit(73, 1) {
+		a.Alert = 1
+	}
+	if r.valid(validSpi) && r.bit(73, 2) {
+		a.Spi = 1
+	}
+
+	return a
+}
+
+// rssi converts the signal byte, the square root of the linear signal level scaled to 255, to
+// dBFS rounded to one decimal like aircraft.json
+func rssi(signal uint8) float64 {
+	level := float64(signal) * float64(signal) / 65025
+	return math.Round(10*math.Log10(level+1.125e-5)*10) / 10
+}
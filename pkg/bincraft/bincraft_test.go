@@ -0,0 +1,119 @@
+package bincraft
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/rknightion/adsb2loki/pkg/models"
+)
+
+// testdata/aircraft.binCraft.zst encodes the same snapshot as testdata/aircraft.json
+
+func readJSON(t *testing.T) *models.AutoGenerated {
+	t.Helper()
+	data, err := os.ReadFile("testdata/aircraft.json")
+	if err != nil {
+		t.Fatalf("Failed to read fixture: %v", err)
+	}
+	var snapshot models.AutoGenerated
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		t.Fatalf("Failed to decode fixture: %v", err)
+	}
+	return &snapshot
+}
+
+func readBinCraft(t *testing.T) []byte {
+	t.Helper()
+	data, err := os.ReadFile("testdata/aircraft.binCraft.zst")
+	if err != nil {
+		t.Fatalf("Failed to read fixture: %v", err)
+	}
+	return data
+}
+
+func TestReadMatchesJSON(t *testing.T) {
+	expected := readJSON(t)
+
+	got, err := Read(bytes.NewReader(readBinCraft(t)))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if got.Now != expected.Now {
+		t.Errorf("Expected now %v, got %v", expected.Now, got.Now)
+	}
+	if got.Messages != expected.Messages {
+		t.Errorf("Expected %d messages, got %d", expected.Messages, got.Messages)
+	}
+	if len(got.Aircraft) != len(expected.Aircraft) {
+		t.Fatalf("Expected %d aircraft, got %d", len(expected.Aircraft), len(got.Aircraft))
+	}
+	for i := range expected.Aircraft {
+		if !reflect.DeepEqual(got.Aircraft[i], expected.Aircraft[i]) {
+			want, _ := json.Marshal(expected.Aircraft[i])
+			have, _ := json.Marshal(got.Aircraft[i])
+			t.Errorf("Aircraft %d differs:\nexpected %s\ngot      %s", i, want, have)
+		}
+	}
+}
+
+func TestReadUncompressed(t *testing.T) {
+	raw, err := decompress(readBinCraft(t))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	h, err := ParseHeader(raw)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if h.Stride != 112 || h.Version != 20240218 || h.ReceiverLat != 51.478 {
+		t.Errorf("Unexpected header: %+v", h)
+	}
+
+	snapshot, err := Read(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(snapshot.Aircraft) != 3 {
+		t.Errorf("Expected 3 aircraft, got %d", len(snapshot.Aircraft))
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	raw, err := decompress(readBinCraft(t))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// A record size smaller than the fields read from each record
+	smallStride := bytes.Clone(raw)
+	binary.LittleEndian.PutUint32(smallStride[8:], 8)
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "empty", data: nil},
+		{name: "short header", data: raw[:20]},
+		{name: "truncated record", data: raw[:len(raw)-10]},
+		{name: "invalid stride", data: smallStride},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Decode(tt.data); !errors.Is(err, ErrFormat) {
+				t.Errorf("Expected ErrFormat, got %v", err)
+			}
+		})
+	}
+
+	if _, err := Read(bytes.NewReader(append(append([]byte{}, zstdMagic...), 0, 1, 2))); err == nil {
+		t.Error("Expected error for corrupt zstd data, got nil")
+	}
+}
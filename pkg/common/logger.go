@@ -2,6 +2,7 @@ package common
 
 import (
 	"context"
+	"errors"
 	"time"
 )
 
@@ -13,7 +14,25 @@ type LogEntry struct {
 	StructuredMetadata map[string]string // Optional structured metadata
 }
 
+// PushTestSource is the source label of the synthetic entry of the push-test command. Sinks that
+// store entries check their connection instead, so the entry doesn't end up in real data.
+const PushTestSource = "push-test"
+
 // Logger interface that can be implemented by different backends
 type Logger interface {
 	PushLogs(ctx context.Context, entries []LogEntry) error
 }
+
+// MultiLogger pushes entries to every logger in turn, returning the errors of those that failed
+type MultiLogger []Logger
+
+// PushLogs pushes the entries to all loggers, even if an earlier one fails
+func (m MultiLogger) PushLogs(ctx context.Context, entries []LogEntry) error {
+	var errs []error
+	for _, logger := range m {
+		if err := logger.PushLogs(ctx, entries); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
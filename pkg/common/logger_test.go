@@ -1,6 +1,8 @@
 package common
 
 import (
+	"context"
+	"errors"
 	"testing"
 	"time"
 )
@@ -35,3 +37,27 @@ func TestLogEntry(t *testing.T) {
 		t.Errorf("Expected line '%s', got %s", expectedLine, entry.Line)
 	}
 }
+
+type countingLogger struct {
+	pushed int
+	err    error
+}
+
+func (l *countingLogger) PushLogs(_ context.Context, entries []LogEntry) error {
+	l.pushed += len(entries)
+	return l.err
+}
+
+func TestMultiLogger(t *testing.T) {
+	failure := errors.New("sink down")
+	first := &countingLogger{err: failure}
+	second := &countingLogger{}
+
+	err := MultiLogger{first, second}.PushLogs(context.Background(), []LogEntry{{Line: "a"}, {Line: "b"}})
+	if !errors.Is(err, failure) {
+		t.Errorf("Expected the failing logger's error, got %v", err)
+	}
+	if first.pushed != 2 || second.pushed != 2 {
+		t.Errorf("Expected every logger to receive both entries, got %d and %d", first.pushed, second.pushed)
+	}
+}
@@ -0,0 +1,51 @@
+package common
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// StatusError is returned when a backend rejects an HTTP request
+type StatusError struct {
+	Backend    string // Name of the backend in the message, e.g. loki
+	StatusCode int
+	Message    string
+	RetryAfter time.Duration // Zero if the backend didn't ask for a delay
+}
+
+// NewStatusError reads the status, the start of the body and the Retry-After header of a
+// rejected response
+func NewStatusError(backend string, resp *http.Response) *StatusError {
+	message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return &StatusError{
+		Backend:    backend,
+		StatusCode: resp.StatusCode,
+		Message:    strings.TrimSpace(string(message)),
+		RetryAfter: retryAfter(resp.Header.Get("Retry-After")),
+	}
+}
+
+func (e *StatusError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("%s returned status %d", e.Backend, e.StatusCode)
+	}
+	return fmt.Sprintf("%s returned status %d: %s", e.Backend, e.StatusCode, e.Message)
+}
+
+// Retryable reports whether the request may succeed later, i.e. rate limiting or a server error
+func (e *StatusError) Retryable() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
+
+// retryAfter parses a Retry-After header given in seconds
+func retryAfter(header string) time.Duration {
+	seconds, err := strconv.Atoi(strings.TrimSpace(header))
+	if err != nil || seconds < 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
@@ -0,0 +1,46 @@
+package common
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNewStatusError(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		retryAfter string
+		body       string
+		want       string
+		wantDelay  time.Duration
+		retryable  bool
+	}{
+		{name: "rate limited", status: http.StatusTooManyRequests, retryAfter: "3", want: "loki returned status 429", wantDelay: 3 * time.Second, retryable: true},
+		{name: "server error", status: http.StatusBadGateway, retryAfter: "Wed, 21 Oct 2015 07:28:00 GMT", body: "upstream down\n", want: "loki returned status 502: upstream down", retryable: true},
+		{name: "bad request", status: http.StatusBadRequest, retryAfter: "-1", body: "entry too far behind", want: "loki returned status 400: entry too far behind"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			if tt.retryAfter != "" {
+				rec.Header().Set("Retry-After", tt.retryAfter)
+			}
+			rec.WriteHeader(tt.status)
+			rec.WriteString(tt.body)
+
+			err := NewStatusError("loki", rec.Result())
+			if err.Error() != tt.want {
+				t.Errorf("Expected %q, got %q", tt.want, err.Error())
+			}
+			if err.RetryAfter != tt.wantDelay {
+				t.Errorf("Expected a delay of %v, got %v", tt.wantDelay, err.RetryAfter)
+			}
+			if err.Retryable() != tt.retryable {
+				t.Errorf("Expected retryable %v, got %v", tt.retryable, err.Retryable())
+			}
+		})
+	}
+}
@@ -0,0 +1,384 @@
+// Package elastic indexes log entries into Elasticsearch or OpenSearch with the _bulk API,
+// one index per day
+package elastic
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rknightion/adsb2loki/pkg/common"
+	"github.com/rknightion/adsb2loki/pkg/models"
+)
+
+// DefaultIndexPrefix is the prefix of the daily indices, e.g. adsb-2025.05.24
+const DefaultIndexPrefix = "adsb"
+
+// DefaultBatchSize is the number of documents per _bulk request
+const DefaultBatchSize = 1000
+
+// Config configures the Elasticsearch sink
+type Config struct {
+	URL      string // Base URL of the cluster
+	Username string // Optional, for basic authentication
+	Password string
+	APIKey   string // Optional, the encoded API key, instead of a username and password
+
+	IndexPrefix string
+	Template    bool // Install the index template before the first push
+
+	BatchSize          int
+	MaxRetries         int           // Retries of network errors, 429/5xx responses and rejected documents
+	Backoff            time.Duration // Initial delay between retries, doubled after each attempt
+	RetryTime          time.Duration // Time after which a batch isn't retried anymore, zero for no limit
+	InsecureSkipVerify bool
+}
+
+// Client indexes every entry as a document of the index of its day
+type Client struct {
+	url         string
+	username    string
+	password    string
+	apiKey      string
+	indexPrefix string
+	batchSize   int
+	maxRetries  int
+	backoff     time.Duration
+	retryTime   time.Duration
+	client      *http.Client
+
+	mu        sync.Mutex
+	installed bool // Whether the index template is installed, or doesn't need to be
+}
+
+// NewClient creates a client. Nothing is sent until the first push.
+func NewClient(cfg Config) (*Client, error) {
+	if cfg.URL == "" {
+		return nil, errors.New("Elasticsearch URL is required")
+	}
+	c := &Client{
+		url:         strings.TrimSuffix(cfg.URL, "/"),
+		username:    cfg.Username,
+		password:    cfg.Password,
+		apiKey:      cfg.APIKey,
+		indexPrefix: cfg.IndexPrefix,
+		batchSize:   cfg.BatchSize,
+		maxRetries:  cfg.MaxRetries,
+		backoff:     cfg.Backoff,
+		retryTime:   cfg.RetryTime,
+		installed:   !cfg.Template,
+		client:      &http.Client{Timeout: 30 * time.Second},
+	}
+	if c.indexPrefix == "" {
+		c.indexPrefix = DefaultIndexPrefix
+	}
+	if c.batchSize <= 0 {
+		c.batchSize = DefaultBatchSize
+	}
+	if c.backoff <= 0 {
+		c.backoff = time.Second
+	}
+	if cfg.InsecureSkipVerify {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+		c.client.Transport = transport
+	}
+	return c, nil
+}
+
+// PushLogs indexes the entries in batches. Documents rejected with 429 or 5xx are retried on
+// their own, documents rejected for good, e.g. by a mapping conflict, are reported in the error.
+// A push-test entry isn't indexed, the cluster is checked with GET / instead.
+func (c *Client) PushLogs(ctx context.Context, entries []common.LogEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	if err := c.installTemplate(ctx); err != nil {
+		return err
+	}
+
+	docs := make([]document, 0, len(entries))
+	for _, entry := range entries {
+		if entry.Labels["source"] == common.PushTestSource {
+			if _, err := c.do(ctx, http.MethodGet, "/", "application/json", nil); err != nil {
+				return err
+			}
+			continue
+		}
+		doc, err := c.document(entry)
+		if err != nil {
+			return err
+		}
+		docs = append(docs, doc)
+	}
+
+	var errs []error
+	for start := 0; start < len(docs); start += c.batchSize {
+		if err := c.index(ctx, docs[start:min(start+c.batchSize, len(docs))]); err != nil {
+			if ctx.Err() != nil {
+				return err
+			}
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// document is one entry, encoded with its _bulk action
+type document struct {
+	index string
+	body  []byte
+}
+
+// document converts an entry to a document: the fields of its JSON line, @timestamp, its labels
+// and structured metadata under labels, and location as a geo_point when it has a position
+func (c *Client) document(entry common.LogEntry) (document, error) {
+	fields := make(map[string]interface{})
+	dec := json.NewDecoder(strings.NewReader(entry.Line))
+	dec.UseNumber()
+	if err := dec.Decode(&fields); err != nil {
+		fields = map[string]interface{}{"message": entry.Line}
+	}
+
+	// The template maps alt_baro as a float, which would reject the whole document for "ground"
+	if fields["alt_baro"] == models.AltitudeGround {
+		delete(fields, "alt_baro")
+		fields["on_ground"] = true
+	}
+	// Maps and geo queries need a single geo_point rather than two numbers. The object form is used
+	// since the array form is [lon, lat], easy to get backwards. lat and lon stay as numbers for
+	// range queries.
+	lat, latOK := fields["lat"].(json.Number)
+	lon, lonOK := fields["lon"].(json.Number)
+	if latOK && lonOK {
+		fields["location"] = map[string]json.Number{"lat": lat, "lon": lon}
+	}
+
+	labels := make(map[string]string, len(entry.Labels)+len(entry.StructuredMetadata))
+	for k, v := range entry.Labels {
+		labels[k] = v
+	}
+	for k, v := range entry.StructuredMetadata {
+		labels[k] = strings.TrimSpace(v)
+	}
+	fields["labels"] = labels
+	fields["@timestamp"] = entry.Timestamp.UTC().Format(time.RFC3339Nano)
+
+	body, err := json.Marshal(fields)
+	if err != nil {
+		return document{}, fmt.Errorf("failed to marshal document: %w", err)
+	}
+	return document{index: c.Index(entry.Timestamp), body: body}, nil
+}
+
+// Index returns the daily index of a timestamp, by UTC date
+func (c *Client) Index(ts time.Time) string {
+	return c.indexPrefix + "-" + ts.UTC().Format("2006.01.02")
+}
+
+// index sends a batch, then retries the documents rejected with 429 or 5xx until none are left
+// or the retries or the retry time are exhausted
+func (c *Client) index(ctx context.Context, docs []document) error {
+	backoff := c.backoff
+	start := time.Now()
+	var rejected []error
+	for attempt := 0; ; attempt++ {
+		retry, failed, err := c.bulk(ctx, docs)
+		rejected = append(rejected, failed...)
+		var statusErr *common.StatusError
+		if err != nil {
+			if errors.As(err, &statusErr) && !statusErr.Retryable() {
+				return err
+			}
+		} else if len(retry) == 0 {
+			break
+		} else {
+			docs = retry
+		}
+
+		delay := backoff
+		if statusErr != nil && statusErr.RetryAfter > 0 {
+			delay = statusErr.RetryAfter
+		}
+		outOfTime := c.retryTime > 0 && time.Since(start)+delay > c.retryTime
+		if attempt >= c.maxRetries || outOfTime {
+			if err != nil {
+				if outOfTime {
+					return fmt.Errorf("gave up retrying after %v: %w", time.Since(start).Round(time.Millisecond), err)
+				}
+				return err
+			}
+			for _, doc := range docs {
+				rejected = append(rejected, fmt.Errorf("%s: still rejected after %d retries", doc.index, attempt))
+			}
+			break
+		}
+
+		select {
+		case <-time.After(delay):
+			backoff *= 2
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if len(rejected) > 0 {
+		return fmt.Errorf("%d documents rejected, first: %w", len(rejected), rejected[0])
+	}
+	return nil
+}
+
+// bulkResponse is the part of a _bulk response describing each item
+type bulkResponse struct {
+	Errors bool `json:"errors"`
+	Items  []map[string]struct {
+		Status int `json:"status"`
+		Error  *struct {
+			Type   string `json:"type"`
+			Reason string `json:"reason"`
+		} `json:"error"`
+	} `json:"items"`
+}
+
+// bulk sends one _bulk request. It returns the documents to retry, the errors of the documents
+// rejected for good, and an error if the request as a whole failed.
+func (c *Client) bulk(ctx context.Context, docs []document) (retry []document, rejected []error, err error) {
+	var body bytes.Buffer
+	for _, doc := range docs {
+		action, err := json.Marshal(map[string]map[string]string{"index": {"_index": doc.index}})
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to marshal bulk action: %w", err)
+		}
+		body.Write(action)
+		body.WriteByte('\n')
+		body.Write(doc.body)
+		body.WriteByte('\n')
+	}
+
+	respBody, err := c.do(ctx, http.MethodPost, "/_bulk", "application/x-ndjson", body.Bytes())
+	if err != nil {
+		return nil, nil, err
+	}
+	var resp bulkResponse
+	if err := json.Unmarshal(respBody, &resp); err != nil {
+		return nil, nil, fmt.Errorf("failed to decode bulk response: %w", err)
+	}
+	if !resp.Errors {
+		return nil, nil, nil
+	}
+	if len(resp.Items) != len(docs) {
+		return nil, nil, fmt.Errorf("bulk response has %d items for %d documents", len(resp.Items), len(docs))
+	}
+
+	for i, item := range resp.Items {
+		for _, result := range item {
+			if result.Error == nil {
+				continue
+			}
+			if result.Status == http.StatusTooManyRequests || result.Status >= 500 {
+				retry = append(retry, docs[i])
+				continue
+			}
+			rejected = append(rejected, fmt.Errorf("%s: %s: %s", docs[i].index, result.Error.Type, result.Error.Reason))
+		}
+	}
+	return retry, rejected, nil
+}
+
+// installTemplate installs the index template once, so lat/lon are mapped as a geo_point and
+// numeric fields aren't mapped from whichever value comes first
+func (c *Client) installTemplate(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.installed {
+		return nil
+	}
+
+	body, err := json.Marshal(Template(c.indexPrefix))
+	if err != nil {
+		return fmt.Errorf("failed to marshal index template: %w", err)
+	}
+	if _, err := c.do(ctx, http.MethodPut, "/_index_template/"+c.indexPrefix, "application/json", body); err != nil {
+		return fmt.Errorf("failed to install index template: %w", err)
+	}
+	c.installed = true
+	return nil
+}
+
+// Template returns the composable index template of the indices with the given prefix
+func Template(prefix string) map[string]interface{} {
+	properties := map[string]interface{}{
+		"@timestamp": map[string]string{"type": "date"},
+		"location":   map[string]string{"type": "geo_point"},
+		"lat":        map[string]string{"type": "double"},
+		"lon":        map[string]string{"type": "double"},
+		"on_ground":  map[string]string{"type": "boolean"},
+		"messages":   map[string]string{"type": "long"},
+	}
+	for _, field := range []string{
+		"alt_baro", "alt_geom", "gs", "ias", "tas", "mach", "track", "track_rate", "roll", "mag_heading", "true_heading",
+		"baro_rate", "geom_rate", "nav_qnh", "nav_altitude_mcp", "nav_heading", "seen", "seen_pos", "rssi", "r_dst", "r_dir",
+		"altitude",
+	} {
+		properties[field] = map[string]string{"type": "float"}
+	}
+	for _, field := range []string{"nic", "rc", "version", "nic_baro", "nac_p", "nac_v", "sil", "gva", "sda"} {
+		properties[field] = map[string]string{"type": "integer"}
+	}
+	for _, field := range []string{"hex", "flight", "squawk", "category", "emergency", "type", "r", "t", "receiver", "event"} {
+		properties[field] = map[string]string{"type": "keyword"}
+	}
+
+	return map[string]interface{}{
+		"index_patterns": []string{prefix + "-*"},
+		"priority":       100,
+		"template": map[string]interface{}{
+			"mappings": map[string]interface{}{
+				"dynamic_templates": []map[string]interface{}{
+					{"labels": map[string]interface{}{"path_match": "labels.*", "mapping": map[string]string{"type": "keyword"}}},
+					{"strings": map[string]interface{}{
+						"match_mapping_type": "string",
+						"mapping":            map[string]interface{}{"type": "keyword", "ignore_above": 256},
+					}},
+				},
+				"properties": properties,
+			},
+		},
+	}
+}
+
+// do sends a request and returns the body of a successful response
+func (c *Client) do(ctx context.Context, method, path, contentType string, body []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.url+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "ApiKey "+c.apiKey)
+	} else if c.username != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, common.NewStatusError("elasticsearch", resp)
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	return respBody, nil
+}
@@ -0,0 +1,327 @@
+package elastic
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rknightion/adsb2loki/pkg/common"
+)
+
+// bulkItem is a document received by the fake _bulk handler
+type bulkItem struct {
+	Index string
+	Doc   map[string]interface{}
+}
+
+// fakeCluster serves _bulk and _index_template. reject decides the status of each item of a
+// request, 0 or 201 accepting it.
+type fakeCluster struct {
+	mu        sync.Mutex
+	template  map[string]interface{}
+	requests  [][]bulkItem
+	indexed   []bulkItem
+	reject    func(request int, item bulkItem) int
+	bulkError int // Fails whole _bulk requests with this status while non-zero
+	auth      string
+}
+
+func (f *fakeCluster) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.auth = r.Header.Get("Authorization")
+
+	switch {
+	case r.Method == http.MethodPut && strings.HasPrefix(r.URL.Path, "/_index_template/"):
+		if err := json.NewDecoder(r.Body).Decode(&f.template); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		fmt.Fprint(w, `{"acknowledged":true}`)
+	case r.Method == http.MethodPost && r.URL.Path == "/_bulk":
+		if r.Header.Get("Content-Type") != "application/x-ndjson" {
+			http.Error(w, "wrong content type", http.StatusNotAcceptable)
+			return
+		}
+		if f.bulkError != 0 {
+			w.WriteHeader(f.bulkError)
+			f.bulkError = 0
+			return
+		}
+
+		var items []bulkItem
+		scanner := bufio.NewScanner(r.Body)
+		scanner.Buffer(nil, 1<<20)
+		for scanner.Scan() {
+			var action map[string]struct {
+				Index string `json:"_index"`
+			}
+			if err := json.Unmarshal(scanner.Bytes(), &action); err != nil || !scanner.Scan() {
+				http.Error(w, "invalid action", http.StatusBadRequest)
+				return
+			}
+			item := bulkItem{Index: action["index"].Index}
+			if err := json.Unmarshal(scanner.Bytes(), &item.Doc); err != nil {
+				http.Error(w, "invalid document", http.StatusBadRequest)
+				return
+			}
+			items = append(items, item)
+		}
+		f.requests = append(f.requests, items)
+
+		resp := map[string]interface{}{"took": 1, "errors": false}
+		var results []map[string]interface{}
+		for _, item := range items {
+			status := http.StatusCreated
+			if f.reject != nil {
+				if s := f.reject(len(f.requests)-1, item); s != 0 {
+					status = s
+				}
+			}
+			result := map[string]interface{}{"_index": item.Index, "status": status}
+			if status == http.StatusCreated {
+				f.indexed = append(f.indexed, item)
+			} else {
+				resp["errors"] = true
+				result["error"] = map[string]string{"type": "rejected", "reason": fmt.Sprintf("status %d", status)}
+			}
+			results = append(results, map[string]interface{}{"index": result})
+		}
+		resp["items"] = results
+		_ = json.NewEncoder(w).Encode(resp)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestPushLogs(t *testing.T) {
+	cluster := &fakeCluster{}
+	server := httptest.NewServer(cluster)
+	defer server.Close()
+
+	c, err := NewClient(Config{URL: server.URL + "/", Username: "adsb", Password: "secret", Template: true, BatchSize: 2})
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	midnight := time.Date(2025, 5, 24, 23, 59, 59, 0, time.UTC)
+	entries := []common.LogEntry{
+		{
+			Timestamp:          midnight,
+			Labels:             map[string]string{"app": "flightaware"},
+			Line:               `{"hex":"4ca614","alt_baro":38000,"gs":451.2,"lat":51.47,"lon":-0.4543}`,
+			StructuredMetadata: map[string]string{"hex": "4ca614", "flight": "EIN581  "},
+		},
+		{
+			Timestamp:          midnight,
+			Labels:             map[string]string{"app": "flightaware"},
+			Line:               `{"hex":"43c6f1","alt_baro":"ground"}`,
+			StructuredMetadata: map[string]string{"hex": "43c6f1"},
+		},
+		{
+			Timestamp:          midnight.Add(2 * time.Second),
+			Labels:             map[string]string{"app": "flightaware", "event": "lost"},
+			Line:               `{"event":"lost","hex":"4ca614"}`,
+			StructuredMetadata: map[string]string{"hex": "4ca614"},
+		},
+	}
+	if err := c.PushLogs(context.Background(), entries); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := c.PushLogs(context.Background(), entries[:1]); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// The template maps the position as a geo_point and types the numeric fields
+	mappings := cluster.template["template"].(map[string]interface{})["mappings"].(map[string]interface{})
+	properties := mappings["properties"].(map[string]interface{})
+	for field, want := range map[string]string{"location": "geo_point", "alt_baro": "float", "rssi": "float", "messages": "long", "hex": "keyword"} {
+		if got := properties[field].(map[string]interface{})["type"]; got != want {
+			t.Errorf("Expected %s to be mapped as %s, got %v", field, want, got)
+		}
+	}
+	if patterns := cluster.template["index_patterns"].([]interface{}); patterns[0] != "adsb-*" {
+		t.Errorf("Unexpected index patterns %v", patterns)
+	}
+	if !strings.HasPrefix(cluster.auth, "Basic ") {
+		t.Errorf("Expected basic authentication, got %q", cluster.auth)
+	}
+
+	// Batches of 2, then the second push
+	if len(cluster.requests) != 3 || len(cluster.indexed) != 4 {
+		t.Fatalf("Expected 4 documents in 3 requests, got %d in %d", len(cluster.indexed), len(cluster.requests))
+	}
+	first := cluster.indexed[0]
+	if first.Index != "adsb-2025.05.24" {
+		t.Errorf("Expected the daily index, got %s", first.Index)
+	}
+	location, _ := first.Doc["location"].(map[string]interface{})
+	if location["lat"] != 51.47 || location["lon"] != -0.4543 {
+		t.Errorf("Expected the location, got %v", first.Doc["location"])
+	}
+	if first.Doc["@timestamp"] != "2025-05-24T23:59:59Z" {
+		t.Errorf("Unexpected timestamp %v", first.Doc["@timestamp"])
+	}
+	if labels := first.Doc["labels"].(map[string]interface{}); labels["app"] != "flightaware" || labels["flight"] != "EIN581" {
+		t.Errorf("Unexpected labels %v", labels)
+	}
+	if ground := cluster.indexed[1].Doc; ground["on_ground"] != true || ground["alt_baro"] != nil {
+		t.Errorf("Expected on_ground instead of alt_baro, got %v", ground)
+	}
+	if lost := cluster.indexed[2]; lost.Index != "adsb-2025.05.25" || lost.Doc["event"] != "lost" {
+		t.Errorf("Expected the lost event in the next day's index, got %+v", lost)
+	}
+}
+
+func TestPushLogsPartialFailure(t *testing.T) {
+	cluster := &fakeCluster{
+		// The first request rejects one document for good and one temporarily
+		reject: func(request int, item bulkItem) int {
+			if request > 0 {
+				return 0
+			}
+			switch item.Doc["hex"] {
+			case "000002":
+				return http.StatusTooManyRequests
+			case "000003":
+				return http.StatusBadRequest
+			}
+			return 0
+		},
+	}
+	server := httptest.NewServer(cluster)
+	defer server.Close()
+
+	c, err := NewClient(Config{URL: server.URL, MaxRetries: 2, Backoff: time.Millisecond})
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	var entries []common.LogEntry
+	for i := range 4 {
+		hex := fmt.Sprintf("%06x", i)
+		entries = append(entries, common.LogEntry{Timestamp: time.Now(), Line: `{"hex":"` + hex + `"}`, StructuredMetadata: map[string]string{"hex": hex}})
+	}
+	err = c.PushLogs(context.Background(), entries)
+	if err == nil || !strings.Contains(err.Error(), "1 documents rejected") || !strings.Contains(err.Error(), "status 400") {
+		t.Errorf("Expected the permanently rejected document to be reported, got %v", err)
+	}
+
+	// Only the temporarily rejected document is sent again
+	if len(cluster.requests) != 2 || len(cluster.requests[1]) != 1 || cluster.requests[1][0].Doc["hex"] != "000002" {
+		t.Fatalf("Expected a retry of 000002 only, got %+v", cluster.requests)
+	}
+	if len(cluster.indexed) != 3 {
+		t.Errorf("Expected 3 indexed documents, got %d", len(cluster.indexed))
+	}
+	if cluster.template != nil {
+		t.Error("Expected no template to be installed when disabled")
+	}
+}
+
+func TestPushLogsRetries(t *testing.T) {
+	tests := []struct {
+		name      string
+		bulkError int
+		reject    func(int, bulkItem) int
+		retries   int
+		retryTime time.Duration
+		wantErr   string
+		requests  int
+	}{
+		{name: "server error", bulkError: http.StatusServiceUnavailable, retries: 1, requests: 1},
+		{name: "invalid request", bulkError: http.StatusBadRequest, retries: 3, wantErr: "status 400", requests: 0},
+		{
+			name:     "retries exhausted",
+			reject:   func(int, bulkItem) int { return http.StatusServiceUnavailable },
+			retries:  2,
+			wantErr:  "still rejected after 2 retries",
+			requests: 3,
+		},
+		{
+			name:      "out of time",
+			reject:    func(int, bulkItem) int { return http.StatusServiceUnavailable },
+			retries:   2,
+			retryTime: time.Nanosecond,
+			wantErr:   "still rejected after 0 retries",
+			requests:  1,
+		},
+		{name: "out of time on errors", bulkError: http.StatusServiceUnavailable, retries: 1, retryTime: time.Nanosecond, wantErr: "gave up retrying", requests: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cluster := &fakeCluster{bulkError: tt.bulkError, reject: tt.reject}
+			server := httptest.NewServer(cluster)
+			defer server.Close()
+
+			c, err := NewClient(Config{URL: server.URL, APIKey: "key", MaxRetries: tt.retries, Backoff: time.Millisecond, RetryTime: tt.retryTime})
+			if err != nil {
+				t.Fatalf("Failed to create client: %v", err)
+			}
+			entry := common.LogEntry{Timestamp: time.Now(), Line: `{"hex":"4ca614"}`, StructuredMetadata: map[string]string{"hex": "4ca614"}}
+			err = c.PushLogs(context.Background(), []common.LogEntry{entry})
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("Expected error containing %q, got %v", tt.wantErr, err)
+			}
+			if len(cluster.requests) != tt.requests {
+				t.Errorf("Expected %d bulk requests to be processed, got %d", tt.requests, len(cluster.requests))
+			}
+			if cluster.auth != "ApiKey key" {
+				t.Errorf("Expected the API key, got %q", cluster.auth)
+			}
+		})
+	}
+}
+
+func TestPushLogsTemplateFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error":"security_exception"}`, http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	c, err := NewClient(Config{URL: server.URL, Template: true})
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	err = c.PushLogs(context.Background(), []common.LogEntry{{Timestamp: time.Now(), Line: `{}`, StructuredMetadata: map[string]string{"hex": "4ca614"}}})
+	if err == nil || !strings.Contains(err.Error(), "failed to install index template") {
+		t.Errorf("Expected the template error, got %v", err)
+	}
+}
+
+func TestPushLogsPushTest(t *testing.T) {
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.Method+" "+r.URL.Path)
+		w.Write([]byte(`{"version":{"number":"8.14.0"}}`))
+	}))
+	defer server.Close()
+
+	c, err := NewClient(Config{URL: server.URL})
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	entry := common.LogEntry{
+		Timestamp:          time.Now(),
+		Labels:             map[string]string{"app": "flightaware", "source": common.PushTestSource},
+		Line:               `{"hex":"000000"}`,
+		StructuredMetadata: map[string]string{"hex": "000000"},
+	}
+	if err := c.PushLogs(context.Background(), []common.LogEntry{entry}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(paths) != 1 || paths[0] != "GET /" {
+		t.Errorf("Expected the cluster to be checked instead of indexed, got %v", paths)
+	}
+}
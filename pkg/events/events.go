@@ -0,0 +1,307 @@
+package events
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rknightion/adsb2loki/pkg/geo"
+	"github.com/rknightion/adsb2loki/pkg/models"
+)
+
+// Type identifies a lifecycle event
+type Type string
+
+const (
+	Appeared    Type = "appeared"
+	Lost        Type = "lost"
+	Takeoff     Type = "takeoff"
+	Landing     Type = "landing"
+	PhaseChange Type = "phase_change"
+	GoAround    Type = "go_around"
+)
+
+// Phase is the vertical flight phase of an aircraft
+type Phase string
+
+const (
+	PhaseUnknown Phase = ""
+	PhaseGround  Phase = "ground"
+	PhaseClimb   Phase = "climb"
+	PhaseLevel   Phase = "level"
+	PhaseDescent Phase = "descent"
+)
+
+const (
+	// DefaultLostTimeout is how long an aircraft can go unseen before it is reported lost
+	DefaultLostTimeout = time.Minute
+
+	// DefaultAirportRadius is the radius around an airport used when none is configured, in nautical miles
+	DefaultAirportRadius = 5.0
+
+	// climbRate and descentRate are the vertical rates in feet per minute at which an aircraft
+	// enters the climb and descent phases
+	climbRate   = 500.0
+	descentRate = -500.0
+
+	// holdRate is the smaller rate an aircraft has to drop below before it leaves a climb or
+	// descent, so a rate hovering around the boundary doesn't flap between phases
+	holdRate = 300.0
+
+	// approachCeiling is the altitude in feet below which an aircraft near an airport counts as on approach
+	approachCeiling = 3000.0
+)
+
+// Event is a discrete change in the state of an aircraft
+type Event struct {
+	Type          Type      `json:"event"`
+	Time          time.Time `json:"time"`
+	Hex           string    `json:"hex"`
+	Flight        string    `json:"flight,omitempty"`
+	Phase         Phase     `json:"phase,omitempty"`
+	PreviousPhase Phase     `json:"previous_phase,omitempty"`
+	Airport       string    `json:"airport,omitempty"`
+	Altitude      *float64  `json:"altitude,omitempty"`
+	Lat           float64   `json:"lat,omitempty"`
+	Lon           float64   `json:"lon,omitempty"`
+}
+
+// Airport is a location used to attribute takeoffs, landings and go-arounds
+type Airport struct {
+	Code   string
+	Lat    float64
+	Lon    float64
+	Radius float64 // Nautical miles
+}
+
+// ParseAirports parses a comma separated list of CODE:LAT:LON[:RADIUS_NM] airports
+func ParseAirports(s string) ([]Airport, error) {
+	var airports []Airport
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		parts := strings.Split(item, ":")
+		if len(parts) != 3 && len(parts) != 4 {
+			return nil, fmt.Errorf("invalid airport %q: expected CODE:LAT:LON[:RADIUS_NM]", item)
+		}
+
+		airport := Airport{Code: strings.ToUpper(parts[0]), Radius: DefaultAirportRadius}
+		var err error
+		if airport.Lat, err = strconv.ParseFloat(parts[1], 64); err != nil {
+			return nil, fmt.Errorf("invalid latitude for airport %s: %w", airport.Code, err)
+		}
+		if airport.Lon, err = strconv.ParseFloat(parts[2], 64); err != nil {
+			return nil, fmt.Errorf("invalid longitude for airport %s: %w", airport.Code, err)
+		}
+		if len(parts) == 4 {
+			if airport.Radius, err = strconv.ParseFloat(parts[3], 64); err != nil {
+				return nil, fmt.Errorf("invalid radius for airport %s: %w", airport.Code, err)
+			}
+		}
+
+		airports = append(airports, airport)
+	}
+	return airports, nil
+}
+
+// state is what the detector remembers about an aircraft between snapshots
+type state struct {
+	hex         string
+	flight      string
+	lastSeen    time.Time
+	onGround    bool
+	hasGround   bool
+	phase       Phase
+	approach    string // Airport code while on approach, cleared on landing or go-around
+	lat, lon    float64
+	altitude    float64
+	hasAltitude bool
+}
+
+// Detector derives lifecycle events from successive aircraft snapshots keyed by hex
+type Detector struct {
+	mu          sync.Mutex
+	lostTimeout time.Duration
+	airports    []Airport
+	states      map[string]*state
+}
+
+// NewDetector creates a new event detector. A lost timeout of zero uses DefaultLostTimeout.
+func NewDetector(lostTimeout time.Duration, airports []Airport) *Detector {
+	if lostTimeout <= 0 {
+		lostTimeout = DefaultLostTimeout
+	}
+	return &Detector{
+		lostTimeout: lostTimeout,
+		airports:    airports,
+		states:      make(map[string]*state),
+	}
+}
+
+// Observe records a sighting of an aircraft and returns any events it triggered
+func (d *Detector) Observe(aircraft *models.Aircraft, ts time.Time) []Event {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	hex := strings.ToLower(aircraft.Hex)
+	st, known := d.states[hex]
+	if !known {
+		st = &state{hex: hex}
+		d.states[hex] = st
+	}
+
+	if callsign := aircraft.Callsign(); callsign != "" {
+		st.flight = callsign
+	}
+	st.lastSeen = ts
+	if aircraft.HasPosition() {
+		st.lat, st.lon = aircraft.Lat, aircraft.Lon
+	}
+	if alt, ok := aircraft.Altitude(); ok {
+		st.altitude, st.hasAltitude = alt, true
+	}
+
+	var events []Event
+	if !known {
+		st.phase = phaseOf(aircraft, PhaseUnknown)
+		events = append(events, st.event(Appeared, ts))
+	}
+
+	// Airborne <-> ground transitions, only once the previous state is known
+	if aircraft.AltBaro != nil {
+		onGround := aircraft.OnGround()
+		if st.hasGround && onGround != st.onGround {
+			airport := d.nearestAirport(st.lat, st.lon)
+			var e Event
+			if onGround {
+				e = st.event(Landing, ts)
+				st.approach = ""
+			} else {
+				e = st.event(Takeoff, ts)
+			}
+			if airport != nil {
+				e.Airport = airport.Code
+			}
+			events = append(events, e)
+		}
+		st.onGround, st.hasGround = onGround, true
+	}
+
+	// Climb/level/descent phase changes
+	if known {
+		if phase := phaseOf(aircraft, st.phase); phase != PhaseUnknown && phase != st.phase {
+			previous := st.phase
+			st.phase = phase
+			if previous != PhaseUnknown && previous != PhaseGround && phase != PhaseGround {
+				e := st.event(PhaseChange, ts)
+				e.PreviousPhase = previous
+				events = append(events, e)
+			}
+		}
+	}
+
+	// Go-arounds: descending on approach to an airport, then climbing away without landing
+	if airport := d.nearestAirport(st.lat, st.lon); airport != nil && st.hasAltitude && !st.onGround {
+		switch {
+		case st.phase == PhaseDescent && st.altitude < approachCeiling:
+			st.approach = airport.Code
+		case st.phase == PhaseClimb && st.approach == airport.Code:
+			e := st.event(GoAround, ts)
+			e.Airport = airport.Code
+			events = append(events, e)
+			st.approach = ""
+		}
+	}
+
+	return events
+}
+
+// Expire forgets aircraft that have not been seen within the lost timeout and returns a lost event for each
+func (d *Detector) Expire(now time.Time) []Event {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var events []Event
+	for hex, st := range d.states {
+		if now.Sub(st.lastSeen) <= d.lostTimeout {
+			continue
+		}
+
+		events = append(events, st.event(Lost, now))
+		delete(d.states, hex)
+	}
+
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].Hex < events[j].Hex
+	})
+	return events
+}
+
+// event builds an event of the given type from the last known state
+func (st *state) event(t Type, ts time.Time) Event {
+	e := Event{
+		Type:   t,
+		Time:   ts,
+		Hex:    st.hex,
+		Flight: st.flight,
+		Phase:  st.phase,
+		Lat:    st.lat,
+		Lon:    st.lon,
+	}
+	if st.hasAltitude {
+		alt := st.altitude
+		e.Altitude = &alt
+	}
+	return e
+}
+
+// nearestAirport returns the closest configured airport containing the position, if any
+func (d *Detector) nearestAirport(lat, lon float64) *Airport {
+	if lat == 0 && lon == 0 {
+		return nil
+	}
+
+	var nearest *Airport
+	var nearestDistance float64
+	for i := range d.airports {
+		airport := &d.airports[i]
+		distance := geo.Distance(airport.Lat, airport.Lon, lat, lon)
+		if distance > airport.Radius {
+			continue
+		}
+		if nearest == nil || distance < nearestDistance {
+			nearest, nearestDistance = airport, distance
+		}
+	}
+	return nearest
+}
+
+// phaseOf classifies the vertical phase of an aircraft from its altitude and vertical rate. An
+// aircraft climbing or descending keeps its phase until its rate drops below holdRate.
+func phaseOf(aircraft *models.Aircraft, previous Phase) Phase {
+	if aircraft.OnGround() {
+		return PhaseGround
+	}
+
+	rate, ok := aircraft.VerticalRate()
+	switch {
+	case !ok:
+		return PhaseUnknown
+	case previous == PhaseClimb && rate >= holdRate:
+		return PhaseClimb
+	case previous == PhaseDescent && rate <= -holdRate:
+		return PhaseDescent
+	case rate >= climbRate:
+		return PhaseClimb
+	case rate <= descentRate:
+		return PhaseDescent
+	default:
+		return PhaseLevel
+	}
+}
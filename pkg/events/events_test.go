@@ -0,0 +1,168 @@
+package events
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rknightion/adsb2loki/pkg/models"
+)
+
+// types returns the event types in order for easy comparison
+func types(events []Event) []Type {
+	result := make([]Type, 0, len(events))
+	for _, e := range events {
+		result = append(result, e.Type)
+	}
+	return result
+}
+
+func equalTypes(a, b []Type) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestParseAirports(t *testing.T) {
+	airports, err := ParseAirports("egll:51.4700:-0.4543, EIDW:53.4213:-6.2701:8")
+	if err != nil {
+		t.Fatalf("Failed to parse airports: %v", err)
+	}
+	if len(airports) != 2 {
+		t.Fatalf("Expected 2 airports, got %d", len(airports))
+	}
+	if airports[0].Code != "EGLL" || airports[0].Radius != DefaultAirportRadius {
+		t.Errorf("Expected EGLL with default radius, got %+v", airports[0])
+	}
+	if airports[1].Radius != 8 {
+		t.Errorf("Expected radius 8, got %f", airports[1].Radius)
+	}
+
+	if _, err := ParseAirports("EGLL:north:-0.45"); err == nil {
+		t.Error("Expected error for invalid latitude")
+	}
+	if _, err := ParseAirports("EGLL"); err == nil {
+		t.Error("Expected error for missing coordinates")
+	}
+	if airports, err := ParseAirports(""); err != nil || len(airports) != 0 {
+		t.Errorf("Expected no airports for empty input, got %v, %v", airports, err)
+	}
+}
+
+func TestDetectorTakeoffAndLanding(t *testing.T) {
+	airports := []Airport{{Code: "EIDW", Lat: 53.4213, Lon: -6.2701, Radius: 5}}
+	d := NewDetector(time.Minute, airports)
+	ts := time.Unix(1748083431, 0)
+
+	got := d.Observe(&models.Aircraft{Hex: "4CA614", Flight: "EIN581 ", AltBaro: "ground", Lat: 53.42, Lon: -6.27}, ts)
+	if !equalTypes(types(got), []Type{Appeared}) {
+		t.Fatalf("Expected appeared, got %v", types(got))
+	}
+	if got[0].Hex != "4ca614" || got[0].Flight != "EIN581" {
+		t.Errorf("Expected normalised hex and flight, got %+v", got[0])
+	}
+
+	got = d.Observe(&models.Aircraft{Hex: "4ca614", AltBaro: float64(800), BaroRate: float64(2000), Lat: 53.43, Lon: -6.26}, ts.Add(10*time.Second))
+	if !equalTypes(types(got), []Type{Takeoff}) {
+		t.Fatalf("Expected takeoff, got %v", types(got))
+	}
+	if got[0].Airport != "EIDW" {
+		t.Errorf("Expected takeoff at EIDW, got %q", got[0].Airport)
+	}
+
+	got = d.Observe(&models.Aircraft{Hex: "4ca614", AltBaro: float64(35000), BaroRate: float64(0), Lat: 53.9, Lon: -5.5}, ts.Add(20*time.Minute))
+	if !equalTypes(types(got), []Type{PhaseChange}) {
+		t.Fatalf("Expected phase change, got %v", types(got))
+	}
+	if got[0].PreviousPhase != PhaseClimb || got[0].Phase != PhaseLevel {
+		t.Errorf("Expected climb -> level, got %s -> %s", got[0].PreviousPhase, got[0].Phase)
+	}
+
+	got = d.Observe(&models.Aircraft{Hex: "4ca614", AltBaro: "ground", Lat: 53.42, Lon: -6.27}, ts.Add(time.Hour))
+	if !equalTypes(types(got), []Type{Landing}) {
+		t.Fatalf("Expected landing, got %v", types(got))
+	}
+}
+
+func TestDetectorGoAround(t *testing.T) {
+	airports := []Airport{{Code: "EGLL", Lat: 51.4700, Lon: -0.4543, Radius: 8}}
+	d := NewDetector(time.Minute, airports)
+	ts := time.Unix(1748083431, 0)
+
+	d.Observe(&models.Aircraft{Hex: "abc123", AltBaro: float64(2500), BaroRate: float64(-800), Lat: 51.47, Lon: -0.40}, ts)
+	d.Observe(&models.Aircraft{Hex: "abc123", AltBaro: float64(1200), BaroRate: float64(-700), Lat: 51.47, Lon: -0.43}, ts.Add(30*time.Second))
+	got := d.Observe(&models.Aircraft{Hex: "abc123", AltBaro: float64(1500), BaroRate: float64(1800), Lat: 51.47, Lon: -0.46}, ts.Add(60*time.Second))
+
+	if !equalTypes(types(got), []Type{PhaseChange, GoAround}) {
+		t.Fatalf("Expected phase change and go-around, got %v", types(got))
+	}
+	if got[1].Airport != "EGLL" {
+		t.Errorf("Expected go-around at EGLL, got %q", got[1].Airport)
+	}
+
+	// Continuing the climb does not trigger another go-around
+	got = d.Observe(&models.Aircraft{Hex: "abc123", AltBaro: float64(2500), BaroRate: float64(1800), Lat: 51.47, Lon: -0.48}, ts.Add(90*time.Second))
+	if len(got) != 0 {
+		t.Errorf("Expected no events, got %v", types(got))
+	}
+}
+
+func TestDetectorPhaseHysteresis(t *testing.T) {
+	d := NewDetector(time.Minute, nil)
+	ts := time.Unix(1748083431, 0)
+	d.Observe(&models.Aircraft{Hex: "abc123", AltBaro: float64(5000), BaroRate: float64(0)}, ts)
+
+	tests := []struct {
+		name  string
+		rate  float64
+		want  []Type
+		phase Phase
+	}{
+		{name: "enters the climb", rate: 600, want: []Type{PhaseChange}, phase: PhaseClimb},
+		{name: "keeps climbing below the entry rate", rate: 400, want: []Type{}},
+		{name: "back above the entry rate", rate: 550, want: []Type{}},
+		{name: "levels off below the hold rate", rate: 250, want: []Type{PhaseChange}, phase: PhaseLevel},
+		{name: "stays level below the entry rate", rate: 400, want: []Type{}},
+		{name: "enters the descent", rate: -500, want: []Type{PhaseChange}, phase: PhaseDescent},
+		{name: "keeps descending", rate: -350, want: []Type{}},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := d.Observe(&models.Aircraft{Hex: "abc123", AltBaro: float64(5000), BaroRate: tt.rate}, ts.Add(time.Duration(i+1)*time.Second))
+			if !equalTypes(types(got), tt.want) {
+				t.Fatalf("Expected %v, got %v", tt.want, types(got))
+			}
+			if len(got) > 0 && got[0].Phase != tt.phase {
+				t.Errorf("Expected phase %s, got %s", tt.phase, got[0].Phase)
+			}
+		})
+	}
+}
+
+func TestDetectorExpire(t *testing.T) {
+	d := NewDetector(time.Minute, nil)
+	ts := time.Unix(1748083431, 0)
+
+	d.Observe(&models.Aircraft{Hex: "abc123", AltBaro: float64(10000)}, ts)
+	d.Observe(&models.Aircraft{Hex: "def456"}, ts.Add(90*time.Second))
+
+	lost := d.Expire(ts.Add(90 * time.Second))
+	if len(lost) != 1 || lost[0].Type != Lost || lost[0].Hex != "abc123" {
+		t.Fatalf("Expected abc123 to be lost, got %+v", lost)
+	}
+	if lost[0].Altitude == nil || *lost[0].Altitude != 10000 {
+		t.Errorf("Expected last altitude on lost event, got %v", lost[0].Altitude)
+	}
+
+	// A lost aircraft that comes back appears again
+	got := d.Observe(&models.Aircraft{Hex: "abc123"}, ts.Add(2*time.Minute))
+	if !equalTypes(types(got), []Type{Appeared}) {
+		t.Errorf("Expected appeared after lost, got %v", types(got))
+	}
+}
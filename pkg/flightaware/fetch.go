@@ -0,0 +1,198 @@
+package flightaware
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/rknightion/adsb2loki/pkg/bincraft"
+	"github.com/rknightion/adsb2loki/pkg/models"
+)
+
+// ErrDecode is returned by Fetch when the response isn't a valid aircraft.json or binCraft snapshot
+var ErrDecode = errors.New("failed to decode snapshot")
+
+// ErrNotModified is returned by Fetcher.Fetch when the snapshot hasn't changed since the previous fetch
+var ErrNotModified = errors.New("aircraft.json not modified")
+
+// sharedClient keeps connections to the receiver open between polls. Decompression is left to
+// decodeSnapshot, which also handles files stored gzip compressed such as aircraft.json.gz.
+var sharedClient = &http.Client{
+	Timeout:   10 * time.Second,
+	Transport: newTransport(),
+}
+
+// newTransport tunes the default transport for polling a few hosts at a short interval
+func newTransport() *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.MaxIdleConnsPerHost = 4
+	t.IdleConnTimeout = 90 * time.Second
+	t.TLSHandshakeTimeout = 5 * time.Second
+	t.ResponseHeaderTimeout = 10 * time.Second
+	return t
+}
+
+// Fetcher polls aircraft.json over reused connections, or from a local file. It sends conditional
+// requests and skips snapshots that haven't changed, so an idle receiver costs little more than
+// the headers. A Fetcher is not safe for concurrent use.
+type Fetcher struct {
+	URL    string
+	Client *http.Client
+
+	etag         string // ETag, or the modification time and size of a local file
+	lastModified string
+	lastNow      float64 // The now field of the previous snapshot
+}
+
+// NewFetcher creates a fetcher for the given URL using the shared client
+func NewFetcher(url string) *Fetcher {
+	return &Fetcher{URL: url, Client: sharedClient}
+}
+
+// Fetch fetches and decodes aircraft.json from the given URL
+func Fetch(ctx context.Context, url string) (*models.AutoGenerated, error) {
+	return NewFetcher(url).Fetch(ctx)
+}
+
+// Fetch fetches the next snapshot. It returns ErrNotModified when the server answers 304 Not
+// Modified or the snapshot has the same now timestamp as the previous one. file:// URLs are
+// read from the local filesystem.
+func (f *Fetcher) Fetch(ctx context.Context) (*models.AutoGenerated, error) {
+	if path, ok := FilePath(f.URL); ok {
+		return f.fetchFile(path)
+	}
+
+	// Create request with context
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, f.URL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept-Encoding", "gzip")
+	if f.etag != "" {
+		req.Header.Set("If-None-Match", f.etag)
+	}
+	if f.lastModified != "" {
+		req.Header.Set("If-Modified-Since", f.lastModified)
+	}
+
+	// Make the request
+	resp, err := f.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch data: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotModified:
+		return nil, ErrNotModified
+	default:
+		return nil, fmt.Errorf("failed to fetch data: status %d", resp.StatusCode)
+	}
+
+	data, err := f.decode(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	f.etag = resp.Header.Get("ETag")
+	f.lastModified = resp.Header.Get("Last-Modified")
+	return f.changed(data)
+}
+
+// fetchFile reads a local snapshot, skipping it when its modification time and size are unchanged
+func (f *Fetcher) fetchFile(path string) (*models.AutoGenerated, error) {
+	// The decoder replaces the file by renaming, the opened file stays complete while it's read
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read data: %w", err)
+	}
+	defer file.Close()
+
+	fi, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read data: %w", err)
+	}
+	version := fmt.Sprintf("%d-%d", fi.ModTime().UnixNano(), fi.Size())
+	if version == f.etag {
+		return nil, ErrNotModified
+	}
+
+	data, err := f.decode(file)
+	if err != nil {
+		return nil, err
+	}
+	f.etag = version
+	return f.changed(data)
+}
+
+// decode decodes a snapshot in the format served at the fetcher's URL
+func (f *Fetcher) decode(r io.Reader) (*models.AutoGenerated, error) {
+	decode := decodeSnapshot
+	if isBinCraft(f.URL) {
+		decode = bincraft.Read
+	}
+	data, err := decode(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDecode, err)
+	}
+	return data, nil
+}
+
+// changed returns ErrNotModified when data has the same now timestamp as the previous snapshot.
+// Servers without validators return the same snapshot until the decoder rewrites it.
+func (f *Fetcher) changed(data *models.AutoGenerated) (*models.AutoGenerated, error) {
+	if data.Now != 0 && data.Now == f.lastNow {
+		return nil, ErrNotModified
+	}
+	f.lastNow = data.Now
+	return data, nil
+}
+
+// FilePath returns the local path of a file:// URL
+func FilePath(rawURL string) (string, bool) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme != "file" || u.Path == "" {
+		return "", false
+	}
+	return u.Path, true
+}
+
+// decodeSnapshot decodes aircraft.json, gzip compressed or plain. The gzip header is detected
+// from the content, so both Content-Encoding: gzip and aircraft.json.gz files are handled.
+func decodeSnapshot(r io.Reader) (*models.AutoGenerated, error) {
+	br := bufio.NewReader(r)
+	var src io.Reader = br
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		src = gz
+	}
+
+	var data models.AutoGenerated
+	if err := json.NewDecoder(src).Decode(&data); err != nil {
+		return nil, err
+	}
+	return &data, nil
+}
+
+// isBinCraft reports whether a URL serves tar1090's aircraft.binCraft or aircraft.binCraft.zst
+func isBinCraft(rawURL string) bool {
+	name := rawURL
+	if u, err := url.Parse(rawURL); err == nil {
+		name = u.Path
+	}
+	return strings.Contains(strings.ToLower(path.Base(name)), ".bincraft")
+}
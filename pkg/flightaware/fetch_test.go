@@ -0,0 +1,240 @@
+package flightaware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func gzipBytes(t *testing.T, s string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write([]byte(s)); err != nil {
+		t.Fatalf("Failed to compress: %v", err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatalf("Failed to compress: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestFetcherConditionalRequests(t *testing.T) {
+	const etag = `"5f1-abc"`
+	const lastModified = "Mon, 19 Oct 2026 12:00:00 GMT"
+
+	var requests []*http.Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r)
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Last-Modified", lastModified)
+		w.Write([]byte(`{"now": 100, "aircraft": [{"hex": "abc123"}]}`))
+	}))
+	defer server.Close()
+
+	f := NewFetcher(server.URL + "/data/aircraft.json")
+	data, err := f.Fetch(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(data.Aircraft) != 1 {
+		t.Errorf("Expected 1 aircraft, got %d", len(data.Aircraft))
+	}
+
+	if _, err := f.Fetch(context.Background()); !errors.Is(err, ErrNotModified) {
+		t.Errorf("Expected ErrNotModified, got %v", err)
+	}
+
+	if len(requests) != 2 {
+		t.Fatalf("Expected 2 requests, got %d", len(requests))
+	}
+	if got := requests[0].Header.Get("If-None-Match"); got != "" {
+		t.Errorf("Expected no If-None-Match on the first request, got %q", got)
+	}
+	if got := requests[1].Header.Get("If-Modified-Since"); got != lastModified {
+		t.Errorf("Expected If-Modified-Since %q, got %q", lastModified, got)
+	}
+	if got := requests[1].Header.Get("Accept-Encoding"); got != "gzip" {
+		t.Errorf("Expected Accept-Encoding gzip, got %q", got)
+	}
+}
+
+func TestFetcherUnchangedNow(t *testing.T) {
+	now := "100"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Write([]byte(`{"now": ` + now + `, "aircraft": []}`))
+	}))
+	defer server.Close()
+
+	f := NewFetcher(server.URL)
+	if _, err := f.Fetch(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := f.Fetch(context.Background()); !errors.Is(err, ErrNotModified) {
+		t.Errorf("Expected ErrNotModified for the same snapshot, got %v", err)
+	}
+
+	now = "101"
+	data, err := f.Fetch(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if data.Now != 101 {
+		t.Errorf("Expected now 101, got %v", data.Now)
+	}
+}
+
+func TestFetcherGzip(t *testing.T) {
+	body := gzipBytes(t, `{"now": 100, "aircraft": [{"hex": "abc123"}, {"hex": "def456"}]}`)
+
+	tests := []struct {
+		name     string
+		path     string
+		encoding string
+	}{
+		{name: "content encoding", path: "/data/aircraft.json", encoding: "gzip"},
+		{name: "compressed file", path: "/data/aircraft.json.gz"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				if tt.encoding != "" {
+					w.Header().Set("Content-Encoding", tt.encoding)
+				}
+				w.Write(body)
+			}))
+			defer server.Close()
+
+			data, err := NewFetcher(server.URL + tt.path).Fetch(context.Background())
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if len(data.Aircraft) != 2 {
+				t.Errorf("Expected 2 aircraft, got %d", len(data.Aircraft))
+			}
+		})
+	}
+}
+
+func TestFetcherFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "aircraft.json")
+	write := func(body string, mtime time.Time) {
+		t.Helper()
+		// Replace the file like readsb does, by renaming a temporary file over it
+		tmp := filepath.Join(dir, "aircraft.json.tmp")
+		if err := os.WriteFile(tmp, []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(tmp, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Rename(tmp, path); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	start := time.Unix(1760875200, 0)
+	write(`{"now": 100, "aircraft": [{"hex": "abc123"}]}`, start)
+
+	f := NewFetcher("file://" + path)
+	data, err := f.Fetch(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(data.Aircraft) != 1 {
+		t.Errorf("Expected 1 aircraft, got %d", len(data.Aircraft))
+	}
+
+	if _, err := f.Fetch(context.Background()); !errors.Is(err, ErrNotModified) {
+		t.Errorf("Expected ErrNotModified for an unchanged file, got %v", err)
+	}
+
+	write(`{"now": 101, "aircraft": [{"hex": "abc123"}, {"hex": "def456"}]}`, start.Add(time.Second))
+	data, err = f.Fetch(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(data.Aircraft) != 2 {
+		t.Errorf("Expected 2 aircraft, got %d", len(data.Aircraft))
+	}
+
+	if _, err := NewFetcher("file://" + filepath.Join(dir, "missing.json")).Fetch(context.Background()); err == nil {
+		t.Error("Expected error for a missing file, got nil")
+	}
+}
+
+func TestFetcherErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		status  int
+		body    string
+		wantErr error
+	}{
+		{name: "server error", path: "/aircraft.json", status: http.StatusBadGateway},
+		{name: "invalid json", path: "/aircraft.json", status: http.StatusOK, body: "{", wantErr: ErrDecode},
+		{name: "invalid gzip", path: "/aircraft.json.gz", status: http.StatusOK, body: "\x1f\x8bnot gzip", wantErr: ErrDecode},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			_, err := NewFetcher(server.URL + tt.path).Fetch(context.Background())
+			if err == nil {
+				t.Fatal("Expected error, got nil")
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("Expected %v, got %v", tt.wantErr, err)
+			}
+			if errors.Is(err, ErrNotModified) {
+				t.Errorf("Expected a failure, got %v", err)
+			}
+		})
+	}
+}
+
+func TestFetcherBinCraft(t *testing.T) {
+	body, err := os.ReadFile("../bincraft/testdata/aircraft.binCraft.zst")
+	if err != nil {
+		t.Fatalf("Failed to read fixture: %v", err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Write(body)
+	}))
+	defer server.Close()
+
+	data, err := NewFetcher(server.URL + "/data/aircraft.binCraft.zst").Fetch(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(data.Aircraft) != 3 {
+		t.Fatalf("Expected 3 aircraft, got %d", len(data.Aircraft))
+	}
+	if data.Aircraft[0].Callsign() != "RYR7GW" {
+		t.Errorf("Expected callsign RYR7GW, got %q", data.Aircraft[0].Callsign())
+	}
+
+	// The JSON decoder must not be used for binCraft
+	_, err = NewFetcher(server.URL + "/data/aircraft.json").Fetch(context.Background())
+	if !errors.Is(err, ErrDecode) {
+		t.Errorf("Expected ErrDecode for binCraft served as JSON, got %v", err)
+	}
+}
@@ -4,68 +4,317 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"net/http"
 	"os"
 	"time"
 
+	"github.com/rknightion/adsb2loki/pkg/alert"
 	"github.com/rknightion/adsb2loki/pkg/common"
+	"github.com/rknightion/adsb2loki/pkg/events"
 	"github.com/rknightion/adsb2loki/pkg/models"
+	"github.com/rknightion/adsb2loki/pkg/otel"
+	"github.com/rknightion/adsb2loki/pkg/session"
+	"github.com/rknightion/adsb2loki/pkg/severity"
+	"github.com/rknightion/adsb2loki/pkg/state"
+	"github.com/rknightion/adsb2loki/pkg/stream"
 )
 
+// SnapshotRecorder receives every processed snapshot, e.g. to derive metrics
+type SnapshotRecorder interface {
+	RecordSnapshot(ctx context.Context, data *models.AutoGenerated, ts time.Time)
+}
+
+// Processor turns aircraft.json snapshots into log entries and pushes them to a logger.
+// Optional components keep per-aircraft state between snapshots.
+type Processor struct {
+	Logger   common.Logger
+	Sessions *session.Tracker   // Optional, attaches a session_id to every entry
+	Events   *events.Detector   // Optional, emits lifecycle events as separate entries
+	Alerts   *alert.Manager     // Optional, emits alert entries for emergencies, watchlists and geofences
+	Notifier *alert.Dispatcher  // Optional, delivers alerts raised by Alerts to webhooks
+	Flights  *otel.FlightTracer // Optional, exports each session as a span, requires Sessions
+	Severity *severity.Rules    // Optional, classifies each entry with a level
+	// LevelLabel sets the level as a label instead of structured metadata
+	LevelLabel bool
+	Recorders  []SnapshotRecorder // Optional, receive every snapshot before it is converted
+	State      *state.Store       // Optional, keeps the current state of every aircraft for the HTTP API
+	Stream     *stream.Hub        // Optional, publishes positions, events and alerts to live subscribers
+}
+
+// NewProcessor creates a new processor pushing to the given logger
+func NewProcessor(logger common.Logger) *Processor {
+	return &Processor{Logger: logger}
+}
+
 // FetchAndPushToLoki fetches data from FlightAware and pushes to Loki
 func FetchAndPushToLoki(ctx context.Context, logger common.Logger) error {
-	// Create request with context
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, os.Getenv("AIRCRAFT_JSON_URL"), nil)
+	data, err := Fetch(ctx, os.Getenv("AIRCRAFT_JSON_URL"))
 	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+		return err
 	}
 
-	// Make the request
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to fetch data: %w", err)
-	}
-	defer resp.Body.Close()
+	return NewProcessor(logger).Process(ctx, data, time.Now())
+}
 
-	var data models.AutoGenerated
-	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
-		return fmt.Errorf("failed to decode JSON: %w", err)
+// Process converts a snapshot taken at ts to log entries and pushes them to the logger
+func (p *Processor) Process(ctx context.Context, data *models.AutoGenerated, ts time.Time) error {
+	for _, r := range p.Recorders {
+		r.RecordSnapshot(ctx, data, ts)
 	}
 
 	// Convert to log entries
 	var entries []common.LogEntry
 	for i := range data.Aircraft {
 		aircraft := &data.Aircraft[i] // Use pointer to avoid copying
-		aircraftJSON, err := json.Marshal(aircraft)
+
+		// Assign the sighting to a session so all entries of one visit can be grouped
+		var sess session.Session
+		if p.Sessions != nil && aircraft.Hex != "" {
+			sess, _ = p.Sessions.Observe(aircraft, ts)
+			if p.Flights != nil {
+				p.Flights.Observe(aircraft, sess, ts)
+			}
+		}
+
+		entry, err := p.buildEntry(aircraft, ts, sess.ID)
 		if err != nil {
-			return fmt.Errorf("failed to marshal aircraft data: %w", err)
+			return err
 		}
 
-		entry := common.LogEntry{
-			Timestamp: time.Now(),
-			Line:      string(aircraftJSON),
-			Labels: map[string]string{
-				"app": "flightaware",
-			},
-			StructuredMetadata: map[string]string{
-				"hex":    aircraft.Hex,
-				"flight": aircraft.Flight,
-			},
+		// Classify the aircraft so backends can alert on severity
+		var level severity.Level
+		if p.Severity != nil {
+			level = p.Severity.Classify(aircraft)
+			p.setLevel(&entry, level)
 		}
 
-		// Add category to structured metadata if present
-		if aircraft.Category != "" {
-			entry.StructuredMetadata["category"] = aircraft.Category
+		if p.State != nil {
+			p.State.Update(aircraft, ts, sess, level)
+		}
+		if p.Stream != nil && aircraft.Hex != "" {
+			p.Stream.Publish(stream.PositionMessage(aircraft, ts))
 		}
 
 		entries = append(entries, entry)
+
+		if p.Events != nil && aircraft.Hex != "" {
+			for _, e := range p.Events.Observe(aircraft, ts) {
+				eventEntry, err := p.buildEventEntry(e)
+				if err != nil {
+					return err
+				}
+				setReceiver(&eventEntry, aircraft)
+				entries = append(entries, eventEntry)
+				if p.Flights != nil {
+					p.Flights.RecordEvent(e)
+				}
+				if p.Stream != nil {
+					p.Stream.Publish(stream.EventMessage(e))
+				}
+			}
+		}
+
+		if p.Alerts != nil && aircraft.Hex != "" {
+			for _, a := range p.Alerts.Evaluate(aircraft, ts) {
+				alertEntry, err := p.buildAlertEntry(a)
+				if err != nil {
+					return err
+				}
+				setReceiver(&alertEntry, aircraft)
+				if p.Severity != nil {
+					p.setLevel(&alertEntry, severity.Max(level, severity.Warn))
+				}
+				entries = append(entries, alertEntry)
+				if p.Notifier != nil {
+					p.Notifier.Enqueue(a)
+				}
+				if p.Flights != nil {
+					p.Flights.RecordAlert(a)
+				}
+				if p.State != nil {
+					p.State.RecordAlert(a)
+				}
+				if p.Stream != nil {
+					p.Stream.Publish(stream.AlertMessage(a))
+				}
+			}
+		}
+	}
+
+	if p.State != nil {
+		p.State.SetMessages(data.Messages)
+	}
+	lost, err := p.expire(ts)
+	if err != nil {
+		return err
 	}
+	entries = append(entries, lost...)
 
 	// Push to logger
-	if err := logger.PushLogs(ctx, entries); err != nil {
+	if err := p.Logger.PushLogs(ctx, entries); err != nil {
 		return fmt.Errorf("failed to push logs: %w", err)
 	}
 
 	return nil
 }
+
+// Expire runs the expiry of Process at ts without a new snapshot, for polls where aircraft.json
+// hasn't changed, so aircraft are still reported lost and their sessions still end
+func (p *Processor) Expire(ctx context.Context, ts time.Time) error {
+	entries, err := p.expire(ts)
+	if err != nil {
+		return err
+	}
+	if err := p.Logger.PushLogs(ctx, entries); err != nil {
+		return fmt.Errorf("failed to push logs: %w", err)
+	}
+	return nil
+}
+
+// expire forgets the aircraft gone as of ts and returns the entries of their lost events
+func (p *Processor) expire(ts time.Time) ([]common.LogEntry, error) {
+	var entries []common.LogEntry
+
+	// Report aircraft whose signal has been lost
+	if p.Events != nil {
+		for _, e := range p.Events.Expire(ts) {
+			eventEntry, err := p.buildEventEntry(e)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, eventEntry)
+			if p.Flights != nil {
+				p.Flights.RecordEvent(e)
+			}
+			if p.Stream != nil {
+				p.Stream.Publish(stream.EventMessage(e))
+			}
+		}
+	}
+
+	if p.Alerts != nil {
+		p.Alerts.Expire(ts)
+	}
+
+	if p.State != nil {
+		p.State.Expire(ts)
+	}
+
+	// Forget sessions for aircraft that have been gone longer than the gap timeout
+	if p.Sessions != nil {
+		for _, sess := range p.Sessions.Expire(ts) {
+			if p.Flights != nil {
+				p.Flights.End(sess)
+			}
+		}
+	}
+	return entries, nil
+}
+
+// setLevel records the level of an entry as a label or structured metadata
+func (p *Processor) setLevel(entry *common.LogEntry, level severity.Level) {
+	if p.LevelLabel {
+		entry.Labels[severity.Key] = string(level)
+		return
+	}
+	entry.StructuredMetadata[severity.Key] = string(level)
+}
+
+// buildEntry converts a single aircraft to a log entry
+func (p *Processor) buildEntry(aircraft *models.Aircraft, ts time.Time, sessionID string) (common.LogEntry, error) {
+	aircraftJSON, err := json.Marshal(aircraft)
+	if err != nil {
+		return common.LogEntry{}, fmt.Errorf("failed to marshal aircraft data: %w", err)
+	}
+
+	entry := common.LogEntry{
+		Timestamp: ts,
+		Line:      string(aircraftJSON),
+		Labels: map[string]string{
+			"app": "flightaware",
+		},
+		StructuredMetadata: map[string]string{
+			"hex":    aircraft.Hex,
+			"flight": aircraft.Flight,
+		},
+	}
+
+	// Add category to structured metadata if present
+	if aircraft.Category != "" {
+		entry.StructuredMetadata["category"] = aircraft.Category
+	}
+
+	// Add the session ID if the aircraft is tracked
+	if sessionID != "" {
+		entry.StructuredMetadata["session_id"] = sessionID
+	}
+
+	setReceiver(&entry, aircraft)
+
+	return entry, nil
+}
+
+// setReceiver labels an entry with the receiver of the aircraft, when the input merges several
+func setReceiver(entry *common.LogEntry, aircraft *models.Aircraft) {
+	if aircraft.Receiver != "" {
+		entry.Labels["receiver"] = aircraft.Receiver
+	}
+}
+
+// buildEventEntry converts a lifecycle event to a log entry with an event label
+func (p *Processor) buildEventEntry(e events.Event) (common.LogEntry, error) {
+	eventJSON, err := json.Marshal(e)
+	if err != nil {
+		return common.LogEntry{}, fmt.Errorf("failed to marshal event: %w", err)
+	}
+
+	entry := common.LogEntry{
+		Timestamp: e.Time,
+		Line:      string(eventJSON),
+		Labels: map[string]string{
+			"app":   "flightaware",
+			"event": string(e.Type),
+		},
+		StructuredMetadata: map[string]string{
+			"hex":    e.Hex,
+			"flight": e.Flight,
+		},
+	}
+
+	if p.Sessions != nil {
+		if s, ok := p.Sessions.Get(e.Hex); ok {
+			entry.StructuredMetadata["session_id"] = s.ID
+		}
+	}
+
+	return entry, nil
+}
+
+// buildAlertEntry converts an alert to a log entry with an event label of "alert"
+func (p *Processor) buildAlertEntry(a alert.Alert) (common.LogEntry, error) {
+	alertJSON, err := json.Marshal(a)
+	if err != nil {
+		return common.LogEntry{}, fmt.Errorf("failed to marshal alert: %w", err)
+	}
+
+	entry := common.LogEntry{
+		Timestamp: a.Time,
+		Line:      string(alertJSON),
+		Labels: map[string]string{
+			"app":   "flightaware",
+			"event": "alert",
+		},
+		StructuredMetadata: map[string]string{
+			"hex":          a.Hex,
+			"flight":       a.Flight,
+			"alert_reason": string(a.Reason),
+		},
+	}
+
+	if p.Sessions != nil {
+		if s, ok := p.Sessions.Get(a.Hex); ok {
+			entry.StructuredMetadata["session_id"] = s.ID
+		}
+	}
+
+	return entry, nil
+}
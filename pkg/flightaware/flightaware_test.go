@@ -3,13 +3,21 @@ package flightaware
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"testing"
+	"time"
 
+	"github.com/rknightion/adsb2loki/pkg/alert"
 	"github.com/rknightion/adsb2loki/pkg/common"
+	"github.com/rknightion/adsb2loki/pkg/events"
 	"github.com/rknightion/adsb2loki/pkg/models"
+	"github.com/rknightion/adsb2loki/pkg/session"
+	"github.com/rknightion/adsb2loki/pkg/severity"
+	"github.com/rknightion/adsb2loki/pkg/state"
+	"github.com/rknightion/adsb2loki/pkg/stream"
 )
 
 // mockLogger is a mock implementation of the Logger interface for testing
@@ -150,6 +158,9 @@ func TestFetchAndPushToLoki_InvalidJSON(t *testing.T) {
 	if err == nil {
 		t.Error("Expected error for invalid JSON, got nil")
 	}
+	if !errors.Is(err, ErrDecode) {
+		t.Errorf("Expected ErrDecode, got %v", err)
+	}
 }
 
 func TestFetchAndPushToLoki_ContextCancelled(t *testing.T) {
@@ -232,7 +243,268 @@ func TestFetchAndPushToLoki_MixedTypes(t *testing.T) {
 	}
 }
 
+func TestProcessorSessions(t *testing.T) {
+	logger := &mockLogger{}
+	processor := NewProcessor(logger)
+	processor.Sessions = session.NewTracker(time.Minute)
+
+	data := &models.AutoGenerated{Aircraft: []models.Aircraft{{Hex: "4ca614", Flight: "EIN581"}}}
+	start := time.Unix(1748083431, 0)
+
+	if err := processor.Process(context.Background(), data, start); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	firstID := logger.entries[0].StructuredMetadata["session_id"]
+	if firstID != "4ca614-1748083431" {
+		t.Errorf("Expected session_id 4ca614-1748083431, got %q", firstID)
+	}
+
+	// Same session on the next poll
+	if err := processor.Process(context.Background(), data, start.Add(5*time.Second)); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if id := logger.entries[0].StructuredMetadata["session_id"]; id != firstID {
+		t.Errorf("Expected session_id %s, got %s", firstID, id)
+	}
+
+	// New session after the gap timeout
+	if err := processor.Process(context.Background(), data, start.Add(time.Hour)); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if id := logger.entries[0].StructuredMetadata["session_id"]; id == firstID {
+		t.Errorf("Expected a new session_id after the gap, got %s", id)
+	}
+}
+
+func TestProcessorEvents(t *testing.T) {
+	logger := &mockLogger{}
+	processor := NewProcessor(logger)
+	processor.Sessions = session.NewTracker(10 * time.Minute)
+	processor.Events = events.NewDetector(time.Minute, nil)
+
+	start := time.Unix(1748083431, 0)
+	data := &models.AutoGenerated{Aircraft: []models.Aircraft{{Hex: "4ca614", Flight: "EIN581", AltBaro: "ground"}}}
+	if err := processor.Process(context.Background(), data, start); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// One position entry and one appeared event
+	if len(logger.entries) != 2 {
+		t.Fatalf("Expected 2 entries, got %d", len(logger.entries))
+	}
+	event := logger.entries[1]
+	if event.Labels["event"] != "appeared" {
+		t.Errorf("Expected event label 'appeared', got %q", event.Labels["event"])
+	}
+	if event.StructuredMetadata["session_id"] != logger.entries[0].StructuredMetadata["session_id"] {
+		t.Errorf("Expected event to share the session_id of the position entry")
+	}
+
+	// The aircraft takes off
+	data.Aircraft[0].AltBaro = float64(1200)
+	if err := processor.Process(context.Background(), data, start.Add(5*time.Second)); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(logger.entries) != 2 || logger.entries[1].Labels["event"] != "takeoff" {
+		t.Fatalf("Expected a takeoff event, got %+v", logger.entries)
+	}
+
+	// The aircraft disappears
+	empty := &models.AutoGenerated{}
+	if err := processor.Process(context.Background(), empty, start.Add(2*time.Minute)); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(logger.entries) != 1 || logger.entries[0].Labels["event"] != "lost" {
+		t.Fatalf("Expected a lost event, got %+v", logger.entries)
+	}
+}
+
+func TestProcessorExpire(t *testing.T) {
+	logger := &mockLogger{}
+	processor := NewProcessor(logger)
+	processor.Sessions = session.NewTracker(10 * time.Minute)
+	processor.Events = events.NewDetector(time.Minute, nil)
+
+	start := time.Unix(1748083431, 0)
+	data := &models.AutoGenerated{Aircraft: []models.Aircraft{{Hex: "4ca614", Flight: "EIN581"}}}
+	if err := processor.Process(context.Background(), data, start); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// aircraft.json stops changing, the aircraft is still reported lost
+	if err := processor.Expire(context.Background(), start.Add(30*time.Second)); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(logger.entries) != 0 {
+		t.Errorf("Expected no entries before the lost timeout, got %+v", logger.entries)
+	}
+	if err := processor.Expire(context.Background(), start.Add(2*time.Minute)); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(logger.entries) != 1 || logger.entries[0].Labels["event"] != "lost" {
+		t.Errorf("Expected a lost event, got %+v", logger.entries)
+	}
+}
+
+func TestProcessorAlerts(t *testing.T) {
+	logger := &mockLogger{}
+	processor := NewProcessor(logger)
+	processor.Alerts = alert.NewManager(alert.Config{})
+
+	data := &models.AutoGenerated{Aircraft: []models.Aircraft{{Hex: "4ca614", Flight: "EIN581", Squawk: "7700"}}}
+	if err := processor.Process(context.Background(), data, time.Now()); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if len(logger.entries) != 2 {
+		t.Fatalf("Expected position and alert entries, got %d", len(logger.entries))
+	}
+	entry := logger.entries[1]
+	if entry.Labels["event"] != "alert" || entry.StructuredMetadata["alert_reason"] != "squawk" {
+		t.Errorf("Expected squawk alert entry, got %+v", entry)
+	}
+}
+
+func TestProcessorReceiver(t *testing.T) {
+	logger := &mockLogger{}
+	processor := NewProcessor(logger)
+	processor.Events = events.NewDetector(time.Minute, nil)
+
+	data := &models.AutoGenerated{Aircraft: []models.Aircraft{
+		{Hex: "4ca614", Flight: "EIN581", Receiver: "site1"},
+		{Hex: "43c6f1", Flight: "RRR123"},
+	}}
+	if err := processor.Process(context.Background(), data, time.Now()); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// Position and appeared entries of each aircraft
+	if len(logger.entries) != 4 {
+		t.Fatalf("Expected 4 entries, got %d", len(logger.entries))
+	}
+	for i, want := range []string{"site1", "site1", "", ""} {
+		if got := logger.entries[i].Labels["receiver"]; got != want {
+			t.Errorf("Entry %d: expected receiver label %q, got %q", i, want, got)
+		}
+	}
+}
+
+func TestProcessorSeverity(t *testing.T) {
+	logger := &mockLogger{}
+	processor := NewProcessor(logger)
+	rules := severity.DefaultRules()
+	processor.Severity = &rules
+
+	data := &models.AutoGenerated{Aircraft: []models.Aircraft{
+		{Hex: "4ca614", Squawk: "7700"},
+		{Hex: "abc123", Squawk: "1234"},
+	}}
+	if err := processor.Process(context.Background(), data, time.Now()); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if level := logger.entries[0].StructuredMetadata["level"]; level != "fatal" {
+		t.Errorf("Expected level fatal, got %q", level)
+	}
+	if level := logger.entries[1].StructuredMetadata["level"]; level != "info" {
+		t.Errorf("Expected level info, got %q", level)
+	}
+
+	// The level can be promoted to a label instead
+	processor.LevelLabel = true
+	if err := processor.Process(context.Background(), data, time.Now()); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if level := logger.entries[0].Labels["level"]; level != "fatal" {
+		t.Errorf("Expected level label fatal, got %q", level)
+	}
+	if _, ok := logger.entries[0].StructuredMetadata["level"]; ok {
+		t.Error("Expected no level in structured metadata when using a label")
+	}
+}
+
+// mockRecorder records the snapshots it receives
+type mockRecorder struct {
+	snapshots []*models.AutoGenerated
+}
+
+func (m *mockRecorder) RecordSnapshot(_ context.Context, data *models.AutoGenerated, _ time.Time) {
+	m.snapshots = append(m.snapshots, data)
+}
+
+func TestProcessorRecorders(t *testing.T) {
+	recorder := &mockRecorder{}
+	processor := NewProcessor(&mockLogger{})
+	processor.Recorders = []SnapshotRecorder{recorder}
+
+	data := &models.AutoGenerated{Aircraft: []models.Aircraft{{Hex: "4ca614"}}}
+	if err := processor.Process(context.Background(), data, time.Now()); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(recorder.snapshots) != 1 || recorder.snapshots[0] != data {
+		t.Errorf("Expected the snapshot to be recorded once, got %d", len(recorder.snapshots))
+	}
+}
+
 // Simple contains function for tests
 func contains(s, substr string) bool {
 	return len(s) >= len(substr) && s[0:len(s)] != "" && s[0:len(substr)] == substr || len(s) > len(substr) && contains(s[1:], substr)
 }
+
+func TestProcessorState(t *testing.T) {
+	processor := NewProcessor(&mockLogger{})
+	processor.Sessions = session.NewTracker(10 * time.Minute)
+	processor.Alerts = alert.NewManager(alert.Config{})
+	processor.State = state.NewStore(time.Minute)
+
+	start := time.Unix(1748083431, 0)
+	data := &models.AutoGenerated{Messages: 42, Aircraft: []models.Aircraft{{Hex: "4ca614", Flight: "EIN581", Squawk: "7700"}}}
+	if err := processor.Process(context.Background(), data, start); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	e, ok := processor.State.Get("4ca614", start)
+	if !ok {
+		t.Fatal("Expected aircraft in the state table")
+	}
+	if e.SessionID != "4ca614-1748083431" || len(e.Alerts) != 1 {
+		t.Errorf("Expected session and alert enrichment, got %+v", e)
+	}
+	if processor.State.Messages() != 42 {
+		t.Errorf("Expected 42 messages, got %d", processor.State.Messages())
+	}
+
+	// The aircraft is dropped once it has been gone longer than the TTL
+	if err := processor.Process(context.Background(), &models.AutoGenerated{}, start.Add(2*time.Minute)); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if processor.State.Len() != 0 {
+		t.Errorf("Expected empty state table, got %d aircraft", processor.State.Len())
+	}
+}
+
+func TestProcessorStream(t *testing.T) {
+	processor := NewProcessor(&mockLogger{})
+	processor.Events = events.NewDetector(time.Minute, nil)
+	processor.Alerts = alert.NewManager(alert.Config{})
+	processor.Stream = stream.NewHub(10)
+	sub := processor.Stream.Subscribe(stream.Filter{})
+
+	data := &models.AutoGenerated{Aircraft: []models.Aircraft{{Hex: "4ca614", Flight: "EIN581", Squawk: "7700"}}}
+	if err := processor.Process(context.Background(), data, time.Now()); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	var kinds []string
+	for len(sub.Messages()) > 0 {
+		kinds = append(kinds, (<-sub.Messages()).Kind)
+	}
+	want := []string{stream.KindPosition, string(events.Appeared), stream.KindAlert}
+	if len(kinds) != len(want) {
+		t.Fatalf("Expected messages %v, got %v", want, kinds)
+	}
+	for i := range want {
+		if kinds[i] != want[i] {
+			t.Errorf("Expected %s at %d, got %s", want[i], i, kinds[i])
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package geo
+
+import "math"
+
+// earthRadiusNM is the mean radius of the earth in nautical miles
+const earthRadiusNM = 3440.065
+
+// Distance returns the great-circle distance between two points in nautical miles
+func Distance(lat1, lon1, lat2, lon2 float64) float64 {
+	lat1Rad := lat1 * math.Pi / 180
+	lat2Rad := lat2 * math.Pi / 180
+	dLat := (lat2 - lat1) * math.Pi / 180
+	dLon := (lon2 - lon1) * math.Pi / 180
+
+	// Haversine formula
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1Rad)*math.Cos(lat2Rad)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusNM * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+}
+
+// Circle is a circular area around a point
+type Circle struct {
+	Lat    float64
+	Lon    float64
+	Radius float64 // Nautical miles
+}
+
+// Contains reports whether the point lies inside the circle
+func (c Circle) Contains(lat, lon float64) bool {
+	return Distance(c.Lat, c.Lon, lat, lon) <= c.Radius
+}
@@ -0,0 +1,28 @@
+package geo
+
+import (
+	"math"
+	"testing"
+)
+
+func TestDistance(t *testing.T) {
+	// Heathrow to Dublin is roughly 243nm
+	d := Distance(51.4700, -0.4543, 53.4213, -6.2701)
+	if math.Abs(d-243) > 2 {
+		t.Errorf("Expected roughly 243nm, got %f", d)
+	}
+
+	if d := Distance(40.7128, -74.0060, 40.7128, -74.0060); d != 0 {
+		t.Errorf("Expected 0 for identical points, got %f", d)
+	}
+}
+
+func TestCircleContains(t *testing.T) {
+	c := Circle{Lat: 51.4700, Lon: -0.4543, Radius: 10}
+	if !c.Contains(51.5, -0.5) {
+		t.Error("Expected nearby point to be inside the circle")
+	}
+	if c.Contains(53.4213, -6.2701) {
+		t.Error("Expected distant point to be outside the circle")
+	}
+}
@@ -0,0 +1,272 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rknightion/adsb2loki/pkg/common"
+)
+
+// DefaultMaxMissed is the number of poll intervals without a successful fetch or push before the service is not ready
+const DefaultMaxMissed = 3
+
+// InputStatus is the state of one aircraft data input
+type InputStatus struct {
+	Name          string    `json:"name"`
+	URL           string    `json:"url,omitempty"`
+	LastFetch     time.Time `json:"last_fetch,omitzero"`
+	LastSuccess   time.Time `json:"last_success,omitzero"`
+	Aircraft      int       `json:"aircraft"`
+	LastError     string    `json:"last_error,omitempty"`
+	LastErrorTime time.Time `json:"last_error_time,omitzero"`
+}
+
+// SinkStatus is the state of one destination entries or alerts are delivered to
+type SinkStatus struct {
+	Name          string    `json:"name"`
+	LastPush      time.Time `json:"last_push,omitzero"`
+	LastSuccess   time.Time `json:"last_success,omitzero"`
+	Entries       int       `json:"entries"` // Entries in the last successful push
+	Backlog       int       `json:"backlog"`
+	LastError     string    `json:"last_error,omitempty"`
+	LastErrorTime time.Time `json:"last_error_time,omitzero"`
+}
+
+// Status is the JSON document served at /status
+type Status struct {
+	Ready         bool          `json:"ready"`
+	Version       string        `json:"version"`
+	ConfigVersion string        `json:"config_version"`
+	Started       time.Time     `json:"started"`
+	Inputs        []InputStatus `json:"inputs"`
+	Sinks         []SinkStatus  `json:"sinks"`
+}
+
+// sink tracks a sink and whether it counts towards readiness
+type sink struct {
+	status  SinkStatus
+	pushes  bool       // Set for sinks wrapped by Logger, which must push successfully to be ready
+	backlog func() int // Optional
+}
+
+// Monitor tracks fetches and pushes to report liveness, readiness and status
+type Monitor struct {
+	mu            sync.Mutex
+	interval      time.Duration
+	maxMissed     int
+	version       string
+	configVersion string
+	started       time.Time
+	inputs        map[string]*InputStatus
+	sinks         map[string]*sink
+	now           func() time.Time
+}
+
+// NewMonitor creates a monitor for a pipeline polling every interval. The service stays ready while
+// every input fetched and every sink pushed successfully within maxMissed intervals.
+func NewMonitor(interval time.Duration, maxMissed int, version, configVersion string) *Monitor {
+	if maxMissed <= 0 {
+		maxMissed = DefaultMaxMissed
+	}
+	return &Monitor{
+		interval:      interval,
+		maxMissed:     maxMissed,
+		version:       version,
+		configVersion: configVersion,
+		started:       time.Now(),
+		inputs:        make(map[string]*InputStatus),
+		sinks:         make(map[string]*sink),
+		now:           time.Now,
+	}
+}
+
+// AddInput registers an input so it shows up, and counts towards readiness, before its first fetch
+func (m *Monitor) AddInput(name, url string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.input(name).URL = url
+}
+
+// RecordFetch records the outcome of a fetch from an input
+func (m *Monitor) RecordFetch(name string, aircraft int, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	in := m.input(name)
+	in.LastFetch = now
+	if err != nil {
+		in.LastError = err.Error()
+		in.LastErrorTime = now
+		return
+	}
+	in.LastSuccess = now
+	in.Aircraft = aircraft
+}
+
+// RecordUnchanged records a successful fetch of a snapshot that hasn't changed since the previous
+// one, keeping its aircraft count
+func (m *Monitor) RecordUnchanged(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	in := m.input(name)
+	in.LastFetch = now
+	in.LastSuccess = now
+}
+
+// RecordPush records the outcome of a push of n entries to a sink
+func (m *Monitor) RecordPush(name string, n int, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	s := m.sink(name)
+	s.pushes = true
+	s.status.LastPush = now
+	if err != nil {
+		s.status.LastError = err.Error()
+		s.status.LastErrorTime = now
+		return
+	}
+	s.status.LastSuccess = now
+	s.status.Entries = n
+}
+
+// RegisterBacklog reports the number of entries waiting for a sink, e.g. a delivery queue
+func (m *Monitor) RegisterBacklog(name string, backlog func() int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sink(name).backlog = backlog
+}
+
+// Logger wraps a logger, recording every push to it under the given sink name
+func (m *Monitor) Logger(name string, logger common.Logger) common.Logger {
+	m.mu.Lock()
+	m.sink(name).pushes = true
+	m.mu.Unlock()
+	return &monitoredLogger{monitor: m, name: name, logger: logger}
+}
+
+// Ready reports whether every input and pushing sink succeeded recently, with a reason when not
+func (m *Monitor) Ready() (bool, string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.ready()
+}
+
+// Status returns the current status of every input and sink
+func (m *Monitor) Status() Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ready, _ := m.ready()
+	status := Status{
+		Ready:         ready,
+		Version:       m.version,
+		ConfigVersion: m.configVersion,
+		Started:       m.started,
+		Inputs:        []InputStatus{},
+		Sinks:         []SinkStatus{},
+	}
+	for _, in := range m.inputs {
+		status.Inputs = append(status.Inputs, *in)
+	}
+	for _, s := range m.sinks {
+		st := s.status
+		if s.backlog != nil {
+			st.Backlog = s.backlog()
+		}
+		status.Sinks = append(status.Sinks, st)
+	}
+	sort.Slice(status.Inputs, func(i, j int) bool { return status.Inputs[i].Name < status.Inputs[j].Name })
+	sort.Slice(status.Sinks, func(i, j int) bool { return status.Sinks[i].Name < status.Sinks[j].Name })
+	return status
+}
+
+// HandleHealthz reports that the process is alive
+func (m *Monitor) HandleHealthz(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte("ok\n"))
+}
+
+// HandleReadyz reports whether data is flowing, with 503 Service Unavailable when it isn't
+func (m *Monitor) HandleReadyz(w http.ResponseWriter, _ *http.Request) {
+	ready, reason := m.Ready()
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if !ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = w.Write([]byte(reason + "\n"))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte("ok\n"))
+}
+
+// HandleStatus serves the status as JSON
+func (m *Monitor) HandleStatus(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(m.Status())
+}
+
+// ready checks readiness, the caller must hold the lock
+func (m *Monitor) ready() (bool, string) {
+	if len(m.inputs) == 0 {
+		return false, "no inputs registered"
+	}
+
+	cutoff := m.now().Add(-time.Duration(m.maxMissed) * m.interval)
+	for _, in := range m.inputs {
+		if in.LastSuccess.Before(cutoff) {
+			return false, "no successful fetch from " + in.Name + " recently"
+		}
+	}
+	for name, s := range m.sinks {
+		if s.pushes && s.status.LastSuccess.Before(cutoff) {
+			return false, "no successful push to " + name + " recently"
+		}
+	}
+	return true, ""
+}
+
+// input returns the status of an input, creating it if needed. The caller must hold the lock.
+func (m *Monitor) input(name string) *InputStatus {
+	in, ok := m.inputs[name]
+	if !ok {
+		in = &InputStatus{Name: name}
+		m.inputs[name] = in
+	}
+	return in
+}
+
+// sink returns a sink, creating it if needed. The caller must hold the lock.
+func (m *Monitor) sink(name string) *sink {
+	s, ok := m.sinks[name]
+	if !ok {
+		s = &sink{status: SinkStatus{Name: name}}
+		m.sinks[name] = s
+	}
+	return s
+}
+
+// monitoredLogger records every push to the wrapped logger in the monitor
+type monitoredLogger struct {
+	monitor *Monitor
+	name    string
+	logger  common.Logger
+}
+
+// PushLogs pushes the entries to the wrapped logger
+func (l *monitoredLogger) PushLogs(ctx context.Context, entries []common.LogEntry) error {
+	err := l.logger.PushLogs(ctx, entries)
+	l.monitor.RecordPush(l.name, len(entries), err)
+	return err
+}
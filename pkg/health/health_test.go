@@ -0,0 +1,142 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rknightion/adsb2loki/pkg/common"
+)
+
+// mockLogger is a mock implementation of the Logger interface for testing
+type mockLogger struct {
+	err error
+}
+
+func (m *mockLogger) PushLogs(_ context.Context, _ []common.LogEntry) error {
+	return m.err
+}
+
+// newTestMonitor creates a monitor with a controllable clock
+func newTestMonitor(now *time.Time) *Monitor {
+	m := NewMonitor(5*time.Second, 3, "v1.0.0", "abc123")
+	m.now = func() time.Time { return *now }
+	return m
+}
+
+func TestReady(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	m := newTestMonitor(&now)
+	logger := &mockLogger{}
+	sink := m.Logger("loki", logger)
+	m.AddInput("aircraft_json", "http://localhost/aircraft.json")
+
+	if ready, _ := m.Ready(); ready {
+		t.Error("Expected not ready before the first fetch")
+	}
+
+	m.RecordFetch("aircraft_json", 12, nil)
+	if ready, reason := m.Ready(); ready || reason != "no successful push to loki recently" {
+		t.Errorf("Expected not ready before the first push, got %v %q", ready, reason)
+	}
+
+	_ = sink.PushLogs(context.Background(), []common.LogEntry{{Line: "a"}})
+	if ready, reason := m.Ready(); !ready {
+		t.Errorf("Expected ready, got %q", reason)
+	}
+
+	// Failures within the window don't affect readiness
+	now = now.Add(10 * time.Second)
+	m.RecordFetch("aircraft_json", 0, errors.New("connection refused"))
+	if ready, _ := m.Ready(); !ready {
+		t.Error("Expected ready while the last success is within 3 intervals")
+	}
+
+	now = now.Add(10 * time.Second)
+	if ready, reason := m.Ready(); ready || reason != "no successful fetch from aircraft_json recently" {
+		t.Errorf("Expected not ready after 3 missed intervals, got %v %q", ready, reason)
+	}
+}
+
+func TestRecordUnchanged(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	m := newTestMonitor(&now)
+	m.RecordFetch("aircraft_json", 12, nil)
+
+	now = now.Add(20 * time.Second)
+	m.RecordUnchanged("aircraft_json")
+	if ready, reason := m.Ready(); !ready {
+		t.Errorf("Expected unchanged snapshots to count as successful fetches, got %q", reason)
+	}
+	in := m.Status().Inputs[0]
+	if in.Aircraft != 12 || !in.LastSuccess.Equal(now) {
+		t.Errorf("Expected the aircraft count kept and the success recorded, got %+v", in)
+	}
+}
+
+func TestStatus(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	m := newTestMonitor(&now)
+	sink := m.Logger("otel", &mockLogger{err: errors.New("unavailable")})
+	m.RegisterBacklog("alerts", func() int { return 4 })
+	m.RecordFetch("aircraft_json", 12, nil)
+	_ = sink.PushLogs(context.Background(), []common.LogEntry{{Line: "a"}})
+
+	server := httptest.NewServer(http.HandlerFunc(m.HandleStatus))
+	defer server.Close()
+
+	resp, err := server.Client().Get(server.URL)
+	if err != nil {
+		t.Fatalf("Failed to get status: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var status Status
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		t.Fatalf("Failed to decode status: %v", err)
+	}
+
+	if status.Ready || status.Version != "v1.0.0" || status.ConfigVersion != "abc123" {
+		t.Errorf("Unexpected status %+v", status)
+	}
+	if len(status.Inputs) != 1 || status.Inputs[0].Aircraft != 12 || !status.Inputs[0].LastSuccess.Equal(now) {
+		t.Errorf("Unexpected inputs %+v", status.Inputs)
+	}
+	if len(status.Sinks) != 2 {
+		t.Fatalf("Expected 2 sinks, got %+v", status.Sinks)
+	}
+	if status.Sinks[0].Name != "alerts" || status.Sinks[0].Backlog != 4 {
+		t.Errorf("Unexpected alerts sink %+v", status.Sinks[0])
+	}
+	if status.Sinks[1].Name != "otel" || status.Sinks[1].LastError != "unavailable" {
+		t.Errorf("Unexpected otel sink %+v", status.Sinks[1])
+	}
+}
+
+func TestHandlers(t *testing.T) {
+	now := time.Now()
+	m := newTestMonitor(&now)
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		want    int
+	}{
+		{name: "healthz", handler: m.HandleHealthz, want: http.StatusOK},
+		{name: "readyz without inputs", handler: m.HandleReadyz, want: http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			tt.handler(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+			if rec.Code != tt.want {
+				t.Errorf("Expected status %d, got %d", tt.want, rec.Code)
+			}
+		})
+	}
+}
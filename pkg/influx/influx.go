@@ -0,0 +1,416 @@
+// Package influx writes aircraft samples to InfluxDB as line protocol, over the v2 HTTP write
+// API or UDP
+package influx
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rknightion/adsb2loki/pkg/common"
+)
+
+// DefaultMeasurement is the measurement of aircraft samples
+const DefaultMeasurement = "aircraft"
+
+// DefaultBatchSize is the number of lines written per HTTP request
+const DefaultBatchSize = 5000
+
+// maxDatagramSize keeps UDP datagrams within a typical MTU, so they aren't fragmented
+const maxDatagramSize = 1400
+
+// DefaultTags are the tags of each sample
+var DefaultTags = []string{"hex", "category", "receiver"}
+
+// DefaultFields are the aircraft.json fields written for each sample: altitude, speed, RSSI and position
+var DefaultFields = []string{"alt_baro", "alt_geom", "gs", "track", "baro_rate", "rssi", "lat", "lon"}
+
+// Config configures the InfluxDB sink
+type Config struct {
+	URL    string // http:// or https:// URL of InfluxDB, or udp://host:port
+	Org    string // HTTP only
+	Bucket string // HTTP only, required
+	Token  string // HTTP only, optional
+
+	Measurement string
+	Tags        []string // Taken from labels, structured metadata or string fields of the aircraft
+	Fields      []string // aircraft.json fields
+	Receiver    string   // receiver tag of entries without a receiver label
+
+	BatchSize  int
+	Gzip       bool          // Compress HTTP requests
+	MaxRetries int           // Retries of HTTP requests on network errors and 429/5xx responses
+	Backoff    time.Duration // Initial delay between retries, doubled after each attempt
+	RetryTime  time.Duration // Time after which a batch isn't retried anymore, zero for no limit
+}
+
+// Client writes aircraft entries as line protocol. Events, alerts and receiver statistics aren't written.
+type Client struct {
+	measurement string
+	tags        []string
+	fields      []string
+	receiver    string
+
+	// HTTP
+	writeURL   string
+	pingURL    string
+	token      string
+	batchSize  int
+	gzip       bool
+	maxRetries int
+	backoff    time.Duration
+	retryTime  time.Duration
+	client     *http.Client
+
+	// UDP
+	conn net.Conn
+}
+
+// NewClient creates a client for an HTTP or UDP URL. UDP clients are ready to send immediately.
+func NewClient(cfg Config) (*Client, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid InfluxDB URL: %w", err)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid InfluxDB URL %q: missing host", cfg.URL)
+	}
+
+	c := &Client{
+		measurement: cfg.Measurement,
+		tags:        cfg.Tags,
+		fields:      cfg.Fields,
+		receiver:    cfg.Receiver,
+	}
+	if c.measurement == "" {
+		c.measurement = DefaultMeasurement
+	}
+	if len(c.tags) == 0 {
+		c.tags = DefaultTags
+	}
+	if len(c.fields) == 0 {
+		c.fields = DefaultFields
+	}
+
+	switch u.Scheme {
+	case "http", "https":
+		if cfg.Bucket == "" {
+			return nil, errors.New("InfluxDB bucket is required")
+		}
+		query := url.Values{"bucket": {cfg.Bucket}, "precision": {"ns"}}
+		if cfg.Org != "" {
+			query.Set("org", cfg.Org)
+		}
+		base := strings.TrimSuffix(u.Path, "/")
+		ping := *u
+		ping.Path = base + "/ping"
+		c.pingURL = ping.String()
+		u.Path = base + "/api/v2/write"
+		u.RawQuery = query.Encode()
+		c.writeURL = u.String()
+		c.token = cfg.Token
+		c.batchSize = cfg.BatchSize
+		c.gzip = cfg.Gzip
+		c.maxRetries = cfg.MaxRetries
+		c.backoff = cfg.Backoff
+		c.retryTime = cfg.RetryTime
+		c.client = &http.Client{Timeout: 10 * time.Second}
+		if c.batchSize <= 0 {
+			c.batchSize = DefaultBatchSize
+		}
+		if c.backoff <= 0 {
+			c.backoff = time.Second
+		}
+	case "udp":
+		if c.conn, err = net.Dial("udp", u.Host); err != nil {
+			return nil, fmt.Errorf("failed to open UDP socket: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("invalid InfluxDB URL %q: expected http, https or udp", cfg.URL)
+	}
+	return c, nil
+}
+
+// PushLogs writes a line for each aircraft entry. Entries that can't be decoded are skipped and
+// reported in the error once the others are written. A push-test entry isn't written, the server
+// is pinged instead.
+func (c *Client) PushLogs(ctx context.Context, entries []common.LogEntry) error {
+	var lines [][]byte
+	var invalid []error
+	pushTest := false
+	for _, entry := range entries {
+		if entry.Labels["source"] == common.PushTestSource {
+			pushTest = true
+			continue
+		}
+		line, err := c.Encode(entry)
+		if err != nil {
+			invalid = append(invalid, err)
+			continue
+		}
+		if line != nil {
+			lines = append(lines, line)
+		}
+	}
+	var skipped error
+	if len(invalid) > 0 {
+		skipped = fmt.Errorf("%d invalid entries skipped, first: %w", len(invalid), invalid[0])
+	}
+	if pushTest {
+		if err := c.ping(ctx); err != nil {
+			return errors.Join(err, skipped)
+		}
+	}
+	if len(lines) == 0 {
+		return skipped
+	}
+
+	if c.conn != nil {
+		return errors.Join(c.sendUDP(lines), skipped)
+	}
+	for start := 0; start < len(lines); start += c.batchSize {
+		batch := bytes.Join(lines[start:min(start+c.batchSize, len(lines))], nil)
+		if err := c.write(ctx, batch); err != nil {
+			return errors.Join(err, skipped)
+		}
+	}
+	return skipped
+}
+
+// Encode converts an aircraft entry to a line, terminated by a newline. It returns nil for other
+// entries and aircraft without any of the configured fields.
+func (c *Client) Encode(entry common.LogEntry) ([]byte, error) {
+	if entry.StructuredMetadata["hex"] == "" || entry.Labels["event"] != "" {
+		return nil, nil
+	}
+	var aircraft map[string]interface{}
+	if err := json.Unmarshal([]byte(entry.Line), &aircraft); err != nil {
+		return nil, fmt.Errorf("failed to decode aircraft entry: %w", err)
+	}
+
+	var b bytes.Buffer
+	b.WriteString(escape(c.measurement, ", "))
+
+	tags := make(map[string]string, len(c.tags))
+	for _, key := range c.tags {
+		if value := c.tagValue(entry, aircraft, key); value != "" {
+			tags[key] = value
+		}
+	}
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys) // InfluxDB recommends sorted tags
+	for _, key := range keys {
+		b.WriteByte(',')
+		b.WriteString(escape(key, ",= "))
+		b.WriteByte('=')
+		b.WriteString(escape(tags[key], ",= "))
+	}
+
+	n := 0
+	for _, key := range c.fields {
+		value, ok := fieldValue(aircraft[key])
+		if !ok {
+			continue
+		}
+		// alt_baro is "ground" on the ground, keep the field numeric
+		if key == "alt_baro" && value == `"ground"` {
+			key, value = "on_ground", "true"
+		}
+		if n == 0 {
+			b.WriteByte(' ')
+		} else {
+			b.WriteByte(',')
+		}
+		b.WriteString(escape(key, ",= "))
+		b.WriteByte('=')
+		b.WriteString(value)
+		n++
+	}
+	if n == 0 {
+		return nil, nil
+	}
+
+	b.WriteByte(' ')
+	b.WriteString(strconv.FormatInt(entry.Timestamp.UnixNano(), 10))
+	b.WriteByte('\n')
+	return b.Bytes(), nil
+}
+
+// tagValue looks a tag up in the labels, then the structured metadata, then the aircraft's string fields
+func (c *Client) tagValue(entry common.LogEntry, aircraft map[string]interface{}, key string) string {
+	if value := entry.Labels[key]; value != "" {
+		return value
+	}
+	if value := entry.StructuredMetadata[key]; value != "" {
+		return strings.TrimSpace(value)
+	}
+	if value, ok := aircraft[key].(string); ok && value != "" {
+		return strings.TrimSpace(value)
+	}
+	if key == "receiver" {
+		return c.receiver
+	}
+	return ""
+}
+
+// fieldValue formats a JSON value as a line protocol field value. Numbers are always floats,
+// so a field keeps its type whether or not it has decimals. Arrays and objects are skipped.
+func fieldValue(v interface{}) (string, bool) {
+	switch v := v.(type) {
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case bool:
+		return strconv.FormatBool(v), true
+	case string:
+		return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(strings.TrimSpace(v)) + `"`, true
+	}
+	return "", false
+}
+
+// escape backslash-escapes the given characters of a measurement, tag or field key, or tag value
+func escape(s, chars string) string {
+	if !strings.ContainsAny(s, chars) {
+		return s
+	}
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(chars, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// write sends one batch, retrying on network errors and 429/5xx responses until the retries
+// or the retry time run out
+func (c *Client) write(ctx context.Context, batch []byte) error {
+	body := batch
+	if c.gzip {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(batch); err != nil {
+			return fmt.Errorf("failed to compress batch: %w", err)
+		}
+		if err := zw.Close(); err != nil {
+			return fmt.Errorf("failed to compress batch: %w", err)
+		}
+		body = buf.Bytes()
+	}
+
+	backoff := c.backoff
+	start := time.Now()
+	for attempt := 0; ; attempt++ {
+		err := c.post(ctx, body)
+		if err == nil {
+			return nil
+		}
+		var statusErr *common.StatusError
+		if (errors.As(err, &statusErr) && !statusErr.Retryable()) || attempt >= c.maxRetries {
+			return err
+		}
+
+		delay := backoff
+		if statusErr != nil && statusErr.RetryAfter > 0 {
+			delay = statusErr.RetryAfter
+		}
+		if c.retryTime > 0 && time.Since(start)+delay > c.retryTime {
+			return fmt.Errorf("gave up retrying after %v: %w", time.Since(start).Round(time.Millisecond), err)
+		}
+		select {
+		case <-time.After(delay):
+			backoff *= 2
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// post sends a single request
+func (c *Client) post(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.writeURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if c.gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Token "+c.token)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// InfluxDB answers 204 on success
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return common.NewStatusError("influxdb", resp)
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+// ping checks that the server is reachable. UDP isn't acknowledged, so there is nothing to check.
+func (c *Client) ping(ctx context.Context) error {
+	if c.conn != nil {
+		return nil
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.pingURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return common.NewStatusError("influxdb", resp)
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+// sendUDP packs lines into datagrams. Delivery isn't acknowledged, so there are no retries.
+func (c *Client) sendUDP(lines [][]byte) error {
+	var datagram []byte
+	for _, line := range lines {
+		if len(datagram) > 0 && len(datagram)+len(line) > maxDatagramSize {
+			if _, err := c.conn.Write(datagram); err != nil {
+				return fmt.Errorf("failed to send datagram: %w", err)
+			}
+			datagram = datagram[:0]
+		}
+		datagram = append(datagram, line...)
+	}
+	if _, err := c.conn.Write(datagram); err != nil {
+		return fmt.Errorf("failed to send datagram: %w", err)
+	}
+	return nil
+}
+
+// Close closes the UDP socket
+func (c *Client) Close() {
+	if c.conn != nil {
+		c.conn.Close()
+	}
+}
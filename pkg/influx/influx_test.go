@@ -0,0 +1,311 @@
+package influx
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rknightion/adsb2loki/pkg/common"
+)
+
+var testTime = time.Unix(1748083431, 500)
+
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		name  string
+		cfg   Config
+		entry common.LogEntry
+		want  string // Empty when the entry isn't written
+	}{
+		{
+			name: "defaults",
+			cfg:  Config{Receiver: "home"},
+			entry: common.LogEntry{
+				Timestamp:          testTime,
+				Labels:             map[string]string{"app": "flightaware"},
+				Line:               `{"hex":"4ca614","alt_baro":38000,"gs":451.2,"rssi":-21.5,"lat":51.47,"lon":-0.4543,"squawk":"1234"}`,
+				StructuredMetadata: map[string]string{"hex": "4ca614", "flight": "EIN581  ", "category": "A3"},
+			},
+			want: "aircraft,category=A3,hex=4ca614,receiver=home alt_baro=38000,gs=451.2,rssi=-21.5,lat=51.47,lon=-0.4543 1748083431000000500\n",
+		},
+		{
+			name: "receiver label",
+			cfg:  Config{Receiver: "home"},
+			entry: common.LogEntry{
+				Timestamp:          testTime,
+				Labels:             map[string]string{"app": "flightaware", "receiver": "west site"},
+				Line:               `{"hex":"4ca614","gs":100}`,
+				StructuredMetadata: map[string]string{"hex": "4ca614"},
+			},
+			want: "aircraft,hex=4ca614,receiver=west\\ site gs=100 1748083431000000500\n",
+		},
+		{
+			name: "on the ground",
+			cfg:  Config{Fields: []string{"alt_baro", "gs"}},
+			entry: common.LogEntry{
+				Timestamp:          testTime,
+				Labels:             map[string]string{"app": "flightaware"},
+				Line:               `{"hex":"4ca614","alt_baro":"ground","gs":12}`,
+				StructuredMetadata: map[string]string{"hex": "4ca614", "flight": "EIN581  ", "category": "A3"},
+			},
+			want: "aircraft,category=A3,hex=4ca614 on_ground=true,gs=12 1748083431000000500\n",
+		},
+		{
+			name: "custom tags and fields",
+			cfg:  Config{Measurement: "adsb planes", Tags: []string{"flight", "t"}, Fields: []string{"squawk", "alert", "mlat", "messages"}},
+			entry: common.LogEntry{
+				Timestamp:          testTime,
+				Labels:             map[string]string{"app": "flightaware"},
+				Line:               `{"hex":"4ca614","t":"A320","squawk":"7\"00","alert":1,"mlat":[],"messages":12345678}`,
+				StructuredMetadata: map[string]string{"hex": "4ca614", "flight": "EIN581  ", "category": "A3"},
+			},
+			want: "adsb\\ planes,flight=EIN581,t=A320 squawk=\"7\\\"00\",alert=1,messages=12345678 1748083431000000500\n",
+		},
+		{
+			name: "no fields",
+			cfg:  Config{},
+			entry: common.LogEntry{
+				Timestamp:          testTime,
+				Labels:             map[string]string{"app": "flightaware"},
+				Line:               `{"hex":"4ca614","flight":"EIN581"}`,
+				StructuredMetadata: map[string]string{"hex": "4ca614", "flight": "EIN581  ", "category": "A3"},
+			},
+		},
+		{
+			name: "event",
+			cfg:  Config{},
+			entry: common.LogEntry{
+				Labels:             map[string]string{"app": "flightaware", "event": "takeoff"},
+				Line:               `{"type":"takeoff","lat":51.47}`,
+				StructuredMetadata: map[string]string{"hex": "4ca614"},
+			},
+		},
+		{
+			name:  "statistics",
+			cfg:   Config{},
+			entry: common.LogEntry{Labels: map[string]string{"app": "flightaware", "source": "stats"}, Line: `{"now":1}`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.URL, tt.cfg.Bucket = "http://localhost:8086", "adsb"
+			c, err := NewClient(tt.cfg)
+			if err != nil {
+				t.Fatalf("Failed to create client: %v", err)
+			}
+			line, err := c.Encode(tt.entry)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if string(line) != tt.want {
+				t.Errorf("Expected %q, got %q", tt.want, line)
+			}
+		})
+	}
+}
+
+func TestPushLogsHTTP(t *testing.T) {
+	var mu sync.Mutex
+	var batches []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/influx/api/v2/write" {
+			t.Errorf("Unexpected path %s", r.URL.Path)
+		}
+		if q := r.URL.Query(); q.Get("org") != "home" || q.Get("bucket") != "adsb" || q.Get("precision") != "ns" {
+			t.Errorf("Unexpected query %s", r.URL.RawQuery)
+		}
+		if got := r.Header.Get("Authorization"); got != "Token secret" {
+			t.Errorf("Expected the token, got %q", got)
+		}
+		if r.Header.Get("Content-Encoding") != "gzip" {
+			t.Error("Expected a gzip compressed body")
+		}
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			t.Fatalf("Failed to decompress: %v", err)
+		}
+		body, _ := io.ReadAll(zr)
+		mu.Lock()
+		batches = append(batches, string(body))
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	c, err := NewClient(Config{URL: server.URL + "/influx/", Org: "home", Bucket: "adsb", Token: "secret", BatchSize: 2, Gzip: true})
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	var entries []common.LogEntry
+	for i := range 5 {
+		entries = append(entries, common.LogEntry{
+			Timestamp:          testTime,
+			Labels:             map[string]string{"app": "flightaware"},
+			Line:               `{"gs":100}`,
+			StructuredMetadata: map[string]string{"hex": fmt.Sprintf("%06x", i), "category": "A3"},
+		})
+	}
+	entries = append(entries, common.LogEntry{Labels: map[string]string{"event": "lost"}, StructuredMetadata: map[string]string{"hex": "000001"}})
+	// An entry that isn't JSON is skipped without losing the others
+	entries = append(entries[:2], append([]common.LogEntry{{Timestamp: testTime, Line: `{"gs":`, StructuredMetadata: map[string]string{"hex": "bad001"}}}, entries[2:]...)...)
+	err = c.PushLogs(context.Background(), entries)
+	if err == nil || !strings.Contains(err.Error(), "1 invalid entries skipped") {
+		t.Errorf("Expected the invalid entry to be reported, got %v", err)
+	}
+
+	if len(batches) != 3 {
+		t.Fatalf("Expected 3 batches of at most 2 lines, got %q", batches)
+	}
+	if got := strings.Count(batches[0], "\n"); got != 2 {
+		t.Errorf("Expected 2 lines in the first batch, got %q", batches[0])
+	}
+	if !strings.HasPrefix(batches[2], "aircraft,category=A3,hex=000004 gs=100 ") {
+		t.Errorf("Unexpected last batch %q", batches[2])
+	}
+}
+
+func TestPushLogsRetries(t *testing.T) {
+	tests := []struct {
+		name      string
+		statuses  []int
+		retryTime time.Duration
+		wantErr   bool
+		attempts  int
+	}{
+		{name: "recovers", statuses: []int{http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusNoContent}, attempts: 3},
+		{name: "gives up", statuses: []int{500, 500, 500, 500, 500}, wantErr: true, attempts: 4},
+		{name: "invalid lines", statuses: []int{http.StatusBadRequest}, wantErr: true, attempts: 1},
+		{name: "out of time", statuses: []int{500, 500}, retryTime: time.Nanosecond, wantErr: true, attempts: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				status := tt.statuses[attempts]
+				attempts++
+				if status == http.StatusTooManyRequests {
+					w.Header().Set("Retry-After", "0")
+				}
+				w.WriteHeader(status)
+			}))
+			defer server.Close()
+
+			c, err := NewClient(Config{URL: server.URL, Bucket: "adsb", MaxRetries: 3, Backoff: time.Millisecond, RetryTime: tt.retryTime})
+			if err != nil {
+				t.Fatalf("Failed to create client: %v", err)
+			}
+			entry := common.LogEntry{Timestamp: testTime, Line: `{"gs":100}`, StructuredMetadata: map[string]string{"hex": "4ca614"}}
+			err = c.PushLogs(context.Background(), []common.LogEntry{entry})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if attempts != tt.attempts {
+				t.Errorf("Expected %d attempts, got %d", tt.attempts, attempts)
+			}
+		})
+	}
+}
+
+func TestPushLogsUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer conn.Close()
+
+	c, err := NewClient(Config{URL: "udp://" + conn.LocalAddr().String()})
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	defer c.Close()
+
+	var entries []common.LogEntry
+	for i := range 50 {
+		entries = append(entries, common.LogEntry{
+			Timestamp:          testTime,
+			Labels:             map[string]string{"app": "flightaware"},
+			Line:               `{"alt_baro":38000,"gs":451.2,"rssi":-21.5,"lat":51.47,"lon":-0.4543}`,
+			StructuredMetadata: map[string]string{"hex": fmt.Sprintf("%06x", i), "category": "A3"},
+		})
+	}
+	if err := c.PushLogs(context.Background(), entries); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	lines := 0
+	buf := make([]byte, 65536)
+	for lines < len(entries) {
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("Received %d lines, then: %v", lines, err)
+		}
+		if n > maxDatagramSize {
+			t.Errorf("Datagram of %d bytes exceeds %d", n, maxDatagramSize)
+		}
+		if buf[n-1] != '\n' {
+			t.Errorf("Datagram doesn't end with a complete line: %q", buf[:n])
+		}
+		lines += strings.Count(string(buf[:n]), "\n")
+	}
+	if lines != len(entries) {
+		t.Errorf("Expected %d lines, got %d", len(entries), lines)
+	}
+}
+
+func TestNewClientErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+	}{
+		{name: "no url", cfg: Config{}},
+		{name: "no bucket", cfg: Config{URL: "http://localhost:8086"}},
+		{name: "unsupported scheme", cfg: Config{URL: "tcp://localhost:8089", Bucket: "adsb"}},
+		{name: "udp without host", cfg: Config{URL: "udp:///tmp/influx.sock"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewClient(tt.cfg); err == nil {
+				t.Error("Expected error, got nil")
+			}
+		})
+	}
+}
+
+func TestPushLogsPushTest(t *testing.T) {
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.Method+" "+r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	c, err := NewClient(Config{URL: server.URL + "/influx", Bucket: "adsb"})
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	entry := common.LogEntry{
+		Timestamp:          testTime,
+		Labels:             map[string]string{"app": "flightaware", "source": common.PushTestSource},
+		Line:               `{"hex":"000000","gs":100}`,
+		StructuredMetadata: map[string]string{"hex": "000000"},
+	}
+	if err := c.PushLogs(context.Background(), []common.LogEntry{entry}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(paths) != 1 || paths[0] != "GET /influx/ping" {
+		t.Errorf("Expected a ping instead of a write, got %v", paths)
+	}
+}
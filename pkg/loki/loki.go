@@ -6,6 +6,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/rknightion/adsb2loki/pkg/common"
@@ -33,8 +36,9 @@ func (c *Client) PushLogs(ctx context.Context, entries []common.LogEntry) error
 		return nil
 	}
 
-	// Create the request payload
+	// Group entries with the same label set into one stream, keeping their order
 	streams := make([]map[string]interface{}, 0)
+	index := make(map[string]int)
 	for _, entry := range entries {
 		// Create value array - timestamp, line, and optionally structured metadata
 		value := []interface{}{
@@ -47,11 +51,16 @@ func (c *Client) PushLogs(ctx context.Context, entries []common.LogEntry) error
 			value = append(value, entry.StructuredMetadata)
 		}
 
-		stream := map[string]interface{}{
+		key := labelKey(entry.Labels)
+		if i, ok := index[key]; ok {
+			streams[i]["values"] = append(streams[i]["values"].([][]interface{}), value)
+			continue
+		}
+		index[key] = len(streams)
+		streams = append(streams, map[string]interface{}{
 			"stream": entry.Labels,
 			"values": [][]interface{}{value},
-		}
-		streams = append(streams, stream)
+		})
 	}
 
 	payload := map[string]interface{}{
@@ -78,5 +87,28 @@ func (c *Client) PushLogs(ctx context.Context, entries []common.LogEntry) error
 	}
 	defer resp.Body.Close()
 
+	// Loki answers 204 on success, report anything else so callers can retry
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return common.NewStatusError("loki", resp)
+	}
+
 	return nil
 }
+
+// labelKey returns a canonical string for a label set
+func labelKey(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, k := range keys {
+		b.WriteString(k)
+		b.WriteByte('=')
+		b.WriteString(strconv.Quote(labels[k]))
+		b.WriteByte(',')
+	}
+	return b.String()
+}
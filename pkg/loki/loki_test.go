@@ -3,6 +3,7 @@ package loki
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
 	"net/http/httptest"
@@ -125,9 +126,68 @@ func TestPushLogsServerError(t *testing.T) {
 		},
 	}
 
-	// Should not return error even on server error (current implementation doesn't check response)
 	err := client.PushLogs(context.Background(), entries)
-	if err != nil {
-		t.Errorf("Expected nil error, got %v", err)
+	var statusErr *common.StatusError
+	if !errors.As(err, &statusErr) {
+		t.Fatalf("Expected a StatusError, got %v", err)
+	}
+	if statusErr.StatusCode != http.StatusInternalServerError || !statusErr.Retryable() {
+		t.Errorf("Expected a retryable 500, got %+v", statusErr)
+	}
+}
+
+func TestPushLogsRateLimited(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "3")
+		http.Error(w, "ingestion rate limit exceeded", http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL)
+	err := client.PushLogs(context.Background(), []common.LogEntry{{Timestamp: time.Now(), Labels: map[string]string{"app": "test"}, Line: "test"}})
+
+	var statusErr *common.StatusError
+	if !errors.As(err, &statusErr) {
+		t.Fatalf("Expected a StatusError, got %v", err)
+	}
+	if statusErr.RetryAfter != 3*time.Second || !statusErr.Retryable() {
+		t.Errorf("Expected a retryable error after 3s, got %+v", statusErr)
+	}
+	if statusErr.Message != "ingestion rate limit exceeded" {
+		t.Errorf("Expected the response body as message, got %q", statusErr.Message)
+	}
+}
+
+func TestPushLogsGroupsStreams(t *testing.T) {
+	var payload struct {
+		Streams []struct {
+			Stream map[string]string `json:"stream"`
+			Values [][]interface{}   `json:"values"`
+		} `json:"streams"`
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Errorf("Failed to decode payload: %v", err)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	now := time.Now()
+	entries := []common.LogEntry{
+		{Timestamp: now, Labels: map[string]string{"app": "flightaware"}, Line: "a"},
+		{Timestamp: now, Labels: map[string]string{"app": "flightaware", "event": "new"}, Line: "b"},
+		{Timestamp: now.Add(time.Second), Labels: map[string]string{"app": "flightaware"}, Line: "c"},
+	}
+	if err := NewClient(server.URL).PushLogs(context.Background(), entries); err != nil {
+		t.Fatalf("Failed to push logs: %v", err)
+	}
+
+	if len(payload.Streams) != 2 {
+		t.Fatalf("Expected 2 streams, got %d", len(payload.Streams))
+	}
+	first := payload.Streams[0]
+	if len(first.Values) != 2 || first.Values[0][1] != "a" || first.Values[1][1] != "c" {
+		t.Errorf("Expected entries a and c in order in the first stream, got %v", first.Values)
 	}
 }
@@ -0,0 +1,269 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/rknightion/adsb2loki/pkg/common"
+	"github.com/rknightion/adsb2loki/pkg/models"
+	"github.com/rknightion/adsb2loki/pkg/stats"
+)
+
+// Namespace prefixes every metric name
+const Namespace = "adsb"
+
+// Metrics exposes aircraft and pipeline metrics in the Prometheus exposition format
+type Metrics struct {
+	registry *prometheus.Registry
+	stats    *stats.Collector
+	receiver *receiverCollector
+
+	fetches        *prometheus.CounterVec
+	fetchDuration  prometheus.Histogram
+	decodeFailures prometheus.Counter
+	entriesPushed  *prometheus.CounterVec
+	pushErrors     *prometheus.CounterVec
+	pushDuration   *prometheus.HistogramVec
+
+	rssi     prometheus.Histogram
+	distance prometheus.Histogram
+	altitude prometheus.Histogram
+}
+
+// New creates the metrics on their own registry, including the Go runtime and process collectors
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		stats:    stats.NewCollector(),
+		receiver: &receiverCollector{},
+		fetches: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "fetches_total",
+			Help:      "Number of aircraft.json fetches, by result",
+		}, []string{"result"}),
+		fetchDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: Namespace,
+			Name:      "fetch_duration_seconds",
+			Help:      "Duration of aircraft.json fetches",
+			Buckets:   prometheus.DefBuckets,
+		}),
+		decodeFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "decode_failures_total",
+			Help:      "Number of fetched snapshots that could not be decoded",
+		}),
+		entriesPushed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "entries_pushed_total",
+			Help:      "Number of log entries pushed, by sink",
+		}, []string{"sink"}),
+		pushErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "push_errors_total",
+			Help:      "Number of failed pushes, by sink",
+		}, []string{"sink"}),
+		pushDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: Namespace,
+			Name:      "push_duration_seconds",
+			Help:      "Duration of pushes, by sink",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"sink"}),
+		rssi: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: Namespace,
+			Name:      "aircraft_rssi_dbfs",
+			Help:      "Signal strength of received aircraft",
+			Buckets:   []float64{-45, -40, -35, -30, -25, -20, -15, -10, -5, 0},
+		}),
+		distance: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: Namespace,
+			Name:      "aircraft_distance_nautical_miles",
+			Help:      "Distance of aircraft from the receiver",
+			Buckets:   []float64{10, 25, 50, 75, 100, 150, 200, 250, 300},
+		}),
+		altitude: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: Namespace,
+			Name:      "aircraft_altitude_feet",
+			Help:      "Altitude of aircraft",
+			Buckets:   []float64{0, 1000, 5000, 10000, 20000, 30000, 40000, 50000},
+		}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.fetches,
+		m.fetchDuration,
+		m.decodeFailures,
+		m.entriesPushed,
+		m.pushErrors,
+		m.pushDuration,
+		m.rssi,
+		m.distance,
+		m.altitude,
+		&aircraftCollector{stats: m.stats},
+		m.receiver,
+	)
+
+	return m
+}
+
+// Handler returns the HTTP handler serving the metrics
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// RecordSnapshot updates the aircraft gauges and records the histograms for a snapshot
+func (m *Metrics) RecordSnapshot(_ context.Context, data *models.AutoGenerated, ts time.Time) {
+	s := m.stats.Update(data, ts)
+	for _, v := range s.RSSI {
+		m.rssi.Observe(v)
+	}
+	for _, v := range s.Distance {
+		m.distance.Observe(v)
+	}
+	for _, v := range s.Altitude {
+		m.altitude.Observe(v)
+	}
+}
+
+// RecordFetch records the result and duration of an aircraft.json fetch
+func (m *Metrics) RecordFetch(duration time.Duration, err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	m.fetches.WithLabelValues(result).Inc()
+	m.fetchDuration.Observe(duration.Seconds())
+}
+
+// RecordUnchanged records a fetch that returned the same snapshot as the previous one
+func (m *Metrics) RecordUnchanged(duration time.Duration) {
+	m.fetches.WithLabelValues("not_modified").Inc()
+	m.fetchDuration.Observe(duration.Seconds())
+}
+
+// RecordDecodeFailure counts a snapshot that could not be decoded
+func (m *Metrics) RecordDecodeFailure() {
+	m.decodeFailures.Inc()
+}
+
+// RegisterQueue exposes the depth of a queue and the number of entries it dropped
+func (m *Metrics) RegisterQueue(name string, depth func() int, dropped func() uint64) {
+	labels := prometheus.Labels{"queue": name}
+	m.registry.MustRegister(
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace:   Namespace,
+			Name:        "queue_depth",
+			Help:        "Number of entries waiting in a queue",
+			ConstLabels: labels,
+		}, func() float64 { return float64(depth()) }),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace:   Namespace,
+			Name:        "entries_dropped_total",
+			Help:        "Number of entries dropped because a queue was full",
+			ConstLabels: labels,
+		}, func() float64 { return float64(dropped()) }),
+	)
+}
+
+// Logger wraps a logger, recording the entries pushed, errors and latency under the given sink name
+func (m *Metrics) Logger(sink string, logger common.Logger) common.Logger {
+	return &instrumentedLogger{
+		logger:   logger,
+		pushed:   m.entriesPushed.WithLabelValues(sink),
+		errors:   m.pushErrors.WithLabelValues(sink),
+		duration: m.pushDuration.WithLabelValues(sink),
+	}
+}
+
+// instrumentedLogger records metrics for every push to the wrapped logger
+type instrumentedLogger struct {
+	logger   common.Logger
+	pushed   prometheus.Counter
+	errors   prometheus.Counter
+	duration prometheus.Observer
+}
+
+// PushLogs pushes the entries to the wrapped logger
+func (l *instrumentedLogger) PushLogs(ctx context.Context, entries []common.LogEntry) error {
+	start := time.Now()
+	err := l.logger.PushLogs(ctx, entries)
+	l.duration.Observe(time.Since(start).Seconds())
+
+	if err != nil {
+		l.errors.Inc()
+		return err
+	}
+	l.pushed.Add(float64(len(entries)))
+	return nil
+}
+
+// aircraftCollector reports the aircraft gauges from the latest snapshot, so categories and
+// sources that are no longer seen disappear instead of keeping their last value
+type aircraftCollector struct {
+	stats *stats.Collector
+}
+
+var (
+	aircraftDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(Namespace, "", "aircraft"),
+		"Number of aircraft currently tracked, by category",
+		[]string{"category"}, nil,
+	)
+	aircraftSourceDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(Namespace, "aircraft", "by_source"),
+		"Number of aircraft currently tracked, by source such as adsb_icao, mlat or tisb",
+		[]string{"source"}, nil,
+	)
+	aircraftPositionedDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(Namespace, "aircraft", "positioned"),
+		"Number of aircraft currently tracked, with and without a position",
+		[]string{"positioned"}, nil,
+	)
+	messageRateDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(Namespace, "messages", "per_second"),
+		"Messages per second received by the decoder",
+		nil, nil,
+	)
+	positionRateDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(Namespace, "positions", "per_second"),
+		"New aircraft positions per second",
+		nil, nil,
+	)
+)
+
+// Describe sends the descriptors of the aircraft gauges
+func (c *aircraftCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- aircraftDesc
+	ch <- aircraftSourceDesc
+	ch <- aircraftPositionedDesc
+	ch <- messageRateDesc
+	ch <- positionRateDesc
+}
+
+// Collect sends the aircraft gauges for the latest snapshot
+func (c *aircraftCollector) Collect(ch chan<- prometheus.Metric) {
+	s := c.stats.Latest()
+	if s.Time.IsZero() {
+		return
+	}
+
+	for category, n := range s.ByCategory {
+		ch <- prometheus.MustNewConstMetric(aircraftDesc, prometheus.GaugeValue, float64(n), category)
+	}
+	for source, n := range s.BySource {
+		ch <- prometheus.MustNewConstMetric(aircraftSourceDesc, prometheus.GaugeValue, float64(n), source)
+	}
+	ch <- prometheus.MustNewConstMetric(aircraftPositionedDesc, prometheus.GaugeValue, float64(s.Positioned), strconv.FormatBool(true))
+	ch <- prometheus.MustNewConstMetric(aircraftPositionedDesc, prometheus.GaugeValue, float64(s.Unpositioned), strconv.FormatBool(false))
+
+	if s.HasRates {
+		ch <- prometheus.MustNewConstMetric(messageRateDesc, prometheus.GaugeValue, s.MessageRate)
+		ch <- prometheus.MustNewConstMetric(positionRateDesc, prometheus.GaugeValue, s.PositionRate)
+	}
+}
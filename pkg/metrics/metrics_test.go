@@ -0,0 +1,128 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/rknightion/adsb2loki/pkg/common"
+	"github.com/rknightion/adsb2loki/pkg/models"
+)
+
+// mockLogger is a mock implementation of the Logger interface for testing
+type mockLogger struct {
+	err error
+}
+
+func (m *mockLogger) PushLogs(_ context.Context, _ []common.LogEntry) error {
+	return m.err
+}
+
+func TestRecordSnapshot(t *testing.T) {
+	m := New()
+
+	data := &models.AutoGenerated{
+		Now: 1700000000,
+		Aircraft: []models.Aircraft{
+			{Hex: "abc123", Category: "A3", Type: "adsb_icao", Lat: 51.5, Lon: -0.1, AltBaro: float64(35000), Rssi: -20, RDst: 40},
+			{Hex: "def456", Type: "mlat"},
+		},
+	}
+	m.RecordSnapshot(context.Background(), data, time.Now())
+
+	expected := `
+# HELP adsb_aircraft Number of aircraft currently tracked, by category
+# TYPE adsb_aircraft gauge
+adsb_aircraft{category="A3"} 1
+adsb_aircraft{category="unknown"} 1
+# HELP adsb_aircraft_positioned Number of aircraft currently tracked, with and without a position
+# TYPE adsb_aircraft_positioned gauge
+adsb_aircraft_positioned{positioned="false"} 1
+adsb_aircraft_positioned{positioned="true"} 1
+`
+	if err := testutil.GatherAndCompare(m.registry, strings.NewReader(expected), "adsb_aircraft", "adsb_aircraft_positioned"); err != nil {
+		t.Error(err)
+	}
+
+	if n := testutil.CollectAndCount(m.rssi); n != 1 {
+		t.Errorf("Expected 1 rssi histogram, got %d", n)
+	}
+}
+
+func TestRecordFetch(t *testing.T) {
+	m := New()
+
+	m.RecordFetch(100*time.Millisecond, nil)
+	m.RecordFetch(200*time.Millisecond, errors.New("timeout"))
+	m.RecordFetch(50*time.Millisecond, errors.New("bad json"))
+	m.RecordUnchanged(10 * time.Millisecond)
+	m.RecordDecodeFailure()
+
+	if v := testutil.ToFloat64(m.fetches.WithLabelValues("success")); v != 1 {
+		t.Errorf("Expected 1 successful fetch, got %v", v)
+	}
+	if v := testutil.ToFloat64(m.fetches.WithLabelValues("error")); v != 2 {
+		t.Errorf("Expected 2 failed fetches, got %v", v)
+	}
+	if v := testutil.ToFloat64(m.fetches.WithLabelValues("not_modified")); v != 1 {
+		t.Errorf("Expected 1 unchanged fetch, got %v", v)
+	}
+	if v := testutil.ToFloat64(m.decodeFailures); v != 1 {
+		t.Errorf("Expected 1 decode failure, got %v", v)
+	}
+}
+
+func TestLogger(t *testing.T) {
+	m := New()
+	entries := []common.LogEntry{{Line: "a"}, {Line: "b"}}
+
+	logger := m.Logger("loki", &mockLogger{})
+	if err := logger.PushLogs(context.Background(), entries); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	failing := m.Logger("otel", &mockLogger{err: errors.New("unavailable")})
+	if err := failing.PushLogs(context.Background(), entries); err == nil {
+		t.Error("Expected the wrapped logger's error")
+	}
+
+	if v := testutil.ToFloat64(m.entriesPushed.WithLabelValues("loki")); v != 2 {
+		t.Errorf("Expected 2 entries pushed to loki, got %v", v)
+	}
+	if v := testutil.ToFloat64(m.entriesPushed.WithLabelValues("otel")); v != 0 {
+		t.Errorf("Expected no entries pushed to otel, got %v", v)
+	}
+	if v := testutil.ToFloat64(m.pushErrors.WithLabelValues("otel")); v != 1 {
+		t.Errorf("Expected 1 push error for otel, got %v", v)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	m := New()
+	m.RegisterQueue("alerts", func() int { return 3 }, func() uint64 { return 7 })
+
+	server := httptest.NewServer(m.Handler())
+	defer server.Close()
+
+	resp, err := server.Client().Get(server.URL)
+	if err != nil {
+		t.Fatalf("Failed to scrape metrics: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	for _, want := range []string{
+		`adsb_queue_depth{queue="alerts"} 3`,
+		`adsb_entries_dropped_total{queue="alerts"} 7`,
+		`go_goroutines`,
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("Expected %q in metrics output", want)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package metrics
+
+import (
+	"context"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rknightion/adsb2loki/pkg/receiver"
+)
+
+// RecordReceiverStats keeps the latest stats.json for the receiver metrics
+func (m *Metrics) RecordReceiverStats(_ context.Context, s *receiver.Stats) {
+	m.receiver.latest.Store(s)
+}
+
+// receiverCollector reports the decoder's own counters from the latest stats.json. Counters come
+// from the total period, so they reset when the decoder restarts; gauges from the last minute.
+type receiverCollector struct {
+	latest atomic.Pointer[receiver.Stats]
+}
+
+var (
+	receiverMessagesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(Namespace, "receiver", "messages_total"),
+		"Number of messages received by the decoder",
+		nil, nil,
+	)
+	receiverMessagesByDFDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(Namespace, "receiver", "messages_by_df_total"),
+		"Number of messages received by the decoder, by downlink format",
+		[]string{"df"}, nil,
+	)
+	receiverModeSDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(Namespace, "receiver", "modes_messages_total"),
+		"Number of Mode S messages, by source (local or remote) and result",
+		[]string{"source", "result"}, nil,
+	)
+	receiverCPRDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(Namespace, "receiver", "cpr_decodes_total"),
+		"Number of CPR position decodes, by result",
+		[]string{"result"}, nil,
+	)
+	receiverTracksDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(Namespace, "receiver", "tracks_total"),
+		"Number of aircraft tracks created, by type",
+		[]string{"type"}, nil,
+	)
+	receiverSamplesDroppedDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(Namespace, "receiver", "samples_dropped_total"),
+		"Number of SDR samples dropped by the decoder",
+		nil, nil,
+	)
+	receiverSignalDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(Namespace, "receiver", "signal_dbfs"),
+		"Mean signal level over the last minute",
+		nil, nil,
+	)
+	receiverNoiseDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(Namespace, "receiver", "noise_dbfs"),
+		"Mean noise level over the last minute",
+		nil, nil,
+	)
+	receiverPeakSignalDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(Namespace, "receiver", "peak_signal_dbfs"),
+		"Peak signal level over the last minute",
+		nil, nil,
+	)
+	receiverStrongSignalsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(Namespace, "receiver", "strong_signals"),
+		"Number of messages above -3 dBFS in the last minute",
+		nil, nil,
+	)
+	receiverGainDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(Namespace, "receiver", "gain_db"),
+		"Current SDR gain",
+		nil, nil,
+	)
+)
+
+// Describe sends the descriptors of the receiver metrics
+func (c *receiverCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- receiverMessagesDesc
+	ch <- receiverMessagesByDFDesc
+	ch <- receiverModeSDesc
+	ch <- receiverCPRDesc
+	ch <- receiverTracksDesc
+	ch <- receiverSamplesDroppedDesc
+	ch <- receiverSignalDesc
+	ch <- receiverNoiseDesc
+	ch <- receiverPeakSignalDesc
+	ch <- receiverStrongSignalsDesc
+	ch <- receiverGainDesc
+}
+
+// Collect sends the receiver metrics for the latest stats.json
+func (c *receiverCollector) Collect(ch chan<- prometheus.Metric) {
+	s := c.latest.Load()
+	if s == nil {
+		return
+	}
+
+	if s.GainDB != nil {
+		ch <- prometheus.MustNewConstMetric(receiverGainDesc, prometheus.GaugeValue, *s.GainDB)
+	}
+
+	if total := s.Total; total != nil {
+		ch <- prometheus.MustNewConstMetric(receiverMessagesDesc, prometheus.CounterValue, float64(total.Messages))
+		for df, n := range total.MessagesByDF {
+			if n > 0 {
+				ch <- prometheus.MustNewConstMetric(receiverMessagesByDFDesc, prometheus.CounterValue, float64(n), strconv.Itoa(df))
+			}
+		}
+		for source, counts := range total.ModeSResults() {
+			for _, count := range counts {
+				ch <- prometheus.MustNewConstMetric(receiverModeSDesc, prometheus.CounterValue, float64(count.Value), source, count.Name)
+			}
+		}
+		if total.CPR != nil {
+			for _, count := range total.CPR.Results() {
+				ch <- prometheus.MustNewConstMetric(receiverCPRDesc, prometheus.CounterValue, float64(count.Value), count.Name)
+			}
+		}
+		if total.Tracks != nil {
+			ch <- prometheus.MustNewConstMetric(receiverTracksDesc, prometheus.CounterValue, float64(total.Tracks.All), "all")
+			ch <- prometheus.MustNewConstMetric(receiverTracksDesc, prometheus.CounterValue, float64(total.Tracks.SingleMessage), "single_message")
+		}
+		if total.Local != nil {
+			ch <- prometheus.MustNewConstMetric(receiverSamplesDroppedDesc, prometheus.CounterValue, float64(total.Local.SamplesDropped))
+		}
+	}
+
+	if minute := s.Last1Min; minute != nil && minute.Local != nil {
+		local := minute.Local
+		if local.Signal != nil {
+			ch <- prometheus.MustNewConstMetric(receiverSignalDesc, prometheus.GaugeValue, *local.Signal)
+		}
+		if local.Noise != nil {
+			ch <- prometheus.MustNewConstMetric(receiverNoiseDesc, prometheus.GaugeValue, *local.Noise)
+		}
+		if local.PeakSignal != nil {
+			ch <- prometheus.MustNewConstMetric(receiverPeakSignalDesc, prometheus.GaugeValue, *local.PeakSignal)
+		}
+		ch <- prometheus.MustNewConstMetric(receiverStrongSignalsDesc, prometheus.GaugeValue, float64(local.StrongSignals))
+	}
+}
@@ -0,0 +1,59 @@
+package metrics
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/rknightion/adsb2loki/pkg/receiver"
+)
+
+func TestRecordReceiverStats(t *testing.T) {
+	m := New()
+	if n, _ := testutil.GatherAndCount(m.registry, "adsb_receiver_messages_total"); n != 0 {
+		t.Errorf("Expected no receiver metrics before stats are recorded, got %d", n)
+	}
+
+	signal, noise, gain := -18.7, -33.2, 43.9
+	m.RecordReceiverStats(context.Background(), &receiver.Stats{
+		GainDB: &gain,
+		Last1Min: &receiver.Period{
+			Local: &receiver.Local{Signal: &signal, Noise: &noise, StrongSignals: 24},
+		},
+		Total: &receiver.Period{
+			Messages:     41220314,
+			MessagesByDF: []int64{1700000, 0, 0, 0, 7800000},
+			Local:        &receiver.Local{Accepted: []int64{40912331, 260108}, Bad: 438102391, SamplesDropped: 1024},
+			Tracks:       &receiver.Tracks{All: 20433, SingleMessage: 4122},
+		},
+	})
+
+	expected := `
+# HELP adsb_receiver_messages_by_df_total Number of messages received by the decoder, by downlink format
+# TYPE adsb_receiver_messages_by_df_total counter
+adsb_receiver_messages_by_df_total{df="0"} 1.7e+06
+adsb_receiver_messages_by_df_total{df="4"} 7.8e+06
+# HELP adsb_receiver_modes_messages_total Number of Mode S messages, by source (local or remote) and result
+# TYPE adsb_receiver_modes_messages_total counter
+adsb_receiver_modes_messages_total{result="accepted",source="local"} 4.1172439e+07
+adsb_receiver_modes_messages_total{result="bad",source="local"} 4.38102391e+08
+adsb_receiver_modes_messages_total{result="unknown_icao",source="local"} 0
+# HELP adsb_receiver_noise_dbfs Mean noise level over the last minute
+# TYPE adsb_receiver_noise_dbfs gauge
+adsb_receiver_noise_dbfs -33.2
+# HELP adsb_receiver_signal_dbfs Mean signal level over the last minute
+# TYPE adsb_receiver_signal_dbfs gauge
+adsb_receiver_signal_dbfs -18.7
+# HELP adsb_receiver_gain_db Current SDR gain
+# TYPE adsb_receiver_gain_db gauge
+adsb_receiver_gain_db 43.9
+`
+	names := []string{
+		"adsb_receiver_messages_by_df_total", "adsb_receiver_modes_messages_total",
+		"adsb_receiver_noise_dbfs", "adsb_receiver_signal_dbfs", "adsb_receiver_gain_db",
+	}
+	if err := testutil.GatherAndCompare(m.registry, strings.NewReader(expected), names...); err != nil {
+		t.Error(err)
+	}
+}
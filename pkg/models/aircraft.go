@@ -0,0 +1,73 @@
+package models
+
+import "strings"
+
+// AltitudeGround is the value readsb reports in alt_baro for aircraft on the ground
+const AltitudeGround = "ground"
+
+// Callsign returns the flight field without the padding readsb adds
+func (a *Aircraft) Callsign() string {
+	return strings.TrimSpace(a.Flight)
+}
+
+// OnGround reports whether the aircraft reports itself as being on the ground
+func (a *Aircraft) OnGround() bool {
+	s, ok := a.AltBaro.(string)
+	return ok && s == AltitudeGround
+}
+
+// Altitude returns the barometric altitude in feet, falling back to the geometric altitude.
+// Aircraft on the ground report an altitude of zero.
+func (a *Aircraft) Altitude() (float64, bool) {
+	if a.OnGround() {
+		return 0, true
+	}
+	if alt, ok := Float(a.AltBaro); ok {
+		return alt, true
+	}
+	return Float(a.AltGeom)
+}
+
+// VerticalRate returns the barometric vertical rate in feet per minute, falling back to the geometric rate
+func (a *Aircraft) VerticalRate() (float64, bool) {
+	if rate, ok := Float(a.BaroRate); ok {
+		return rate, true
+	}
+	return Float(a.GeomRate)
+}
+
+// Source returns how the aircraft is being received, e.g. adsb_icao, mlat or tisb_icao.
+// Older decoders without a type field are classified from the mlat and tisb field lists.
+func (a *Aircraft) Source() string {
+	switch {
+	case a.Type != "":
+		return a.Type
+	case len(a.Mlat) > 0:
+		return "mlat"
+	case len(a.Tisb) > 0:
+		return "tisb"
+	default:
+		return "unknown"
+	}
+}
+
+// HasPosition reports whether the aircraft has a decoded position
+func (a *Aircraft) HasPosition() bool {
+	return a.Lat != 0 || a.Lon != 0
+}
+
+// Float converts one of the mixed-type aircraft.json fields to a float64
+func Float(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	default:
+		return 0, false
+	}
+}
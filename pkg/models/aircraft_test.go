@@ -0,0 +1,79 @@
+package models
+
+import "testing"
+
+func TestAircraftAltitude(t *testing.T) {
+	tests := []struct {
+		name     string
+		aircraft Aircraft
+		expected float64
+		ok       bool
+		ground   bool
+	}{
+		{
+			name:     "barometric altitude",
+			aircraft: Aircraft{AltBaro: float64(35000), AltGeom: float64(35725)},
+			expected: 35000,
+			ok:       true,
+		},
+		{
+			name:     "geometric fallback",
+			aircraft: Aircraft{AltGeom: float64(12000)},
+			expected: 12000,
+			ok:       true,
+		},
+		{
+			name:     "on the ground",
+			aircraft: Aircraft{AltBaro: "ground"},
+			expected: 0,
+			ok:       true,
+			ground:   true,
+		},
+		{
+			name:     "no altitude",
+			aircraft: Aircraft{},
+			expected: 0,
+			ok:       false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			alt, ok := tt.aircraft.Altitude()
+			if ok != tt.ok {
+				t.Errorf("Expected ok=%v, got %v", tt.ok, ok)
+			}
+			if alt != tt.expected {
+				t.Errorf("Expected altitude %f, got %f", tt.expected, alt)
+			}
+			if tt.aircraft.OnGround() != tt.ground {
+				t.Errorf("Expected OnGround=%v, got %v", tt.ground, tt.aircraft.OnGround())
+			}
+		})
+	}
+}
+
+func TestAircraftCallsign(t *testing.T) {
+	aircraft := Aircraft{Flight: "DLH400  "}
+	if aircraft.Callsign() != "DLH400" {
+		t.Errorf("Expected callsign DLH400, got %q", aircraft.Callsign())
+	}
+}
+
+func TestAircraftSource(t *testing.T) {
+	tests := []struct {
+		aircraft Aircraft
+		expected string
+	}{
+		{Aircraft{Type: "adsb_icao"}, "adsb_icao"},
+		{Aircraft{Mlat: []interface{}{"lat", "lon"}}, "mlat"},
+		{Aircraft{Tisb: []interface{}{"lat"}}, "tisb"},
+		{Aircraft{}, "unknown"},
+	}
+
+	for _, tt := range tests {
+		if source := tt.aircraft.Source(); source != tt.expected {
+			t.Errorf("Expected source %s, got %s", tt.expected, source)
+		}
+	}
+}
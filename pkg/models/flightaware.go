@@ -1,72 +1,76 @@
 package models
 
 type AutoGenerated struct {
-	Now      float64 `json:"now"`
-	Messages int     `json:"messages"`
-	Aircraft []struct {
-		Hex            string        `json:"hex"`
-		Flight         string        `json:"flight,omitempty"`
-		AltBaro        interface{}   `json:"alt_baro,omitempty"`
-		AltGeom        interface{}   `json:"alt_geom,omitempty"`
-		Gs             interface{}   `json:"gs,omitempty"`
-		Ias            interface{}   `json:"ias,omitempty"`
-		Tas            interface{}   `json:"tas,omitempty"`
-		Mach           float64       `json:"mach,omitempty"`
-		Track          float64       `json:"track,omitempty"`
-		TrackRate      float64       `json:"track_rate,omitempty"`
-		Roll           float64       `json:"roll,omitempty"`
-		MagHeading     float64       `json:"mag_heading,omitempty"`
-		BaroRate       interface{}   `json:"baro_rate,omitempty"`
-		GeomRate       interface{}   `json:"geom_rate,omitempty"`
-		Squawk         string        `json:"squawk,omitempty"`
-		Emergency      string        `json:"emergency,omitempty"`
-		Category       string        `json:"category,omitempty"`
-		NavQnh         float64       `json:"nav_qnh,omitempty"`
-		NavAltitudeMcp interface{}   `json:"nav_altitude_mcp,omitempty"`
-		NavHeading     float64       `json:"nav_heading,omitempty"`
-		Lat            float64       `json:"lat,omitempty"`
-		Lon            float64       `json:"lon,omitempty"`
-		Nic            int           `json:"nic,omitempty"`
-		Rc             int           `json:"rc,omitempty"`
-		SeenPos        float64       `json:"seen_pos,omitempty"`
-		Version        int           `json:"version,omitempty"`
-		NicBaro        int           `json:"nic_baro,omitempty"`
-		NacP           int           `json:"nac_p,omitempty"`
-		NacV           int           `json:"nac_v,omitempty"`
-		Sil            int           `json:"sil,omitempty"`
-		SilType        string        `json:"sil_type,omitempty"`
-		Gva            int           `json:"gva,omitempty"`
-		Sda            int           `json:"sda,omitempty"`
-		Mlat           []interface{} `json:"mlat"`
-		Tisb           []interface{} `json:"tisb"`
-		Messages       int           `json:"messages"`
-		Seen           float64       `json:"seen"`
-		Rssi           float64       `json:"rssi"`
-		NavAltitudeFms interface{}   `json:"nav_altitude_fms,omitempty"`
-		NavModes       []string      `json:"nav_modes,omitempty"`
-		Type           string        `json:"type,omitempty"`
-		R              string        `json:"r,omitempty"`
-		T              string        `json:"t,omitempty"`
-		Desc           string        `json:"desc,omitempty"`
-		Wd             interface{}   `json:"wd,omitempty"`
-		Ws             interface{}   `json:"ws,omitempty"`
-		Oat            interface{}   `json:"oat,omitempty"`
-		Tat            interface{}   `json:"tat,omitempty"`
-		TrueHeading    float64       `json:"true_heading,omitempty"`
-		Alert          int           `json:"alert,omitempty"`
-		Spi            int           `json:"spi,omitempty"`
-		RDst           float64       `json:"r_dst,omitempty"`
-		RDir           float64       `json:"r_dir,omitempty"`
-		OwnOp          string        `json:"ownOp,omitempty"`
-		Year           string        `json:"year,omitempty"`
-		DbFlags        int           `json:"dbFlags,omitempty"`
-		CalcTrack      float64       `json:"calc_track,omitempty"`
-		LastPosition   *struct {
-			Lat     float64 `json:"lat"`
-			Lon     float64 `json:"lon"`
-			Nic     int     `json:"nic"`
-			Rc      int     `json:"rc"`
-			SeenPos float64 `json:"seen_pos"`
-		} `json:"lastPosition,omitempty"`
-	} `json:"aircraft"`
+	Now      float64    `json:"now"`
+	Messages int        `json:"messages"`
+	Aircraft []Aircraft `json:"aircraft"`
+}
+
+// Aircraft is a single entry of the aircraft array in aircraft.json
+type Aircraft struct {
+	Hex            string        `json:"hex"`
+	Flight         string        `json:"flight,omitempty"`
+	AltBaro        interface{}   `json:"alt_baro,omitempty"`
+	AltGeom        interface{}   `json:"alt_geom,omitempty"`
+	Gs             interface{}   `json:"gs,omitempty"`
+	Ias            interface{}   `json:"ias,omitempty"`
+	Tas            interface{}   `json:"tas,omitempty"`
+	Mach           float64       `json:"mach,omitempty"`
+	Track          float64       `json:"track,omitempty"`
+	TrackRate      float64       `json:"track_rate,omitempty"`
+	Roll           float64       `json:"roll,omitempty"`
+	MagHeading     float64       `json:"mag_heading,omitempty"`
+	BaroRate       interface{}   `json:"baro_rate,omitempty"`
+	GeomRate       interface{}   `json:"geom_rate,omitempty"`
+	Squawk         string        `json:"squawk,omitempty"`
+	Emergency      string        `json:"emergency,omitempty"`
+	Category       string        `json:"category,omitempty"`
+	NavQnh         float64       `json:"nav_qnh,omitempty"`
+	NavAltitudeMcp interface{}   `json:"nav_altitude_mcp,omitempty"`
+	NavHeading     float64       `json:"nav_heading,omitempty"`
+	Lat            float64       `json:"lat,omitempty"`
+	Lon            float64       `json:"lon,omitempty"`
+	Nic            int           `json:"nic,omitempty"`
+	Rc             int           `json:"rc,omitempty"`
+	SeenPos        float64       `json:"seen_pos,omitempty"`
+	Version        int           `json:"version,omitempty"`
+	NicBaro        int           `json:"nic_baro,omitempty"`
+	NacP           int           `json:"nac_p,omitempty"`
+	NacV           int           `json:"nac_v,omitempty"`
+	Sil            int           `json:"sil,omitempty"`
+	SilType        string        `json:"sil_type,omitempty"`
+	Gva            int           `json:"gva,omitempty"`
+	Sda            int           `json:"sda,omitempty"`
+	Mlat           []interface{} `json:"mlat"`
+	Tisb           []interface{} `json:"tisb"`
+	Messages       int           `json:"messages"`
+	Seen           float64       `json:"seen"`
+	Rssi           float64       `json:"rssi"`
+	NavAltitudeFms interface{}   `json:"nav_altitude_fms,omitempty"`
+	NavModes       []string      `json:"nav_modes,omitempty"`
+	Type           string        `json:"type,omitempty"`
+	R              string        `json:"r,omitempty"`
+	T              string        `json:"t,omitempty"`
+	Desc           string        `json:"desc,omitempty"`
+	Wd             interface{}   `json:"wd,omitempty"`
+	Ws             interface{}   `json:"ws,omitempty"`
+	Oat            interface{}   `json:"oat,omitempty"`
+	Tat            interface{}   `json:"tat,omitempty"`
+	TrueHeading    float64       `json:"true_heading,omitempty"`
+	Alert          int           `json:"alert,omitempty"`
+	Spi            int           `json:"spi,omitempty"`
+	RDst           float64       `json:"r_dst,omitempty"`
+	RDir           float64       `json:"r_dir,omitempty"`
+	OwnOp          string        `json:"ownOp,omitempty"`
+	Year           string        `json:"year,omitempty"`
+	DbFlags        int           `json:"dbFlags,omitempty"`
+	CalcTrack      float64       `json:"calc_track,omitempty"`
+	Receiver       string        `json:"receiver,omitempty"` // Set by inputs merging several receivers, such as MQTT
+	LastPosition   *struct {
+		Lat     float64 `json:"lat"`
+		Lon     float64 `json:"lon"`
+		Nic     int     `json:"nic"`
+		Rc      int     `json:"rc"`
+		SeenPos float64 `json:"seen_pos"`
+	} `json:"lastPosition,omitempty"`
 }
@@ -0,0 +1,43 @@
+package models
+
+import (
+	"sort"
+	"time"
+)
+
+// Track is the latest state of one aircraft assembled from a feed
+type Track struct {
+	Aircraft Aircraft
+	Seen     time.Time // Last message
+	SeenPos  time.Time // Last position, zero without a position
+}
+
+// Tracks holds the tracks of a feed by hex. It isn't safe for concurrent use.
+type Tracks map[string]*Track
+
+// Snapshot returns the aircraft seen within timeout as of now, ordered by hex, and removes the
+// others. seen and seen_pos are set to the ages of the last message and position.
+func (t Tracks) Snapshot(now time.Time, timeout time.Duration) []Aircraft {
+	aircraft := make([]Aircraft, 0, len(t))
+	for hex, tr := range t {
+		if now.Sub(tr.Seen) > timeout {
+			delete(t, hex)
+			continue
+		}
+		a := tr.Aircraft
+		a.Seen = roundTenth(now.Sub(tr.Seen))
+		if !tr.SeenPos.IsZero() {
+			a.SeenPos = roundTenth(now.Sub(tr.SeenPos))
+		}
+		aircraft = append(aircraft, a)
+	}
+	sort.Slice(aircraft, func(i, j int) bool {
+		return aircraft[i].Hex < aircraft[j].Hex
+	})
+	return aircraft
+}
+
+// roundTenth returns d in seconds, rounded to a tenth like aircraft.json
+func roundTenth(d time.Duration) float64 {
+	return float64(d.Round(100*time.Millisecond)) / float64(time.Second)
+}
@@ -0,0 +1,29 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTracksSnapshot(t *testing.T) {
+	now := time.Unix(1748083431, 0)
+	tracks := Tracks{
+		"4ca614": {Aircraft: Aircraft{Hex: "4ca614"}, Seen: now.Add(-1234 * time.Millisecond), SeenPos: now.Add(-5 * time.Second)},
+		"43c6f1": {Aircraft: Aircraft{Hex: "43c6f1"}, Seen: now},
+		"abc123": {Aircraft: Aircraft{Hex: "abc123"}, Seen: now.Add(-2 * time.Minute)},
+	}
+
+	aircraft := tracks.Snapshot(now, time.Minute)
+	if len(aircraft) != 2 {
+		t.Fatalf("Expected 2 aircraft, got %+v", aircraft)
+	}
+	if a := aircraft[0]; a.Hex != "43c6f1" || a.Seen != 0 || a.SeenPos != 0 {
+		t.Errorf("Expected 43c6f1 without a position first, got %+v", a)
+	}
+	if a := aircraft[1]; a.Hex != "4ca614" || a.Seen != 1.2 || a.SeenPos != 5 {
+		t.Errorf("Expected 4ca614 seen 1.2s and positioned 5s ago, got %+v", a)
+	}
+	if _, ok := tracks["abc123"]; ok {
+		t.Error("Expected the expired track to be removed")
+	}
+}
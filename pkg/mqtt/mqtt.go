@@ -0,0 +1,252 @@
+// Package mqtt publishes aircraft updates to an MQTT broker, one topic per aircraft, and
+// subscribes to aircraft feeds published by other tools
+package mqtt
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/rknightion/adsb2loki/pkg/common"
+	"github.com/rknightion/adsb2loki/pkg/events"
+)
+
+// DefaultTopic is the default topic template of aircraft updates
+const DefaultTopic = "adsb/{receiver}/{hex}"
+
+// DefaultTimeout bounds connecting and waiting for a publish to be acknowledged
+const DefaultTimeout = 10 * time.Second
+
+// ErrNotConnected is returned while the client is reconnecting. Updates aren't queued in the
+// meantime, the next snapshot replaces them anyway.
+var ErrNotConnected = errors.New("not connected to MQTT broker")
+
+// Config configures the MQTT sink
+type Config struct {
+	Broker   string // tcp://, ssl://, ws:// or wss:// URL of the broker
+	ClientID string
+	Username string // Optional
+	Password string // Optional
+	TLS      *tls.Config
+
+	// Topic is the topic template, with {receiver}, {hex}, {flight} and {category} placeholders
+	Topic    string
+	Receiver string
+	QoS      byte
+	Retain   bool // Retain the last state of each aircraft, so new subscribers get it immediately
+	Timeout  time.Duration
+}
+
+// Client publishes aircraft entries to their topic and clears the topic when the aircraft is lost
+type Client struct {
+	client  paho.Client
+	topic   string
+	qos     byte
+	retain  bool
+	timeout time.Duration
+
+	receiver string
+	mu       sync.Mutex
+	topics   map[string]string // Last topic of each aircraft, cleared when it's lost
+}
+
+// NewClient connects to the broker. The client reconnects in the background whenever the
+// connection is lost, including when the broker isn't reachable at startup.
+func NewClient(cfg Config) (*Client, error) {
+	if cfg.Broker == "" {
+		return nil, errors.New("MQTT broker URL is required")
+	}
+	if cfg.QoS > 2 {
+		return nil, fmt.Errorf("invalid MQTT QoS %d, must be 0, 1 or 2", cfg.QoS)
+	}
+	if cfg.Topic == "" {
+		cfg.Topic = DefaultTopic
+	}
+	if strings.ContainsAny(strings.NewReplacer("{receiver}", "", "{hex}", "", "{flight}", "", "{category}", "").Replace(cfg.Topic), "+#") {
+		return nil, fmt.Errorf("invalid MQTT topic %q, wildcards can't be published to", cfg.Topic)
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+
+	c := &Client{
+		topic:    cfg.Topic,
+		qos:      cfg.QoS,
+		retain:   cfg.Retain,
+		timeout:  cfg.Timeout,
+		receiver: cfg.Receiver,
+		topics:   make(map[string]string),
+	}
+
+	opts := clientOptions(cfg.Broker, cfg.ClientID, cfg.Username, cfg.Password, cfg.TLS, cfg.Timeout).
+		SetOrderMatters(false).
+		SetOnConnectHandler(func(paho.Client) {
+			log.Printf("Connected to MQTT broker %s", cfg.Broker)
+		}).
+		SetConnectionLostHandler(func(_ paho.Client, err error) {
+			log.Printf("Lost connection to MQTT broker %s, reconnecting: %v", cfg.Broker, err)
+		})
+	c.client = paho.NewClient(opts)
+
+	// With ConnectRetry, the token only fails for invalid options; unreachable brokers are retried
+	token := c.client.Connect()
+	if token.WaitTimeout(cfg.Timeout) && token.Error() != nil {
+		return nil, fmt.Errorf("failed to connect to MQTT broker: %w", token.Error())
+	}
+	return c, nil
+}
+
+// clientOptions returns the options shared by publishing and subscribing clients, which
+// reconnect with backoff whenever the connection is lost
+func clientOptions(broker, clientID, username, password string, tlsConfig *tls.Config, timeout time.Duration) *paho.ClientOptions {
+	opts := paho.NewClientOptions().
+		AddBroker(broker).
+		SetClientID(clientID).
+		SetUsername(username).
+		SetPassword(password).
+		SetCleanSession(true).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetConnectRetryInterval(5 * time.Second).
+		SetMaxReconnectInterval(time.Minute).
+		SetConnectTimeout(timeout).
+		SetWriteTimeout(timeout)
+	if tlsConfig != nil {
+		opts.SetTLSConfig(tlsConfig)
+	}
+	return opts
+}
+
+// PushLogs publishes aircraft entries to their topic and an empty message to the topic of each
+// lost aircraft, which also clears its retained state. Other entries, such as events, alerts and
+// receiver statistics, aren't published.
+func (c *Client) PushLogs(ctx context.Context, entries []common.LogEntry) error {
+	if !c.client.IsConnectionOpen() {
+		return ErrNotConnected
+	}
+
+	var tokens []paho.Token
+	for _, entry := range entries {
+		hex := entry.StructuredMetadata["hex"]
+		if hex == "" {
+			continue
+		}
+		switch entry.Labels["event"] {
+		case "":
+			topic := c.render(entry)
+			// Push tests aren't retained, so they don't linger on the broker
+			if entry.Labels["source"] == common.PushTestSource {
+				tokens = append(tokens, c.client.Publish(topic, c.qos, false, entry.Line))
+				continue
+			}
+			if stale, ok := c.update(hex, topic); ok {
+				tokens = append(tokens, c.client.Publish(stale, c.qos, c.retain, []byte{}))
+			}
+			tokens = append(tokens, c.client.Publish(topic, c.qos, c.retain, entry.Line))
+		case string(events.Lost):
+			if topic, ok := c.forget(hex); ok {
+				tokens = append(tokens, c.client.Publish(topic, c.qos, c.retain, []byte{}))
+			}
+		}
+	}
+
+	return c.wait(ctx, tokens)
+}
+
+// wait waits for the publishes to complete, returning the first error
+func (c *Client) wait(ctx context.Context, tokens []paho.Token) error {
+	deadline := time.After(c.timeout)
+	for _, token := range tokens {
+		select {
+		case <-token.Done():
+			if err := token.Error(); err != nil {
+				return fmt.Errorf("failed to publish to MQTT broker: %w", err)
+			}
+		case <-deadline:
+			return errors.New("timed out publishing to MQTT broker")
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// render expands the topic template for an aircraft entry. {receiver} is the receiver the
+// aircraft was merged from, if the input has several, and the configured receiver otherwise.
+func (c *Client) render(entry common.LogEntry) string {
+	receiver := c.receiver
+	if r := entry.Labels["receiver"]; r != "" {
+		receiver = r
+	}
+	return strings.NewReplacer(
+		"{receiver}", topicLevel(receiver),
+		"{hex}", topicLevel(entry.StructuredMetadata["hex"]),
+		"{flight}", topicLevel(strings.TrimSpace(entry.StructuredMetadata["flight"])),
+		"{category}", topicLevel(entry.StructuredMetadata["category"]),
+	).Replace(c.topic)
+}
+
+// update records the topic of an aircraft, returning its previous topic if the aircraft moved,
+// e.g. when the template contains {flight} and the callsign was decoded
+func (c *Client) update(hex, topic string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	previous, ok := c.topics[hex]
+	c.topics[hex] = topic
+	return previous, ok && previous != topic
+}
+
+// forget removes an aircraft, returning its last topic
+func (c *Client) forget(hex string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	topic, ok := c.topics[hex]
+	delete(c.topics, hex)
+	return topic, ok
+}
+
+// topicLevel makes a value safe to use within a topic level, replacing separators and
+// wildcards. Empty values become "unknown".
+func topicLevel(s string) string {
+	if s == "" {
+		return "unknown"
+	}
+	return strings.NewReplacer("/", "_", "+", "_", "#", "_").Replace(s)
+}
+
+// Close disconnects from the broker, waiting briefly for pending publishes
+func (c *Client) Close() {
+	c.client.Disconnect(250)
+}
+
+// TLSConfig builds a TLS configuration from PEM files. caFile verifies the broker instead of
+// the system roots, certFile and keyFile authenticate the client. All are optional.
+func TLSConfig(caFile, certFile, keyFile string, insecureSkipVerify bool) (*tls.Config, error) {
+	cfg := &tls.Config{InsecureSkipVerify: insecureSkipVerify}
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read MQTT CA certificate: %w", err)
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", caFile)
+		}
+	}
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load MQTT client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
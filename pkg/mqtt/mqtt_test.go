@@ -0,0 +1,236 @@
+package mqtt
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	server "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/hooks/auth"
+	"github.com/mochi-mqtt/server/v2/listeners"
+	"github.com/rknightion/adsb2loki/pkg/common"
+	"github.com/rknightion/adsb2loki/pkg/testutil"
+)
+
+// startBroker starts an embedded broker on addr, ":0" for any port, and returns it with its
+// address. The broker is closed at the end of the test unless stop is called earlier.
+func startBroker(t *testing.T, addr string, tlsConfig *tls.Config, ledger *auth.Ledger) (broker *server.Server, address string, stop func()) {
+	t.Helper()
+	broker = server.New(&server.Options{
+		InlineClient: true,
+		Logger:       slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+	var err error
+	if ledger != nil {
+		err = broker.AddHook(new(auth.Hook), &auth.Options{Ledger: ledger})
+	} else {
+		err = broker.AddHook(new(auth.AllowHook), nil)
+	}
+	if err != nil {
+		t.Fatalf("Failed to add auth hook: %v", err)
+	}
+
+	tcp := listeners.NewTCP(listeners.Config{ID: "tcp", Address: addr, TLSConfig: tlsConfig})
+	if err := broker.AddListener(tcp); err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	go broker.Serve()
+	var once sync.Once
+	stop = func() { once.Do(func() { broker.Close() }) }
+	t.Cleanup(stop)
+	return broker, tcp.Address(), stop
+}
+
+// retained returns the retained payload of a topic, if any
+func retained(broker *server.Server, topic string) (string, bool) {
+	messages := broker.Topics.Messages(topic)
+	if len(messages) == 0 {
+		return "", false
+	}
+	return string(messages[0].Payload), true
+}
+
+// newTestClient connects a client and waits for the connection
+func newTestClient(t *testing.T, cfg Config) *Client {
+	t.Helper()
+	c, err := NewClient(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	t.Cleanup(c.Close)
+	return c
+}
+
+func TestPushLogs(t *testing.T) {
+	broker, addr, _ := startBroker(t, "127.0.0.1:0", nil, nil)
+	c := newTestClient(t, Config{Broker: "tcp://" + addr, ClientID: "test", Receiver: "home", QoS: 1, Retain: true})
+	testutil.WaitFor(t, "the connection", c.client.IsConnectionOpen)
+
+	ctx := context.Background()
+	entries := []common.LogEntry{
+		{Labels: map[string]string{"app": "flightaware"}, Line: `{"hex":"abc123","alt_baro":1000}`, StructuredMetadata: map[string]string{"hex": "abc123", "flight": "BAW12   "}},
+		{Labels: map[string]string{"app": "flightaware"}, Line: `{"hex":"def456"}`, StructuredMetadata: map[string]string{"hex": "def456"}},
+		{Labels: map[string]string{"app": "flightaware", "source": "stats"}, Line: `{"now":1}`},
+		{Labels: map[string]string{"app": "flightaware", "event": "takeoff"}, Line: `{}`, StructuredMetadata: map[string]string{"hex": "abc123"}},
+	}
+	if err := c.PushLogs(ctx, entries); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	update := common.LogEntry{Labels: map[string]string{"app": "flightaware"}, Line: `{"hex":"abc123","alt_baro":2000}`, StructuredMetadata: map[string]string{"hex": "abc123", "flight": "BAW12   "}}
+	if err := c.PushLogs(ctx, []common.LogEntry{update}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	testutil.WaitFor(t, "the retained state", func() bool {
+		payload, _ := retained(broker, "adsb/home/abc123")
+		return payload == `{"hex":"abc123","alt_baro":2000}`
+	})
+	if _, ok := retained(broker, "adsb/home/def456"); !ok {
+		t.Error("Expected retained state for def456")
+	}
+	if n := len(broker.Topics.Messages("#")); n != 2 {
+		t.Errorf("Expected only the 2 aircraft topics, got %d retained messages", n)
+	}
+
+	// Losing an aircraft clears its retained state
+	lost := common.LogEntry{Labels: map[string]string{"app": "flightaware", "event": "lost"}, Line: `{"type":"lost"}`, StructuredMetadata: map[string]string{"hex": "abc123"}}
+	if err := c.PushLogs(ctx, []common.LogEntry{lost}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	testutil.WaitFor(t, "the cleanup", func() bool {
+		_, ok := retained(broker, "adsb/home/abc123")
+		return !ok
+	})
+}
+
+func TestPushLogsTopicTemplate(t *testing.T) {
+	broker, addr, _ := startBroker(t, "127.0.0.1:0", nil, nil)
+	c := newTestClient(t, Config{Broker: "tcp://" + addr, Topic: "adsb/{receiver}/{flight}/{hex}", Receiver: "site/1", Retain: true})
+	testutil.WaitFor(t, "the connection", c.client.IsConnectionOpen)
+
+	ctx := context.Background()
+	entry := common.LogEntry{Labels: map[string]string{"app": "flightaware"}, Line: `{"hex":"abc123"}`, StructuredMetadata: map[string]string{"hex": "abc123"}}
+	if err := c.PushLogs(ctx, []common.LogEntry{entry}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	testutil.WaitFor(t, "the retained state", func() bool {
+		_, ok := retained(broker, "adsb/site_1/unknown/abc123")
+		return ok
+	})
+
+	// Once the callsign is decoded the aircraft moves topic, and the old one is cleared
+	entry.StructuredMetadata = map[string]string{"hex": "abc123", "flight": "BAW12   "}
+	if err := c.PushLogs(ctx, []common.LogEntry{entry}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	testutil.WaitFor(t, "the topic change", func() bool {
+		_, moved := retained(broker, "adsb/site_1/BAW12/abc123")
+		_, stale := retained(broker, "adsb/site_1/unknown/abc123")
+		return moved && !stale
+	})
+}
+
+func TestRender(t *testing.T) {
+	c := &Client{topic: DefaultTopic, receiver: "home"}
+	tests := []struct {
+		name   string
+		labels map[string]string
+		want   string
+	}{
+		{name: "configured receiver", labels: map[string]string{"app": "flightaware"}, want: "adsb/home/abc123"},
+		{name: "merged receiver", labels: map[string]string{"app": "flightaware", "receiver": "west"}, want: "adsb/west/abc123"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry := common.LogEntry{Labels: tt.labels, StructuredMetadata: map[string]string{"hex": "abc123"}}
+			if got := c.render(entry); got != tt.want {
+				t.Errorf("Expected topic %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestPushLogsReconnect(t *testing.T) {
+	_, addr, stop := startBroker(t, "127.0.0.1:0", nil, nil)
+	c := newTestClient(t, Config{Broker: "tcp://" + addr, Receiver: "home", Retain: true})
+	testutil.WaitFor(t, "the connection", c.client.IsConnectionOpen)
+
+	entry := common.LogEntry{Labels: map[string]string{"app": "flightaware"}, Line: `{}`, StructuredMetadata: map[string]string{"hex": "abc123"}}
+	stop()
+	testutil.WaitFor(t, "the disconnect", func() bool { return !c.client.IsConnectionOpen() })
+	if err := c.PushLogs(context.Background(), []common.LogEntry{entry}); !errors.Is(err, ErrNotConnected) {
+		t.Errorf("Expected ErrNotConnected, got %v", err)
+	}
+
+	// The client reconnects once the broker is back on the same address
+	broker, _, _ := startBroker(t, addr, nil, nil)
+	testutil.WaitFor(t, "the reconnection", c.client.IsConnectionOpen)
+	if err := c.PushLogs(context.Background(), []common.LogEntry{entry}); err != nil {
+		t.Fatalf("Unexpected error after reconnecting: %v", err)
+	}
+	testutil.WaitFor(t, "the retained state", func() bool {
+		_, ok := retained(broker, "adsb/home/abc123")
+		return ok
+	})
+}
+
+func TestAuthAndTLS(t *testing.T) {
+	// Borrow a self-signed certificate from httptest
+	srv := httptest.NewTLSServer(nil)
+	srv.Close()
+	roots := x509.NewCertPool()
+	roots.AddCert(srv.Certificate())
+
+	ledger := &auth.Ledger{Auth: auth.AuthRules{{Username: "adsb", Password: "secret", Allow: true}}}
+	broker, addr, _ := startBroker(t, "127.0.0.1:0", &tls.Config{Certificates: srv.TLS.Certificates}, ledger)
+
+	rejected := newTestClient(t, Config{
+		Broker: "ssl://" + addr, ClientID: "rejected", Username: "adsb", Password: "wrong",
+		TLS: &tls.Config{RootCAs: roots, ServerName: "example.com"}, Timeout: time.Second,
+	})
+	c := newTestClient(t, Config{
+		Broker: "ssl://" + addr, ClientID: "accepted", Username: "adsb", Password: "secret",
+		TLS: &tls.Config{RootCAs: roots, ServerName: "example.com"}, Receiver: "home", Retain: true,
+	})
+	testutil.WaitFor(t, "the connection", c.client.IsConnectionOpen)
+
+	entry := common.LogEntry{Labels: map[string]string{"app": "flightaware"}, Line: `{}`, StructuredMetadata: map[string]string{"hex": "abc123"}}
+	if err := c.PushLogs(context.Background(), []common.LogEntry{entry}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	testutil.WaitFor(t, "the retained state", func() bool {
+		_, ok := retained(broker, "adsb/home/abc123")
+		return ok
+	})
+
+	if err := rejected.PushLogs(context.Background(), nil); !errors.Is(err, ErrNotConnected) {
+		t.Errorf("Expected ErrNotConnected with the wrong password, got %v", err)
+	}
+}
+
+func TestNewClientErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+	}{
+		{name: "no broker", cfg: Config{}},
+		{name: "invalid qos", cfg: Config{Broker: "tcp://localhost:1883", QoS: 3}},
+		{name: "wildcard topic", cfg: Config{Broker: "tcp://localhost:1883", Topic: "adsb/+/{hex}"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewClient(tt.cfg); err == nil {
+				t.Error("Expected error, got nil")
+			}
+		})
+	}
+}
@@ -0,0 +1,202 @@
+package mqtt
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/rknightion/adsb2loki/pkg/models"
+)
+
+// Subscription is a topic filter carrying aircraft, and the receiver its messages come from
+type Subscription struct {
+	Filter   string // Topic filter, {receiver} is subscribed to as +
+	Receiver string // Fixed receiver name, empty to take it from the {receiver} level
+	level    int    // Topic level naming the receiver, -1 for a fixed name
+}
+
+// ParseSubscriptions parses a comma separated list of subscriptions. Each is either
+// "receiver=topic", or a topic whose {receiver} level names the receiver, such as
+// adsb/{receiver}/aircraft. Other topics are their own receiver name.
+func ParseSubscriptions(value string) ([]Subscription, error) {
+	var subs []Subscription
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		sub := Subscription{Filter: item, level: -1}
+		if name, topic, ok := strings.Cut(item, "="); ok {
+			sub.Receiver, sub.Filter = strings.TrimSpace(name), strings.TrimSpace(topic)
+			if sub.Receiver == "" || sub.Filter == "" {
+				return nil, fmt.Errorf("invalid MQTT subscription %q, expected receiver=topic", item)
+			}
+		}
+		levels := strings.Split(sub.Filter, "/")
+		for i, level := range levels {
+			if level == "{receiver}" {
+				if sub.level >= 0 || sub.Receiver != "" {
+					return nil, fmt.Errorf("invalid MQTT subscription %q, the receiver is named twice", item)
+				}
+				sub.level = i
+				levels[i] = "+"
+			} else if strings.Contains(level, "{") || strings.Contains(level, "}") {
+				return nil, fmt.Errorf("invalid MQTT subscription %q, only {receiver} can be a placeholder", item)
+			}
+		}
+		sub.Filter = strings.Join(levels, "/")
+		if sub.level < 0 && sub.Receiver == "" {
+			sub.Receiver = sub.Filter
+		}
+		subs = append(subs, sub)
+	}
+	if len(subs) == 0 {
+		return nil, errors.New("no MQTT topics to subscribe to")
+	}
+	return subs, nil
+}
+
+// receiver returns the receiver of a message received on topic
+func (s Subscription) receiver(topic string) string {
+	if s.level < 0 {
+		return s.Receiver
+	}
+	levels := strings.Split(topic, "/")
+	if s.level >= len(levels) {
+		return "unknown"
+	}
+	return levels[s.level]
+}
+
+// SubscriberConfig configures the MQTT input
+type SubscriberConfig struct {
+	Broker        string // tcp://, ssl://, ws:// or wss:// URL of the broker
+	ClientID      string
+	Username      string // Optional
+	Password      string // Optional
+	TLS           *tls.Config
+	Subscriptions []Subscription
+	QoS           byte
+	Timeout       time.Duration
+}
+
+// Subscriber merges the aircraft published on its subscriptions into a tracker. Messages are
+// handled in the order they arrive, and the subscriptions are renewed on every reconnection.
+type Subscriber struct {
+	Tracker *Tracker
+
+	client paho.Client
+	subs   []Subscription
+	qos    byte
+
+	mu  sync.Mutex
+	err error // Why the subscriber isn't receiving, nil while it is
+}
+
+// NewSubscriber creates a subscriber with a new tracker. It connects once Run is called.
+func NewSubscriber(cfg SubscriberConfig) (*Subscriber, error) {
+	if cfg.Broker == "" {
+		return nil, errors.New("MQTT broker URL is required")
+	}
+	if len(cfg.Subscriptions) == 0 {
+		return nil, errors.New("no MQTT topics to subscribe to")
+	}
+	if cfg.QoS > 2 {
+		return nil, fmt.Errorf("invalid MQTT QoS %d, must be 0, 1 or 2", cfg.QoS)
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+
+	s := &Subscriber{Tracker: NewTracker(), subs: cfg.Subscriptions, qos: cfg.QoS, err: ErrNotConnected}
+	opts := clientOptions(cfg.Broker, cfg.ClientID, cfg.Username, cfg.Password, cfg.TLS, cfg.Timeout).
+		SetOrderMatters(true).
+		SetOnConnectHandler(func(c paho.Client) {
+			log.Printf("Connected to MQTT broker %s", cfg.Broker)
+			s.subscribe(c)
+		}).
+		SetConnectionLostHandler(func(_ paho.Client, err error) {
+			log.Printf("Lost connection to MQTT broker %s, reconnecting: %v", cfg.Broker, err)
+			s.setErr(fmt.Errorf("connection lost: %w", err))
+		})
+	s.client = paho.NewClient(opts)
+	return s, nil
+}
+
+// subscribe subscribes to every topic. Sessions are clean, so this runs on every connection.
+func (s *Subscriber) subscribe(c paho.Client) {
+	filters := make(map[string]byte, len(s.subs))
+	for _, sub := range s.subs {
+		filters[sub.Filter] = s.qos
+	}
+	token := c.SubscribeMultiple(filters, s.handle)
+	// The handler runs on the client's goroutine, so wait for the acknowledgement elsewhere
+	go func() {
+		token.Wait()
+		if err := token.Error(); err != nil {
+			log.Printf("Failed to subscribe to MQTT topics: %v", err)
+			s.setErr(fmt.Errorf("failed to subscribe: %w", err))
+			return
+		}
+		s.setErr(nil)
+	}()
+}
+
+// handle merges a message into the tracker, attributing it to the first matching subscription
+func (s *Subscriber) handle(_ paho.Client, msg paho.Message) {
+	for _, sub := range s.subs {
+		if !matches(sub.Filter, msg.Topic()) {
+			continue
+		}
+		err := s.Tracker.Update(msg.Topic(), sub.receiver(msg.Topic()), msg.Payload(), msg.Retained(), time.Now())
+		if err != nil && !errors.Is(err, ErrStale) {
+			log.Printf("Skipping MQTT message on %s: %v", msg.Topic(), err)
+		}
+		return
+	}
+}
+
+// Run connects and receives messages until ctx is cancelled, then disconnects
+func (s *Subscriber) Run(ctx context.Context) {
+	s.client.Connect()
+	<-ctx.Done()
+	s.client.Disconnect(250)
+}
+
+// Snapshot returns the aircraft received within the tracker's timeout
+func (s *Subscriber) Snapshot(now time.Time) *models.AutoGenerated {
+	return s.Tracker.Snapshot(now)
+}
+
+// Err returns why the subscriber isn't receiving messages, or nil while it is
+func (s *Subscriber) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+func (s *Subscriber) setErr(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = err
+}
+
+// matches reports whether a topic matches a filter with + and # wildcards
+func matches(filter, topic string) bool {
+	filterLevels, topicLevels := strings.Split(filter, "/"), strings.Split(topic, "/")
+	for i, level := range filterLevels {
+		if level == "#" {
+			return true
+		}
+		if i >= len(topicLevels) || (level != "+" && level != topicLevels[i]) {
+			return false
+		}
+	}
+	return len(filterLevels) == len(topicLevels)
+}
@@ -0,0 +1,158 @@
+package mqtt
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/rknightion/adsb2loki/pkg/testutil"
+)
+
+func TestParseSubscriptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		topic   string // Topic a message arrives on
+		filter  string
+		want    string // Receiver of the message
+		wantErr bool
+	}{
+		{name: "named", value: "site1=remote/site1/aircraft.json", topic: "remote/site1/aircraft.json", filter: "remote/site1/aircraft.json", want: "site1"},
+		{name: "receiver level", value: "adsb/{receiver}/+", topic: "adsb/home/abc123", filter: "adsb/+/+", want: "home"},
+		{name: "plain topic", value: "feeds/#", topic: "feeds/a/b", filter: "feeds/#", want: "feeds/#"},
+		{name: "empty", value: " , ", wantErr: true},
+		{name: "empty receiver", value: "=adsb/#", wantErr: true},
+		{name: "receiver twice", value: "site1=adsb/{receiver}/+", wantErr: true},
+		{name: "unknown placeholder", value: "adsb/{hex}", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			subs, err := ParseSubscriptions(tt.value)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Expected error, got %+v", subs)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if len(subs) != 1 || subs[0].Filter != tt.filter {
+				t.Fatalf("Expected filter %q, got %+v", tt.filter, subs)
+			}
+			if !matches(subs[0].Filter, tt.topic) {
+				t.Errorf("Expected %q to match %q", subs[0].Filter, tt.topic)
+			}
+			if got := subs[0].receiver(tt.topic); got != tt.want {
+				t.Errorf("Expected receiver %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestMatches(t *testing.T) {
+	tests := []struct {
+		filter, topic string
+		want          bool
+	}{
+		{"adsb/+/aircraft", "adsb/home/aircraft", true},
+		{"adsb/+/aircraft", "adsb/home/other", false},
+		{"adsb/+", "adsb/home/abc123", false},
+		{"adsb/#", "adsb/home/abc123", true},
+		{"adsb/home", "adsb/home", true},
+		{"adsb/home/abc123", "adsb/home", false},
+	}
+
+	for _, tt := range tests {
+		if got := matches(tt.filter, tt.topic); got != tt.want {
+			t.Errorf("matches(%q, %q) = %v, want %v", tt.filter, tt.topic, got, tt.want)
+		}
+	}
+}
+
+func TestSubscriber(t *testing.T) {
+	broker, addr, stop := startBroker(t, "127.0.0.1:0", nil, nil)
+	subs, err := ParseSubscriptions("adsb/{receiver}/aircraft,west=remote/west.json")
+	if err != nil {
+		t.Fatalf("Failed to parse subscriptions: %v", err)
+	}
+	s, err := NewSubscriber(SubscriberConfig{Broker: "tcp://" + addr, ClientID: "input", Subscriptions: subs, QoS: 1})
+	if err != nil {
+		t.Fatalf("Failed to create subscriber: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.Run(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	testutil.WaitFor(t, "the subscription", func() bool { return s.Err() == nil })
+
+	// Messages on one topic are applied in order, the last state wins
+	for _, alt := range []string{"1000", "2000", "3000"} {
+		if err := broker.Publish("adsb/home/aircraft", []byte(`{"hex":"abc123","alt_baro":`+alt+`}`), false, 1); err != nil {
+			t.Fatalf("Failed to publish: %v", err)
+		}
+	}
+	if err := broker.Publish("remote/west.json", fmt.Appendf(nil, `{"now":%d,"messages":7,"aircraft":[{"hex":"def456"}]}`, time.Now().Unix()), false, 1); err != nil {
+		t.Fatalf("Failed to publish: %v", err)
+	}
+	if err := broker.Publish("other/topic", []byte(`{"hex":"ffffff"}`), false, 1); err != nil {
+		t.Fatalf("Failed to publish: %v", err)
+	}
+
+	testutil.WaitFor(t, "the aircraft", func() bool {
+		data := s.Snapshot(time.Now())
+		return len(data.Aircraft) == 2 && data.Aircraft[0].AltBaro == float64(3000)
+	})
+	data := s.Snapshot(time.Now())
+	if a := data.Aircraft[0]; a.Hex != "abc123" || a.Receiver != "home" {
+		t.Errorf("Unexpected aircraft %+v", a)
+	}
+	if a := data.Aircraft[1]; a.Hex != "def456" || a.Receiver != "west" {
+		t.Errorf("Unexpected aircraft %+v", a)
+	}
+
+	// The subscriptions are renewed once the broker is back
+	stop()
+	testutil.WaitFor(t, "the disconnect", func() bool { return s.Err() != nil })
+	broker, _, _ = startBroker(t, addr, nil, nil)
+	testutil.WaitFor(t, "the reconnection", func() bool { return s.Err() == nil })
+	if err := broker.Publish("adsb/roof/aircraft", []byte(`{"hex":"0a0b0c"}`), false, 1); err != nil {
+		t.Fatalf("Failed to publish: %v", err)
+	}
+	testutil.WaitFor(t, "the aircraft after reconnecting", func() bool {
+		for _, a := range s.Snapshot(time.Now()).Aircraft {
+			if a.Hex == "0a0b0c" && a.Receiver == "roof" {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+func TestNewSubscriberErrors(t *testing.T) {
+	subs := []Subscription{{Filter: "adsb/#", Receiver: "adsb/#", level: -1}}
+	tests := []struct {
+		name string
+		cfg  SubscriberConfig
+	}{
+		{name: "no broker", cfg: SubscriberConfig{Subscriptions: subs}},
+		{name: "no subscriptions", cfg: SubscriberConfig{Broker: "tcp://localhost:1883"}},
+		{name: "invalid qos", cfg: SubscriberConfig{Broker: "tcp://localhost:1883", Subscriptions: subs, QoS: 3}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewSubscriber(tt.cfg); err == nil {
+				t.Error("Expected error, got nil")
+			}
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package mqtt
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/rknightion/adsb2loki/pkg/models"
+)
+
+// DefaultAircraftTimeout is how long an aircraft stays in snapshots after its last message
+const DefaultAircraftTimeout = time.Minute
+
+// ErrStale is returned for messages older than the last one received on the same topic,
+// e.g. redeliveries after a reconnect
+var ErrStale = errors.New("stale message")
+
+// Tracker merges aircraft received on several topics into the latest state of each aircraft.
+// It is safe for concurrent use.
+type Tracker struct {
+	Timeout time.Duration
+
+	mu       sync.Mutex
+	aircraft models.Tracks
+	topics   map[string]topicState
+}
+
+// topicState is the latest snapshot received on a topic
+type topicState struct {
+	now      float64
+	messages int
+	received time.Time
+}
+
+// NewTracker creates a tracker with the default timeout
+func NewTracker() *Tracker {
+	return &Tracker{Timeout: DefaultAircraftTimeout, aircraft: make(models.Tracks), topics: make(map[string]topicState)}
+}
+
+// Update merges a payload received on topic at received. The payload is either aircraft.json
+// shaped, with an aircraft array, or a single aircraft. Aircraft are attributed to receiver.
+// Retained payloads are ignored unless they carry a now timestamp, since their age is unknown.
+// Empty payloads, which clear retained messages, are ignored.
+func (t *Tracker) Update(topic, receiver string, payload []byte, retained bool, received time.Time) error {
+	payload = bytes.TrimSpace(payload)
+	if len(payload) == 0 {
+		return nil
+	}
+
+	var probe struct {
+		Now      *float64        `json:"now"`
+		Aircraft json.RawMessage `json:"aircraft"`
+	}
+	if err := json.Unmarshal(payload, &probe); err != nil {
+		return fmt.Errorf("failed to decode message: %w", err)
+	}
+
+	var data models.AutoGenerated
+	if probe.Aircraft != nil {
+		if err := json.Unmarshal(payload, &data); err != nil {
+			return fmt.Errorf("failed to decode aircraft: %w", err)
+		}
+	} else {
+		var a models.Aircraft
+		if err := json.Unmarshal(payload, &a); err != nil {
+			return fmt.Errorf("failed to decode aircraft: %w", err)
+		}
+		if a.Hex == "" {
+			return errors.New("message has neither an aircraft array nor a hex")
+		}
+		data.Aircraft = []models.Aircraft{a}
+	}
+
+	if probe.Now == nil && retained {
+		return nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// Ages are relative to the sender's clock when it is known, bounded by the time of receipt
+	base := received
+	if probe.Now != nil {
+		last, ok := t.topics[topic]
+		if ok && *probe.Now <= last.now {
+			return ErrStale
+		}
+		state := topicState{now: *probe.Now, messages: last.messages, received: received}
+		if probe.Aircraft != nil {
+			state.messages = data.Messages
+		}
+		t.topics[topic] = state
+		if now := unixTime(*probe.Now); now.Before(received) {
+			base = now
+		}
+	}
+
+	for _, a := range data.Aircraft {
+		if a.Hex == "" {
+			continue
+		}
+		seen := base.Add(-seconds(a.Seen))
+		// The same aircraft may be heard by several receivers, the freshest report wins
+		if tr, ok := t.aircraft[a.Hex]; ok && seen.Before(tr.Seen) {
+			continue
+		}
+		tr := &models.Track{Aircraft: a, Seen: seen}
+		if a.Lat != 0 || a.Lon != 0 {
+			tr.SeenPos = base.Add(-seconds(a.SeenPos))
+		}
+		tr.Aircraft.Receiver = receiver
+		t.aircraft[a.Hex] = tr
+	}
+	return nil
+}
+
+// Snapshot returns the aircraft seen within the timeout as of now, ordered by hex, and removes the
+// others. Topics silent for longer than the timeout are forgotten, so their message counts no
+// longer add up.
+func (t *Tracker) Snapshot(now time.Time) *models.AutoGenerated {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	snapshot := &models.AutoGenerated{
+		Now:      float64(now.UnixNano()) / float64(time.Second),
+		Aircraft: t.aircraft.Snapshot(now, t.Timeout),
+	}
+	for topic, state := range t.topics {
+		if now.Sub(state.received) > t.Timeout {
+			delete(t.topics, topic)
+			continue
+		}
+		snapshot.Messages += state.messages
+	}
+	return snapshot
+}
+
+// unixTime converts the fractional Unix seconds of aircraft.json to a time
+func unixTime(s float64) time.Time {
+	sec, frac := math.Modf(s)
+	return time.Unix(int64(sec), int64(frac*float64(time.Second)))
+}
+
+// seconds converts fractional seconds to a duration
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
@@ -0,0 +1,117 @@
+package mqtt
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTrackerUpdate(t *testing.T) {
+	start := time.Unix(1748083431, 0)
+	tracker := NewTracker()
+
+	// An aircraft.json snapshot, and a single aircraft from another receiver
+	snapshot := `{"now":1748083431.0,"messages":500,"aircraft":[{"hex":"4ca614","flight":"EIN581","seen":1.0},{"hex":"43c6f1","lat":51.5,"lon":-0.1,"seen":0.5,"seen_pos":2.0}]}`
+	if err := tracker.Update("remote/site1/aircraft.json", "site1", []byte(snapshot), false, start); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := tracker.Update("adsb/site2/abc123", "site2", []byte(`{"hex":"abc123","alt_baro":1000}`), false, start); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	data := tracker.Snapshot(start.Add(time.Second))
+	if data.Messages != 500 {
+		t.Errorf("Expected 500 messages, got %d", data.Messages)
+	}
+	if len(data.Aircraft) != 3 {
+		t.Fatalf("Expected 3 aircraft, got %+v", data.Aircraft)
+	}
+	// Ordered by hex
+	if a := data.Aircraft[0]; a.Hex != "43c6f1" || a.Receiver != "site1" || a.Seen != 1.5 || a.SeenPos != 3 {
+		t.Errorf("Unexpected first aircraft %+v", a)
+	}
+	if a := data.Aircraft[1]; a.Hex != "4ca614" || a.Seen != 2 || a.SeenPos != 0 {
+		t.Errorf("Unexpected second aircraft %+v", a)
+	}
+	if a := data.Aircraft[2]; a.Hex != "abc123" || a.Receiver != "site2" || a.Seen != 1 {
+		t.Errorf("Unexpected third aircraft %+v", a)
+	}
+
+	// A redelivered or reordered snapshot is older than the last one of its topic
+	older := `{"now":1748083430.0,"messages":400,"aircraft":[{"hex":"4ca614","flight":"OLD","seen":0}]}`
+	if err := tracker.Update("remote/site1/aircraft.json", "site1", []byte(older), false, start.Add(time.Second)); !errors.Is(err, ErrStale) {
+		t.Errorf("Expected ErrStale, got %v", err)
+	}
+
+	// The freshest report of an aircraft wins, whichever receiver sent it
+	if err := tracker.Update("adsb/site2/4ca614", "site2", []byte(`{"hex":"4ca614","flight":"EIN581","seen":0}`), false, start.Add(2*time.Second)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := tracker.Update("adsb/site3/4ca614", "site3", []byte(`{"hex":"4ca614","flight":"EIN581","seen":30}`), false, start.Add(2*time.Second)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	data = tracker.Snapshot(start.Add(2 * time.Second))
+	if a := data.Aircraft[1]; a.Receiver != "site2" || a.Seen != 0 {
+		t.Errorf("Expected the site2 report, got %+v", a)
+	}
+
+	// Aircraft and the message counts of silent topics expire after the timeout
+	later := start.Add(2*time.Second + DefaultAircraftTimeout + time.Second)
+	data = tracker.Snapshot(later)
+	if len(data.Aircraft) != 0 {
+		t.Errorf("Expected all aircraft to expire, got %+v", data.Aircraft)
+	}
+	if data.Messages != 0 {
+		t.Errorf("Expected no messages from expired topics, got %d", data.Messages)
+	}
+	fresh := `{"now":1748083500.0,"messages":20,"aircraft":[]}`
+	if err := tracker.Update("remote/site4/aircraft.json", "site4", []byte(fresh), false, later); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if data = tracker.Snapshot(later); data.Messages != 20 {
+		t.Errorf("Expected 20 messages, got %d", data.Messages)
+	}
+}
+
+func TestTrackerRetained(t *testing.T) {
+	now := time.Unix(1748083431, 0)
+	tracker := NewTracker()
+
+	// Retained messages without a timestamp may be hours old
+	if err := tracker.Update("adsb/home/abc123", "home", []byte(`{"hex":"abc123"}`), true, now); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// Empty retained messages clear the topic
+	if err := tracker.Update("adsb/home/abc123", "home", nil, true, now); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// With a timestamp the age is known
+	retained := `{"now":1748083401.0,"aircraft":[{"hex":"def456","seen":1}]}`
+	if err := tracker.Update("remote/aircraft.json", "remote", []byte(retained), true, now); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	data := tracker.Snapshot(now)
+	if len(data.Aircraft) != 1 || data.Aircraft[0].Hex != "def456" || data.Aircraft[0].Seen != 31 {
+		t.Errorf("Expected only def456, seen 31s ago, got %+v", data.Aircraft)
+	}
+}
+
+func TestTrackerUpdateErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+	}{
+		{name: "invalid json", payload: `{"hex":`},
+		{name: "no hex", payload: `{"flight":"EIN581"}`},
+		{name: "invalid aircraft", payload: `{"now":1,"aircraft":{"hex":"abc123"}}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := NewTracker().Update("adsb", "home", []byte(tt.payload), false, time.Now()); err == nil {
+				t.Error("Expected error, got nil")
+			}
+		})
+	}
+}
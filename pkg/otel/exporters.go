@@ -0,0 +1,146 @@
+package otel
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploggrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploghttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdoutlog"
+	"go.opentelemetry.io/otel/exporters/stdout/stdoutmetric"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// Exporter names accepted in OTEL_LOGS_EXPORTER, OTEL_METRICS_EXPORTER and OTEL_TRACES_EXPORTER
+const (
+	ExporterOTLP    = "otlp"
+	ExporterConsole = "console"
+	ExporterNone    = "none"
+)
+
+// OTLP protocols accepted in OTEL_EXPORTER_OTLP_PROTOCOL and the per-signal variants
+const (
+	ProtocolHTTP = "http/protobuf"
+	ProtocolGRPC = "grpc"
+)
+
+// Signals as used in the environment variable names
+const (
+	signalLogs    = "LOGS"
+	signalMetrics = "METRICS"
+	signalTraces  = "TRACES"
+)
+
+// exporterFor returns the exporter selected for a signal by OTEL_<SIGNAL>_EXPORTER
+func exporterFor(signal, defaultExporter string) (string, error) {
+	exporter := strings.ToLower(strings.TrimSpace(os.Getenv("OTEL_" + signal + "_EXPORTER")))
+	switch exporter {
+	case "":
+		return defaultExporter, nil
+	case "stdout", "logging":
+		return ExporterConsole, nil
+	case ExporterOTLP, ExporterConsole, ExporterNone:
+		return exporter, nil
+	default:
+		return "", fmt.Errorf("invalid OTEL_%s_EXPORTER %q: must be otlp, console or none", signal, exporter)
+	}
+}
+
+// protocolFor returns the OTLP protocol for a signal, preferring the per-signal variable
+func protocolFor(signal string) (string, error) {
+	protocol := os.Getenv("OTEL_EXPORTER_OTLP_" + signal + "_PROTOCOL")
+	if protocol == "" {
+		protocol = os.Getenv("OTEL_EXPORTER_OTLP_PROTOCOL")
+	}
+
+	switch strings.ToLower(strings.TrimSpace(protocol)) {
+	case "", ProtocolHTTP, "http":
+		return ProtocolHTTP, nil
+	case ProtocolGRPC:
+		return ProtocolGRPC, nil
+	default:
+		return "", fmt.Errorf("unsupported OTLP protocol %q for %s: must be http/protobuf or grpc", protocol, strings.ToLower(signal))
+	}
+}
+
+// newLogExporter creates the log exporter, or nil when logs are disabled.
+// The OTLP exporters read endpoints, headers, compression and timeouts from the standard environment variables.
+func newLogExporter(ctx context.Context) (sdklog.Exporter, error) {
+	exporter, err := exporterFor(signalLogs, ExporterOTLP)
+	if err != nil {
+		return nil, err
+	}
+
+	switch exporter {
+	case ExporterNone:
+		return nil, nil
+	case ExporterConsole:
+		return stdoutlog.New()
+	}
+
+	protocol, err := protocolFor(signalLogs)
+	if err != nil {
+		return nil, err
+	}
+	if protocol == ProtocolGRPC {
+		return otlploggrpc.New(ctx)
+	}
+	return otlploghttp.New(ctx)
+}
+
+// newMetricExporter creates the metric exporter, or nil when metrics are disabled
+func newMetricExporter(ctx context.Context) (sdkmetric.Exporter, error) {
+	exporter, err := exporterFor(signalMetrics, ExporterOTLP)
+	if err != nil {
+		return nil, err
+	}
+
+	switch exporter {
+	case ExporterNone:
+		return nil, nil
+	case ExporterConsole:
+		return stdoutmetric.New()
+	}
+
+	protocol, err := protocolFor(signalMetrics)
+	if err != nil {
+		return nil, err
+	}
+	if protocol == ProtocolGRPC {
+		return otlpmetricgrpc.New(ctx)
+	}
+	return otlpmetrichttp.New(ctx)
+}
+
+// newSpanExporter creates the span exporter, or nil when traces are disabled, which is the default
+func newSpanExporter(ctx context.Context) (sdktrace.SpanExporter, error) {
+	exporter, err := exporterFor(signalTraces, ExporterNone)
+	if err != nil {
+		return nil, err
+	}
+
+	switch exporter {
+	case ExporterNone:
+		return nil, nil
+	case ExporterConsole:
+		return stdouttrace.New()
+	}
+
+	protocol, err := protocolFor(signalTraces)
+	if err != nil {
+		return nil, err
+	}
+	if protocol == ProtocolGRPC {
+		return otlptracegrpc.New(ctx)
+	}
+	return otlptracehttp.New(ctx)
+}
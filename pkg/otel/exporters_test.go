@@ -0,0 +1,194 @@
+package otel
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rknightion/adsb2loki/pkg/common"
+	collectorlogs "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	collectormetrics "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	"google.golang.org/grpc"
+)
+
+// testCollector is an in-process OTLP gRPC collector recording what it receives
+type testCollector struct {
+	collectorlogs.UnimplementedLogsServiceServer
+
+	mu      sync.Mutex
+	logs    []*collectorlogs.ExportLogsServiceRequest
+	metrics []*collectormetrics.ExportMetricsServiceRequest
+}
+
+func (c *testCollector) Export(_ context.Context, req *collectorlogs.ExportLogsServiceRequest) (*collectorlogs.ExportLogsServiceResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.logs = append(c.logs, req)
+	return &collectorlogs.ExportLogsServiceResponse{}, nil
+}
+
+// metricsServer adapts the collector to the metrics service, whose Export method clashes with the logs one
+type metricsServer struct {
+	collectormetrics.UnimplementedMetricsServiceServer
+	c *testCollector
+}
+
+func (m metricsServer) Export(_ context.Context, req *collectormetrics.ExportMetricsServiceRequest) (*collectormetrics.ExportMetricsServiceResponse, error) {
+	m.c.mu.Lock()
+	defer m.c.mu.Unlock()
+	m.c.metrics = append(m.c.metrics, req)
+	return &collectormetrics.ExportMetricsServiceResponse{}, nil
+}
+
+// startTestCollector starts a gRPC collector on a random local port and returns its endpoint
+func startTestCollector(t *testing.T) (*testCollector, string) {
+	t.Helper()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+
+	c := &testCollector{}
+	server := grpc.NewServer()
+	collectorlogs.RegisterLogsServiceServer(server, c)
+	collectormetrics.RegisterMetricsServiceServer(server, metricsServer{c: c})
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+
+	return c, "http://" + lis.Addr().String()
+}
+
+func TestNewClientGRPC(t *testing.T) {
+	collector, endpoint := startTestCollector(t)
+
+	t.Setenv("OTEL_EXPORTER_OTLP_PROTOCOL", "grpc")
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", endpoint)
+	t.Setenv("OTEL_EXPORTER_OTLP_INSECURE", "true")
+	t.Setenv("OTEL_EXPORTER_OTLP_COMPRESSION", "gzip")
+	t.Setenv("OTEL_TRACES_EXPORTER", "none")
+
+	ctx := context.Background()
+	client, err := NewClient(ctx, Resource{ServiceName: "test-service"})
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	entries := []common.LogEntry{
+		{
+			Timestamp: time.Now(),
+			Labels:    map[string]string{"app": "flightaware"},
+			Line:      `{"hex":"abc123","alt_baro":35000}`,
+		},
+	}
+	if err := client.PushLogs(ctx, entries); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Shutdown flushes the batch processor and the periodic reader
+	shutdownCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	if err := client.Shutdown(shutdownCtx); err != nil {
+		t.Fatalf("Failed to shutdown: %v", err)
+	}
+
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+
+	records := 0
+	for _, req := range collector.logs {
+		for _, rl := range req.ResourceLogs {
+			for _, sl := range rl.ScopeLogs {
+				records += len(sl.LogRecords)
+			}
+		}
+	}
+	if records != 1 {
+		t.Errorf("Expected the collector to receive 1 log record, got %d", records)
+	}
+	if len(collector.metrics) == 0 {
+		t.Error("collector received no metrics")
+	}
+}
+
+func TestExporterFor(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{name: "default", value: "", want: ExporterOTLP},
+		{name: "otlp", value: "otlp", want: ExporterOTLP},
+		{name: "console", value: "console", want: ExporterConsole},
+		{name: "stdout alias", value: "stdout", want: ExporterConsole},
+		{name: "none", value: " NONE ", want: ExporterNone},
+		{name: "invalid", value: "zipkin", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("OTEL_LOGS_EXPORTER", tt.value)
+			got, err := exporterFor(signalLogs, ExporterOTLP)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if got != tt.want {
+				t.Errorf("Expected exporter %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestProtocolFor(t *testing.T) {
+	tests := []struct {
+		name      string
+		general   string
+		perSignal string
+		want      string
+		wantErr   bool
+	}{
+		{name: "default", want: ProtocolHTTP},
+		{name: "general grpc", general: "grpc", want: ProtocolGRPC},
+		{name: "per-signal overrides general", general: "grpc", perSignal: "http/protobuf", want: ProtocolHTTP},
+		{name: "per-signal only", perSignal: "grpc", want: ProtocolGRPC},
+		{name: "http/json unsupported", general: "http/json", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("OTEL_EXPORTER_OTLP_PROTOCOL", tt.general)
+			t.Setenv("OTEL_EXPORTER_OTLP_METRICS_PROTOCOL", tt.perSignal)
+			got, err := protocolFor(signalMetrics)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if got != tt.want {
+				t.Errorf("Expected protocol %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestNewClientConsoleAndNone(t *testing.T) {
+	t.Setenv("OTEL_LOGS_EXPORTER", "console")
+	t.Setenv("OTEL_METRICS_EXPORTER", "none")
+	t.Setenv("OTEL_TRACES_EXPORTER", "none")
+
+	ctx := context.Background()
+	client, err := NewClient(ctx, Resource{ServiceName: "test-service"})
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	if client.Flights() != nil {
+		t.Errorf("Expected no flight tracer when traces are disabled, got %v", client.Flights())
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	if err := client.Shutdown(shutdownCtx); err != nil {
+		t.Errorf("Failed to shutdown: %v", err)
+	}
+}
@@ -0,0 +1,226 @@
+package otel
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rknightion/adsb2loki/pkg/alert"
+	"github.com/rknightion/adsb2loki/pkg/events"
+	"github.com/rknightion/adsb2loki/pkg/models"
+	"github.com/rknightion/adsb2loki/pkg/session"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// flightSpan is an open span for one flight session
+type flightSpan struct {
+	span      trace.Span
+	sessionID string
+	callsign  string
+	squawk    string
+	lastSeen  time.Time
+	lost      bool // Ended by a lost event while the session may still resume
+}
+
+// FlightTracer represents each flight session as a span, starting at first sight and ending when
+// the aircraft is lost or the session expires. An aircraft that is back before its session
+// expires gets a new span in the same session, linked to the previous one.
+type FlightTracer struct {
+	mu     sync.Mutex
+	tracer trace.Tracer
+	spans  map[string]*flightSpan // Keyed by hex
+}
+
+// NewFlightTracer creates a new flight tracer using the given tracer provider
+func NewFlightTracer(tp trace.TracerProvider) *FlightTracer {
+	return &FlightTracer{
+		tracer: tp.Tracer("adsb2loki"),
+		spans:  make(map[string]*flightSpan),
+	}
+}
+
+// Observe updates the span for an aircraft's session, starting one if needed
+func (f *FlightTracer) Observe(aircraft *models.Aircraft, sess session.Session, ts time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	fs, ok := f.spans[sess.Hex]
+	if ok && fs.sessionID != sess.ID {
+		// The previous session ended without being expired, close it at its last sighting
+		if !fs.lost {
+			fs.span.End(trace.WithTimestamp(fs.lastSeen))
+		}
+		ok = false
+	}
+	if !ok || fs.lost {
+		start := sess.FirstSeen
+		var links []trace.Link
+		if ok {
+			// Back within the session gap after being lost, the new span starts now
+			start = ts
+			links = append(links, trace.Link{SpanContext: fs.span.SpanContext()})
+		}
+		_, span := f.tracer.Start(context.Background(), spanName(sess),
+			trace.WithNewRoot(),
+			trace.WithSpanKind(trace.SpanKindInternal),
+			trace.WithTimestamp(start),
+			trace.WithLinks(links...),
+			trace.WithAttributes(
+				attribute.String("adsb.hex", sess.Hex),
+				attribute.String("adsb.session_id", sess.ID),
+			),
+		)
+		fs = &flightSpan{span: span, sessionID: sess.ID}
+		f.spans[sess.Hex] = fs
+	}
+
+	fs.lastSeen = ts
+
+	if sess.Callsign != fs.callsign {
+		fs.callsign = sess.Callsign
+		fs.span.SetName(spanName(sess))
+	}
+
+	// Squawk changes are notable on their own
+	if aircraft.Squawk != "" && aircraft.Squawk != fs.squawk {
+		if fs.squawk != "" {
+			fs.span.AddEvent("squawk_change", trace.WithTimestamp(ts), trace.WithAttributes(
+				attribute.String("adsb.squawk.previous", fs.squawk),
+				attribute.String("adsb.squawk", aircraft.Squawk),
+			))
+		}
+		fs.squawk = aircraft.Squawk
+	}
+
+	fs.span.SetAttributes(flightAttributes(aircraft, sess)...)
+}
+
+// RecordEvent adds a lifecycle event to the aircraft's span. A lost event ends the span.
+func (f *FlightTracer) RecordEvent(e events.Event) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	fs, ok := f.spans[e.Hex]
+	if !ok || fs.lost {
+		return
+	}
+
+	attrs := []attribute.KeyValue{}
+	if e.Phase != events.PhaseUnknown {
+		attrs = append(attrs, attribute.String("adsb.phase", string(e.Phase)))
+	}
+	if e.PreviousPhase != events.PhaseUnknown {
+		attrs = append(attrs, attribute.String("adsb.phase.previous", string(e.PreviousPhase)))
+	}
+	if e.Airport != "" {
+		attrs = append(attrs, attribute.String("adsb.airport", e.Airport))
+	}
+	if e.Altitude != nil {
+		attrs = append(attrs, attribute.Float64("adsb.altitude", *e.Altitude))
+	}
+	fs.span.AddEvent(string(e.Type), trace.WithTimestamp(e.Time), trace.WithAttributes(attrs...))
+
+	// The span is kept until the session expires, so a reappearance can be linked to it
+	if e.Type == events.Lost {
+		fs.span.End(trace.WithTimestamp(e.Time))
+		fs.lost = true
+	}
+}
+
+// RecordAlert adds an alert to the aircraft's span, marking the span as an error for emergencies
+func (f *FlightTracer) RecordAlert(a alert.Alert) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	fs, ok := f.spans[a.Hex]
+	if !ok || fs.lost {
+		return
+	}
+
+	fs.span.AddEvent("alert", trace.WithTimestamp(a.Time), trace.WithAttributes(
+		attribute.String("adsb.alert.reason", string(a.Reason)),
+		attribute.String("adsb.alert.detail", a.Detail),
+		attribute.String("adsb.alert.message", a.Message),
+	))
+	if a.Reason == alert.ReasonSquawk || a.Reason == alert.ReasonEmergency {
+		fs.span.SetStatus(codes.Error, a.Message)
+	}
+}
+
+// End ends the span for an expired session at its last sighting, unless it already ended when
+// the aircraft was lost
+func (f *FlightTracer) End(sess session.Session) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	fs, ok := f.spans[sess.Hex]
+	if !ok || fs.sessionID != sess.ID {
+		return
+	}
+	if !fs.lost {
+		fs.span.SetAttributes(flightAttributes(nil, sess)...)
+		fs.span.End(trace.WithTimestamp(sess.LastSeen))
+	}
+	delete(f.spans, sess.Hex)
+}
+
+// Close ends all open spans, used on shutdown so in-flight sessions are still exported
+func (f *FlightTracer) Close() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := time.Now()
+	for hex, fs := range f.spans {
+		if !fs.lost {
+			fs.span.End(trace.WithTimestamp(now))
+		}
+		delete(f.spans, hex)
+	}
+}
+
+// spanName names a flight span after the callsign, falling back to the hex
+func spanName(sess session.Session) string {
+	if sess.Callsign != "" {
+		return "flight " + sess.Callsign
+	}
+	return "flight " + sess.Hex
+}
+
+// flightAttributes returns the span attributes describing the aircraft and session aggregates
+func flightAttributes(aircraft *models.Aircraft, sess session.Session) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{
+		attribute.Int("adsb.samples", sess.Samples),
+	}
+	if sess.Callsign != "" {
+		attrs = append(attrs, attribute.String("adsb.flight", sess.Callsign))
+	}
+	if sess.HasAltitude {
+		attrs = append(attrs, attribute.Float64("adsb.altitude.max", sess.MaxAltitude))
+	}
+	if sess.HasDistance {
+		attrs = append(attrs, attribute.Float64("adsb.distance.min", sess.ClosestDistance))
+	}
+	if aircraft == nil {
+		return attrs
+	}
+
+	optional := map[string]string{
+		"adsb.registration":  aircraft.R,
+		"adsb.aircraft_type": aircraft.T,
+		"adsb.description":   aircraft.Desc,
+		"adsb.operator":      aircraft.OwnOp,
+		"adsb.category":      aircraft.Category,
+		"adsb.squawk":        aircraft.Squawk,
+		"adsb.source":        aircraft.Type,
+		"adsb.year":          aircraft.Year,
+		"adsb.emergency":     aircraft.Emergency,
+	}
+	for k, v := range optional {
+		if v != "" {
+			attrs = append(attrs, attribute.String(k, v))
+		}
+	}
+	return attrs
+}
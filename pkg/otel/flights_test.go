@@ -0,0 +1,159 @@
+package otel
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rknightion/adsb2loki/pkg/alert"
+	"github.com/rknightion/adsb2loki/pkg/events"
+	"github.com/rknightion/adsb2loki/pkg/models"
+	"github.com/rknightion/adsb2loki/pkg/session"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// attributeValue finds an attribute on an exported span
+func attributeValue(attrs []attribute.KeyValue, key string) (attribute.Value, bool) {
+	for _, kv := range attrs {
+		if string(kv.Key) == key {
+			return kv.Value, true
+		}
+	}
+	return attribute.Value{}, false
+}
+
+func TestFlightTracer(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	tracer := NewFlightTracer(tp)
+	sessions := session.NewTracker(time.Minute)
+
+	start := time.Unix(1748083431, 0)
+	aircraft := &models.Aircraft{Hex: "4ca614", Flight: "EIN581", R: "EI-FNG", T: "A333", Squawk: "6016", AltBaro: float64(39000)}
+
+	sess, _ := sessions.Observe(aircraft, start)
+	tracer.Observe(aircraft, sess, start)
+	tracer.RecordEvent(events.Event{Type: events.Takeoff, Time: start, Hex: "4ca614", Airport: "EIDW"})
+
+	aircraft.Squawk = "7700"
+	ts := start.Add(30 * time.Second)
+	sess, _ = sessions.Observe(aircraft, ts)
+	tracer.Observe(aircraft, sess, ts)
+	tracer.RecordAlert(alert.Alert{Reason: alert.ReasonSquawk, Detail: "7700 general emergency", Message: "EIN581 squawking 7700", Time: ts, Hex: "4ca614"})
+
+	if len(exporter.GetSpans()) != 0 {
+		t.Fatal("Expected no spans to be exported before the session ends")
+	}
+
+	// The session expires and the span ends at the last sighting
+	for _, ended := range sessions.Expire(ts.Add(2 * time.Minute)) {
+		tracer.End(ended)
+	}
+
+	spans := exporter.GetSpans()
+	if len(spans) != 1 {
+		t.Fatalf("Expected 1 span, got %d", len(spans))
+	}
+	span := spans[0]
+
+	if span.Name != "flight EIN581" {
+		t.Errorf("Expected span name 'flight EIN581', got %s", span.Name)
+	}
+	if !span.StartTime.Equal(start) || !span.EndTime.Equal(ts) {
+		t.Errorf("Expected span from %v to %v, got %v to %v", start, ts, span.StartTime, span.EndTime)
+	}
+	if span.Status.Code != codes.Error {
+		t.Errorf("Expected error status for emergency, got %v", span.Status.Code)
+	}
+
+	if v, ok := attributeValue(span.Attributes, "adsb.registration"); !ok || v.AsString() != "EI-FNG" {
+		t.Errorf("Expected adsb.registration EI-FNG, got %v", v)
+	}
+	if v, ok := attributeValue(span.Attributes, "adsb.session_id"); !ok || v.AsString() != sess.ID {
+		t.Errorf("Expected adsb.session_id %s, got %v", sess.ID, v)
+	}
+	if v, ok := attributeValue(span.Attributes, "adsb.altitude.max"); !ok || v.AsFloat64() != 39000 {
+		t.Errorf("Expected adsb.altitude.max 39000, got %v", v)
+	}
+
+	var names []string
+	for _, e := range span.Events {
+		names = append(names, e.Name)
+	}
+	expected := []string{"takeoff", "squawk_change", "alert"}
+	if len(names) != len(expected) {
+		t.Fatalf("Expected span events %v, got %v", expected, names)
+	}
+	for i := range expected {
+		if names[i] != expected[i] {
+			t.Errorf("Expected span events %v, got %v", expected, names)
+			break
+		}
+	}
+}
+
+func TestFlightTracerLost(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	tracer := NewFlightTracer(tp)
+	sessions := session.NewTracker(10 * time.Minute)
+
+	start := time.Unix(1748083431, 0)
+	aircraft := &models.Aircraft{Hex: "4ca614", Flight: "EIN581"}
+	sess, _ := sessions.Observe(aircraft, start)
+	tracer.Observe(aircraft, sess, start)
+
+	// The lost event ends the span although the session is still open
+	lost := start.Add(time.Minute)
+	tracer.RecordEvent(events.Event{Type: events.Lost, Time: lost, Hex: "4ca614"})
+	spans := exporter.GetSpans()
+	if len(spans) != 1 || !spans[0].EndTime.Equal(lost) {
+		t.Fatalf("Expected 1 span ending at %v, got %v", lost, spans)
+	}
+	if spanEvents := spans[0].Events; len(spanEvents) != 1 || spanEvents[0].Name != "lost" {
+		t.Errorf("Expected the lost span event, got %v", spanEvents)
+	}
+
+	// Back within the session gap, a new span of the same session links to the first one
+	back := start.Add(3 * time.Minute)
+	resumed, _ := sessions.Observe(aircraft, back)
+	if resumed.ID != sess.ID {
+		t.Fatalf("Expected session %s to resume, got %s", sess.ID, resumed.ID)
+	}
+	tracer.Observe(aircraft, resumed, back)
+	for _, ended := range sessions.Expire(back.Add(time.Hour)) {
+		tracer.End(ended)
+	}
+
+	spans = exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("Expected 2 spans, got %d", len(spans))
+	}
+	second := spans[1]
+	if !second.StartTime.Equal(back) || !second.EndTime.Equal(back) {
+		t.Errorf("Expected the second span to start and end at %v, got %v to %v", back, second.StartTime, second.EndTime)
+	}
+	if len(second.Links) != 1 || second.Links[0].SpanContext.SpanID() != spans[0].SpanContext.SpanID() {
+		t.Errorf("Expected a link to the first span, got %v", second.Links)
+	}
+	if v, ok := attributeValue(second.Attributes, "adsb.session_id"); !ok || v.AsString() != sess.ID {
+		t.Errorf("Expected adsb.session_id %s, got %v", sess.ID, v)
+	}
+}
+
+func TestFlightTracerClose(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	tracer := NewFlightTracer(tp)
+
+	sess := session.Session{ID: "abc123-1", Hex: "abc123", FirstSeen: time.Now()}
+	tracer.Observe(&models.Aircraft{Hex: "abc123"}, sess, time.Now())
+	tracer.Close()
+
+	spans := exporter.GetSpans()
+	if len(spans) != 1 || spans[0].Name != "flight abc123" {
+		t.Errorf("Expected open span to be ended on close, got %v", spans)
+	}
+}
@@ -0,0 +1,152 @@
+package otel
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/rknightion/adsb2loki/pkg/models"
+	"github.com/rknightion/adsb2loki/pkg/stats"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// snapshotMetrics holds the instruments derived from aircraft snapshots
+type snapshotMetrics struct {
+	stats    *stats.Collector
+	rssi     metric.Float64Histogram
+	distance metric.Float64Histogram
+	altitude metric.Float64Histogram
+}
+
+// newSnapshotMetrics creates the snapshot instruments. Gauges report the latest snapshot when collected.
+func newSnapshotMetrics(meter metric.Meter) (*snapshotMetrics, error) {
+	m := &snapshotMetrics{stats: stats.NewCollector()}
+
+	var err error
+	m.rssi, err = meter.Float64Histogram(
+		"adsb.aircraft.rssi",
+		metric.WithDescription("Signal strength of received aircraft"),
+		metric.WithUnit("dBFS"),
+		metric.WithExplicitBucketBoundaries(-45, -40, -35, -30, -25, -20, -15, -10, -5, 0),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	m.distance, err = meter.Float64Histogram(
+		"adsb.aircraft.distance",
+		metric.WithDescription("Distance of aircraft from the receiver"),
+		metric.WithUnit("[nmi_i]"),
+		metric.WithExplicitBucketBoundaries(10, 25, 50, 75, 100, 150, 200, 250, 300),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	m.altitude, err = meter.Float64Histogram(
+		"adsb.aircraft.altitude",
+		metric.WithDescription("Altitude of aircraft"),
+		metric.WithUnit("[ft_i]"),
+		metric.WithExplicitBucketBoundaries(0, 1000, 5000, 10000, 20000, 30000, 40000, 50000),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = meter.Int64ObservableGauge(
+		"adsb.aircraft.current",
+		metric.WithDescription("Number of aircraft currently tracked, by category"),
+		metric.WithUnit("{aircraft}"),
+		metric.WithInt64Callback(func(_ context.Context, o metric.Int64Observer) error {
+			s := m.stats.Latest()
+			for category, n := range s.ByCategory {
+				o.Observe(int64(n), metric.WithAttributes(attribute.String("adsb.category", category)))
+			}
+			return nil
+		}),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = meter.Int64ObservableGauge(
+		"adsb.aircraft.source",
+		metric.WithDescription("Number of aircraft currently tracked, by source such as adsb_icao, mlat or tisb"),
+		metric.WithUnit("{aircraft}"),
+		metric.WithInt64Callback(func(_ context.Context, o metric.Int64Observer) error {
+			s := m.stats.Latest()
+			for source, n := range s.BySource {
+				o.Observe(int64(n), metric.WithAttributes(attribute.String("adsb.source", source)))
+			}
+			return nil
+		}),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = meter.Int64ObservableGauge(
+		"adsb.aircraft.positioned",
+		metric.WithDescription("Number of aircraft currently tracked, with and without a position"),
+		metric.WithUnit("{aircraft}"),
+		metric.WithInt64Callback(func(_ context.Context, o metric.Int64Observer) error {
+			s := m.stats.Latest()
+			if s.Time.IsZero() {
+				return nil
+			}
+			o.Observe(int64(s.Positioned), metric.WithAttributes(attribute.String("adsb.positioned", strconv.FormatBool(true))))
+			o.Observe(int64(s.Unpositioned), metric.WithAttributes(attribute.String("adsb.positioned", strconv.FormatBool(false))))
+			return nil
+		}),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = meter.Float64ObservableGauge(
+		"adsb.messages.rate",
+		metric.WithDescription("Messages per second received by the decoder"),
+		metric.WithUnit("{message}/s"),
+		metric.WithFloat64Callback(func(_ context.Context, o metric.Float64Observer) error {
+			if s := m.stats.Latest(); s.HasRates {
+				o.Observe(s.MessageRate)
+			}
+			return nil
+		}),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = meter.Float64ObservableGauge(
+		"adsb.positions.rate",
+		metric.WithDescription("New aircraft positions per second"),
+		metric.WithUnit("{position}/s"),
+		metric.WithFloat64Callback(func(_ context.Context, o metric.Float64Observer) error {
+			if s := m.stats.Latest(); s.HasRates {
+				o.Observe(s.PositionRate)
+			}
+			return nil
+		}),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// record updates the gauges and records the histograms for a snapshot
+func (m *snapshotMetrics) record(ctx context.Context, data *models.AutoGenerated, ts time.Time) {
+	s := m.stats.Update(data, ts)
+	for _, v := range s.RSSI {
+		m.rssi.Record(ctx, v)
+	}
+	for _, v := range s.Distance {
+		m.distance.Record(ctx, v)
+	}
+	for _, v := range s.Altitude {
+		m.altitude.Record(ctx, v)
+	}
+}
@@ -0,0 +1,75 @@
+package otel
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rknightion/adsb2loki/pkg/models"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestSnapshotMetrics(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	m, err := newSnapshotMetrics(provider.Meter("test"))
+	if err != nil {
+		t.Fatalf("Failed to create snapshot metrics: %v", err)
+	}
+
+	ctx := context.Background()
+	aircraft := []models.Aircraft{
+		{Hex: "4ca614", Category: "A5", Type: "adsb_icao", Lat: 51.5, Lon: -0.1, Rssi: -20.5, RDst: 40, AltBaro: float64(39000), SeenPos: 0.5},
+		{Hex: "abc123", Category: "A5", Type: "mlat", Rssi: -30},
+	}
+	m.record(ctx, &models.AutoGenerated{Now: 1748083431, Messages: 1000, Aircraft: aircraft}, time.Now())
+	m.record(ctx, &models.AutoGenerated{Now: 1748083436, Messages: 2000, Aircraft: aircraft}, time.Now())
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(ctx, &rm); err != nil {
+		t.Fatalf("Failed to collect metrics: %v", err)
+	}
+
+	found := make(map[string]metricdata.Metrics)
+	for _, sm := range rm.ScopeMetrics {
+		for _, metric := range sm.Metrics {
+			found[metric.Name] = metric
+		}
+	}
+
+	current, ok := found["adsb.aircraft.current"].Data.(metricdata.Gauge[int64])
+	if !ok || len(current.DataPoints) != 1 || current.DataPoints[0].Value != 2 {
+		t.Errorf("Expected 2 aircraft in category A5, got %+v", found["adsb.aircraft.current"].Data)
+	}
+
+	sources, ok := found["adsb.aircraft.source"].Data.(metricdata.Gauge[int64])
+	if !ok || len(sources.DataPoints) != 2 {
+		t.Errorf("Expected 2 sources, got %+v", found["adsb.aircraft.source"].Data)
+	}
+
+	positioned, ok := found["adsb.aircraft.positioned"].Data.(metricdata.Gauge[int64])
+	if !ok || len(positioned.DataPoints) != 2 {
+		t.Errorf("Expected positioned and unpositioned points, got %+v", found["adsb.aircraft.positioned"].Data)
+	}
+
+	rate, ok := found["adsb.messages.rate"].Data.(metricdata.Gauge[float64])
+	if !ok || len(rate.DataPoints) != 1 || rate.DataPoints[0].Value != 200 {
+		t.Errorf("Expected 200 messages/s, got %+v", found["adsb.messages.rate"].Data)
+	}
+
+	if _, ok := found["adsb.positions.rate"]; !ok {
+		t.Error("Expected adsb.positions.rate to be reported")
+	}
+
+	rssi, ok := found["adsb.aircraft.rssi"].Data.(metricdata.Histogram[float64])
+	if !ok || len(rssi.DataPoints) != 1 || rssi.DataPoints[0].Count != 4 {
+		t.Errorf("Expected 4 RSSI samples, got %+v", found["adsb.aircraft.rssi"].Data)
+	}
+
+	for _, name := range []string{"adsb.aircraft.distance", "adsb.aircraft.altitude"} {
+		if _, ok := found[name].Data.(metricdata.Histogram[float64]); !ok {
+			t.Errorf("Expected histogram %s", name)
+		}
+	}
+}
@@ -3,18 +3,18 @@ package otel
 import (
 	"context"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/rknightion/adsb2loki/pkg/common"
+	"github.com/rknightion/adsb2loki/pkg/models"
+	"github.com/rknightion/adsb2loki/pkg/severity"
 	"go.opentelemetry.io/otel"
-	"go.opentelemetry.io/otel/attribute"
-	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploghttp"
-	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
 	"go.opentelemetry.io/otel/log"
 	"go.opentelemetry.io/otel/metric"
 	sdklog "go.opentelemetry.io/otel/sdk/log"
 	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
-	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 )
 
 // Client represents an OpenTelemetry client for logging and metrics
@@ -22,49 +22,48 @@ type Client struct {
 	logger          log.Logger
 	loggerProvider  *sdklog.LoggerProvider
 	meterProvider   *sdkmetric.MeterProvider
+	tracerProvider  *sdktrace.TracerProvider // Only set when trace export is enabled
+	flights         *FlightTracer
 	aircraftCounter metric.Int64Counter
 	fetchDuration   metric.Float64Histogram
 	pushErrors      metric.Int64Counter
+	snapshots       *snapshotMetrics
+	receiver        *receiverMetrics
 }
 
 // NewClient creates a new OpenTelemetry client
-func NewClient(ctx context.Context, serviceName string) (*Client, error) {
-	// Create resource
-	res, err := resource.Merge(
-		resource.Default(),
-		resource.NewWithAttributes(
-			"",
-			attribute.String("service.name", serviceName),
-			attribute.String("service.version", "1.0.0"),
-		),
-	)
+func NewClient(ctx context.Context, r Resource) (*Client, error) {
+	// Create resource describing the service and receiver station
+	res, err := newResource(ctx, r)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create resource: %w", err)
 	}
 
-	// Create log exporter - uses OTEL_EXPORTER_OTLP_LOGS_ENDPOINT or OTEL_EXPORTER_OTLP_ENDPOINT
-	logExporter, err := otlploghttp.New(ctx)
+	// Create log exporter - selected by OTEL_LOGS_EXPORTER and OTEL_EXPORTER_OTLP_LOGS_PROTOCOL
+	logExporter, err := newLogExporter(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create log exporter: %w", err)
 	}
 
 	// Create log provider
-	loggerProvider := sdklog.NewLoggerProvider(
-		sdklog.WithResource(res),
-		sdklog.WithProcessor(sdklog.NewBatchProcessor(logExporter)),
-	)
+	logOptions := []sdklog.LoggerProviderOption{sdklog.WithResource(res)}
+	if logExporter != nil {
+		logOptions = append(logOptions, sdklog.WithProcessor(sdklog.NewBatchProcessor(logExporter)))
+	}
+	loggerProvider := sdklog.NewLoggerProvider(logOptions...)
 
-	// Create metric exporter - uses OTEL_EXPORTER_OTLP_METRICS_ENDPOINT or OTEL_EXPORTER_OTLP_ENDPOINT
-	metricExporter, err := otlpmetrichttp.New(ctx)
+	// Create metric exporter - selected by OTEL_METRICS_EXPORTER and OTEL_EXPORTER_OTLP_METRICS_PROTOCOL
+	metricExporter, err := newMetricExporter(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create metric exporter: %w", err)
 	}
 
-	// Create meter provider
-	meterProvider := sdkmetric.NewMeterProvider(
-		sdkmetric.WithResource(res),
-		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(metricExporter)),
-	)
+	// Create meter provider - the export interval is read from OTEL_METRIC_EXPORT_INTERVAL
+	meterOptions := []sdkmetric.Option{sdkmetric.WithResource(res)}
+	if metricExporter != nil {
+		meterOptions = append(meterOptions, sdkmetric.WithReader(sdkmetric.NewPeriodicReader(metricExporter)))
+	}
+	meterProvider := sdkmetric.NewMeterProvider(meterOptions...)
 
 	// Set global providers
 	otel.SetMeterProvider(meterProvider)
@@ -102,14 +101,47 @@ func NewClient(ctx context.Context, serviceName string) (*Client, error) {
 		return nil, fmt.Errorf("failed to create push errors counter: %w", err)
 	}
 
-	return &Client{
+	snapshots, err := newSnapshotMetrics(meter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create snapshot metrics: %w", err)
+	}
+
+	receiverStats, err := newReceiverMetrics(meter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create receiver metrics: %w", err)
+	}
+
+	client := &Client{
 		logger:          logger,
 		loggerProvider:  loggerProvider,
 		meterProvider:   meterProvider,
 		aircraftCounter: aircraftCounter,
 		fetchDuration:   fetchDuration,
 		pushErrors:      pushErrors,
-	}, nil
+		snapshots:       snapshots,
+		receiver:        receiverStats,
+	}
+
+	// Create trace exporter - traces are optional, enabled with OTEL_TRACES_EXPORTER=otlp or console
+	traceExporter, err := newSpanExporter(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create trace exporter: %w", err)
+	}
+	if traceExporter != nil {
+		client.tracerProvider = sdktrace.NewTracerProvider(
+			sdktrace.WithResource(res),
+			sdktrace.WithBatcher(traceExporter),
+		)
+		otel.SetTracerProvider(client.tracerProvider)
+		client.flights = NewFlightTracer(client.tracerProvider)
+	}
+
+	return client, nil
+}
+
+// Flights returns the flight tracer, or nil when trace export is disabled
+func (c *Client) Flights() *FlightTracer {
+	return c.flights
 }
 
 // PushLogs pushes log entries via OpenTelemetry
@@ -122,13 +154,28 @@ func (c *Client) PushLogs(ctx context.Context, entries []common.LogEntry) error
 		// Create a log record
 		record := log.Record{}
 		record.SetTimestamp(entry.Timestamp)
-		record.SetBody(log.StringValue(entry.Line))
-		record.SetSeverity(log.SeverityInfo)
+		record.SetBody(BodyValue(entry.Line))
+		level := entryLevel(entry)
+		record.SetSeverity(otelSeverity(level))
+		record.SetSeverityText(strings.ToUpper(string(level)))
 
-		// Add attributes from labels
-		attrs := make([]log.KeyValue, 0, len(entry.Labels))
+		// Add attributes from labels and structured metadata under the adsb namespace, like the
+		// span and metric attributes. Labels keep their bare keys as well, e.g. app, which
+		// existing queries select on. The level is carried by the severity instead.
+		attrs := make([]log.KeyValue, 0, 2*len(entry.Labels)+len(entry.StructuredMetadata))
 		for k, v := range entry.Labels {
-			attrs = append(attrs, log.String(k, v))
+			if k == severity.Key {
+				continue
+			}
+			attrs = append(attrs, log.String(k, v), log.String(AttributePrefix+k, v))
+		}
+		for k, v := range entry.StructuredMetadata {
+			if k == severity.Key {
+				continue
+			}
+			if v = strings.TrimSpace(v); v != "" {
+				attrs = append(attrs, log.String(AttributePrefix+k, v))
+			}
 		}
 		record.AddAttributes(attrs...)
 
@@ -139,6 +186,43 @@ func (c *Client) PushLogs(ctx context.Context, entries []common.LogEntry) error
 	return nil
 }
 
+// entryLevel returns the level set on an entry by label or structured metadata, defaulting to info
+func entryLevel(entry common.LogEntry) severity.Level {
+	value, ok := entry.Labels[severity.Key]
+	if !ok {
+		value, ok = entry.StructuredMetadata[severity.Key]
+	}
+	if !ok {
+		return severity.Info
+	}
+	level, err := severity.ParseLevel(value)
+	if err != nil {
+		return severity.Info
+	}
+	return level
+}
+
+// otelSeverity maps a level to the OpenTelemetry log severity
+func otelSeverity(level severity.Level) log.Severity {
+	switch level {
+	case severity.Debug:
+		return log.SeverityDebug
+	case severity.Warn:
+		return log.SeverityWarn
+	case severity.Error:
+		return log.SeverityError
+	case severity.Fatal:
+		return log.SeverityFatal
+	default:
+		return log.SeverityInfo
+	}
+}
+
+// RecordSnapshot updates the aircraft gauges, rates and histograms from a snapshot
+func (c *Client) RecordSnapshot(ctx context.Context, data *models.AutoGenerated, ts time.Time) {
+	c.snapshots.record(ctx, data, ts)
+}
+
 // RecordFetchDuration records the duration of a fetch operation
 func (c *Client) RecordFetchDuration(ctx context.Context, duration time.Duration) {
 	c.fetchDuration.Record(ctx, duration.Seconds())
@@ -151,6 +235,14 @@ func (c *Client) RecordPushError(ctx context.Context) {
 
 // Shutdown gracefully shuts down the OpenTelemetry providers
 func (c *Client) Shutdown(ctx context.Context) error {
+	// End open flight spans and flush traces
+	if c.tracerProvider != nil {
+		c.flights.Close()
+		if err := c.tracerProvider.Shutdown(ctx); err != nil {
+			return fmt.Errorf("failed to shutdown tracer provider: %w", err)
+		}
+	}
+
 	// Shutdown logger provider
 	if err := c.loggerProvider.Shutdown(ctx); err != nil {
 		return fmt.Errorf("failed to shutdown logger provider: %w", err)
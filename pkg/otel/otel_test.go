@@ -5,6 +5,11 @@ import (
 	"os"
 	"testing"
 	"time"
+
+	"github.com/rknightion/adsb2loki/pkg/common"
+	"go.opentelemetry.io/otel/log"
+	"go.opentelemetry.io/otel/log/logtest"
+	"go.opentelemetry.io/otel/metric/noop"
 )
 
 func TestNewClientRequiresEndpoint(t *testing.T) {
@@ -26,7 +31,7 @@ func TestNewClientRequiresEndpoint(t *testing.T) {
 	os.Unsetenv("OTEL_EXPORTER_OTLP_METRICS_ENDPOINT")
 
 	ctx := context.Background()
-	client, err := NewClient(ctx, "test-service")
+	client, err := NewClient(ctx, Resource{ServiceName: "test-service"})
 
 	// The OTEL SDK might use default endpoints or handle this gracefully
 	// Log the behavior for informational purposes
@@ -51,7 +56,7 @@ func TestNewClientWithEndpoint(t *testing.T) {
 	defer os.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", oldEndpoint)
 
 	ctx := context.Background()
-	client, err := NewClient(ctx, "test-service")
+	client, err := NewClient(ctx, Resource{ServiceName: "test-service"})
 	if err != nil {
 		// This might still fail if the endpoint can't be reached, which is expected in tests
 		t.Logf("Client creation failed (expected in test environment): %v", err)
@@ -66,6 +71,99 @@ func TestNewClientWithEndpoint(t *testing.T) {
 	}
 }
 
+func TestPushLogsTypedRecords(t *testing.T) {
+	recorder := logtest.NewRecorder()
+	counter, _ := noop.NewMeterProvider().Meter("test").Int64Counter("test")
+	client := &Client{
+		logger:          recorder.Logger("test"),
+		aircraftCounter: counter,
+	}
+
+	entries := []common.LogEntry{
+		{
+			Timestamp: time.Now(),
+			Labels:    map[string]string{"app": "flightaware"},
+			Line:      `{"hex":"4ca614","alt_baro":39950,"gs":453.7}`,
+			StructuredMetadata: map[string]string{
+				"hex":        "4ca614",
+				"flight":     "EIN581  ",
+				"session_id": "4ca614-1748083431",
+				"category":   "",
+			},
+		},
+	}
+	if err := client.PushLogs(context.Background(), entries); err != nil {
+		t.Fatalf("Failed to push logs: %v", err)
+	}
+
+	scopes := recorder.Result()
+	if len(scopes) != 1 || len(scopes[0].Records) != 1 {
+		t.Fatalf("Expected 1 record, got %+v", scopes)
+	}
+	record := scopes[0].Records[0]
+
+	if record.Body().Kind() != log.KindMap {
+		t.Errorf("Expected map body, got %v", record.Body().Kind())
+	}
+
+	attrs := make(map[string]string)
+	record.WalkAttributes(func(kv log.KeyValue) bool {
+		attrs[kv.Key] = kv.Value.AsString()
+		return true
+	})
+	expected := map[string]string{
+		"app":             "flightaware",
+		"adsb.app":        "flightaware",
+		"adsb.hex":        "4ca614",
+		"adsb.flight":     "EIN581",
+		"adsb.session_id": "4ca614-1748083431",
+	}
+	if len(attrs) != len(expected) {
+		t.Errorf("Expected attributes %v, got %v", expected, attrs)
+	}
+	for k, v := range expected {
+		if attrs[k] != v {
+			t.Errorf("Expected attribute %s=%s, got %q", k, v, attrs[k])
+		}
+	}
+}
+
+func TestPushLogsSeverity(t *testing.T) {
+	recorder := logtest.NewRecorder()
+	counter, _ := noop.NewMeterProvider().Meter("test").Int64Counter("test")
+	client := &Client{
+		logger:          recorder.Logger("test"),
+		aircraftCounter: counter,
+	}
+
+	entries := []common.LogEntry{
+		{Timestamp: time.Now(), Labels: map[string]string{"app": "flightaware"}, Line: "{}"},
+		{Timestamp: time.Now(), Labels: map[string]string{"app": "flightaware"}, Line: "{}", StructuredMetadata: map[string]string{"level": "fatal"}},
+		{Timestamp: time.Now(), Labels: map[string]string{"app": "flightaware", "level": "warn"}, Line: "{}"},
+		{Timestamp: time.Now(), Labels: map[string]string{"app": "flightaware"}, Line: "{}", StructuredMetadata: map[string]string{"level": "debug"}},
+	}
+	if err := client.PushLogs(context.Background(), entries); err != nil {
+		t.Fatalf("Failed to push logs: %v", err)
+	}
+
+	records := recorder.Result()[0].Records
+	expected := []log.Severity{log.SeverityInfo, log.SeverityFatal, log.SeverityWarn, log.SeverityDebug}
+	for i, record := range records {
+		if record.Severity() != expected[i] {
+			t.Errorf("Record %d: expected severity %v, got %v", i, expected[i], record.Severity())
+		}
+		record.WalkAttributes(func(kv log.KeyValue) bool {
+			if kv.Key == "level" || kv.Key == "adsb.level" {
+				t.Errorf("Record %d: expected level to be carried by the severity, got attribute %s", i, kv.Key)
+			}
+			return true
+		})
+	}
+	if records[1].SeverityText() != "FATAL" {
+		t.Errorf("Expected severity text FATAL, got %s", records[1].SeverityText())
+	}
+}
+
 // Note: Full integration testing of the OTEL client would require:
 // 1. A test OTEL collector or mock OTEL endpoints
 // 2. Environment variable setup for OTEL endpoints
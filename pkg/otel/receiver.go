@@ -0,0 +1,160 @@
+package otel
+
+import (
+	"context"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/rknightion/adsb2loki/pkg/receiver"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// receiverMetrics reports the decoder's own counters and signal levels from the latest stats.json
+type receiverMetrics struct {
+	latest atomic.Pointer[receiver.Stats]
+}
+
+// newReceiverMetrics creates the receiver instruments. Counters come from the total period and
+// gauges from the last minute, both observed when metrics are collected.
+func newReceiverMetrics(meter metric.Meter) (*receiverMetrics, error) {
+	m := &receiverMetrics{}
+
+	_, err := meter.Int64ObservableCounter(
+		"adsb.receiver.messages",
+		metric.WithDescription("Number of messages received by the decoder, by downlink format when known"),
+		metric.WithUnit("{message}"),
+		metric.WithInt64Callback(func(_ context.Context, o metric.Int64Observer) error {
+			total := m.total()
+			if total == nil {
+				return nil
+			}
+			if len(total.MessagesByDF) == 0 {
+				o.Observe(total.Messages)
+				return nil
+			}
+			for df, n := range total.MessagesByDF {
+				if n > 0 {
+					o.Observe(n, metric.WithAttributes(attribute.String("adsb.df", strconv.Itoa(df))))
+				}
+			}
+			return nil
+		}),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = meter.Int64ObservableCounter(
+		"adsb.receiver.modes_messages",
+		metric.WithDescription("Number of Mode S messages, by source (local or remote) and result"),
+		metric.WithUnit("{message}"),
+		metric.WithInt64Callback(func(_ context.Context, o metric.Int64Observer) error {
+			total := m.total()
+			if total == nil {
+				return nil
+			}
+			for source, counts := range total.ModeSResults() {
+				for _, count := range counts {
+					o.Observe(count.Value, metric.WithAttributes(
+						attribute.String("adsb.source", source),
+						attribute.String("adsb.result", count.Name),
+					))
+				}
+			}
+			return nil
+		}),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = meter.Int64ObservableCounter(
+		"adsb.receiver.cpr_decodes",
+		metric.WithDescription("Number of CPR position decodes, by result"),
+		metric.WithUnit("{decode}"),
+		metric.WithInt64Callback(func(_ context.Context, o metric.Int64Observer) error {
+			total := m.total()
+			if total == nil || total.CPR == nil {
+				return nil
+			}
+			for _, count := range total.CPR.Results() {
+				o.Observe(count.Value, metric.WithAttributes(attribute.String("adsb.result", count.Name)))
+			}
+			return nil
+		}),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = meter.Int64ObservableCounter(
+		"adsb.receiver.tracks",
+		metric.WithDescription("Number of aircraft tracks created, by type"),
+		metric.WithUnit("{track}"),
+		metric.WithInt64Callback(func(_ context.Context, o metric.Int64Observer) error {
+			total := m.total()
+			if total == nil || total.Tracks == nil {
+				return nil
+			}
+			o.Observe(total.Tracks.All, metric.WithAttributes(attribute.String("adsb.track_type", "all")))
+			o.Observe(total.Tracks.SingleMessage, metric.WithAttributes(attribute.String("adsb.track_type", "single_message")))
+			return nil
+		}),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = meter.Float64ObservableGauge(
+		"adsb.receiver.signal",
+		metric.WithDescription("Signal levels over the last minute, by kind (signal, noise or peak)"),
+		metric.WithUnit("dBFS"),
+		metric.WithFloat64Callback(func(_ context.Context, o metric.Float64Observer) error {
+			s := m.latest.Load()
+			if s == nil || s.Last1Min == nil || s.Last1Min.Local == nil {
+				return nil
+			}
+			local := s.Last1Min.Local
+			for kind, v := range map[string]*float64{"signal": local.Signal, "noise": local.Noise, "peak": local.PeakSignal} {
+				if v != nil {
+					o.Observe(*v, metric.WithAttributes(attribute.String("adsb.level", kind)))
+				}
+			}
+			return nil
+		}),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = meter.Float64ObservableGauge(
+		"adsb.receiver.gain",
+		metric.WithDescription("Current SDR gain"),
+		metric.WithUnit("dB"),
+		metric.WithFloat64Callback(func(_ context.Context, o metric.Float64Observer) error {
+			if s := m.latest.Load(); s != nil && s.GainDB != nil {
+				o.Observe(*s.GainDB)
+			}
+			return nil
+		}),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// total returns the total period of the latest stats, if any
+func (m *receiverMetrics) total() *receiver.Period {
+	if s := m.latest.Load(); s != nil {
+		return s.Total
+	}
+	return nil
+}
+
+// RecordReceiverStats keeps the latest stats.json for the receiver metrics
+func (c *Client) RecordReceiverStats(_ context.Context, s *receiver.Stats) {
+	c.receiver.latest.Store(s)
+}
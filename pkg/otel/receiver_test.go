@@ -0,0 +1,62 @@
+package otel
+
+import (
+	"context"
+	"testing"
+
+	"github.com/rknightion/adsb2loki/pkg/receiver"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestReceiverMetrics(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	m, err := newReceiverMetrics(provider.Meter("test"))
+	if err != nil {
+		t.Fatalf("Failed to create receiver metrics: %v", err)
+	}
+
+	signal, noise := -18.7, -33.2
+	m.latest.Store(&receiver.Stats{
+		Last1Min: &receiver.Period{Local: &receiver.Local{Signal: &signal, Noise: &noise}},
+		Total: &receiver.Period{
+			Messages:     9500000,
+			MessagesByDF: []int64{1700000, 0, 0, 0, 7800000},
+			CPR:          &receiver.CPR{GlobalOK: 11480120},
+			Tracks:       &receiver.Tracks{All: 20433, SingleMessage: 4122},
+		},
+	})
+
+	ctx := context.Background()
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(ctx, &rm); err != nil {
+		t.Fatalf("Failed to collect metrics: %v", err)
+	}
+
+	found := make(map[string]metricdata.Metrics)
+	for _, sm := range rm.ScopeMetrics {
+		for _, metric := range sm.Metrics {
+			found[metric.Name] = metric
+		}
+	}
+
+	messages, ok := found["adsb.receiver.messages"].Data.(metricdata.Sum[int64])
+	if !ok || len(messages.DataPoints) != 2 || !messages.IsMonotonic {
+		t.Errorf("Expected a monotonic counter for DF 0 and 4, got %+v", found["adsb.receiver.messages"].Data)
+	}
+
+	cpr, ok := found["adsb.receiver.cpr_decodes"].Data.(metricdata.Sum[int64])
+	if !ok || len(cpr.DataPoints) != 12 {
+		t.Errorf("Expected 12 CPR results, got %+v", found["adsb.receiver.cpr_decodes"].Data)
+	}
+
+	levels, ok := found["adsb.receiver.signal"].Data.(metricdata.Gauge[float64])
+	if !ok || len(levels.DataPoints) != 2 {
+		t.Errorf("Expected signal and noise levels, got %+v", found["adsb.receiver.signal"].Data)
+	}
+
+	if _, ok := found["adsb.receiver.gain"]; ok {
+		t.Error("Expected no gain without gain_db")
+	}
+}
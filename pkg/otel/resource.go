@@ -0,0 +1,73 @@
+package otel
+
+import (
+	"context"
+	"sort"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/resource"
+)
+
+// Resource describes the service and the receiver station it runs for
+type Resource struct {
+	ServiceName    string
+	ServiceVersion string
+
+	// Station identifies the receiver, the name doubles as service.instance.id
+	StationName   string
+	Lat           float64
+	Lon           float64
+	HasLocation   bool
+	AntennaHeight float64 // Meters above ground, 0 when unknown
+	SDR           string  // SDR model, e.g. "rtl-sdr v4"
+	Tags          map[string]string
+}
+
+// attributes returns the resource attributes, omitting unset station fields
+func (r Resource) attributes() []attribute.KeyValue {
+	attrs := []attribute.KeyValue{
+		attribute.String("service.name", r.ServiceName),
+	}
+	if r.ServiceVersion != "" {
+		attrs = append(attrs, attribute.String("service.version", r.ServiceVersion))
+	}
+	if r.StationName != "" {
+		attrs = append(attrs,
+			attribute.String("service.instance.id", r.StationName),
+			attribute.String(AttributePrefix+"station.name", r.StationName),
+		)
+	}
+	if r.HasLocation {
+		attrs = append(attrs,
+			attribute.Float64(AttributePrefix+"station.lat", r.Lat),
+			attribute.Float64(AttributePrefix+"station.lon", r.Lon),
+		)
+	}
+	if r.AntennaHeight != 0 {
+		attrs = append(attrs, attribute.Float64(AttributePrefix+"station.antenna_height", r.AntennaHeight))
+	}
+	if r.SDR != "" {
+		attrs = append(attrs, attribute.String(AttributePrefix+"station.sdr", r.SDR))
+	}
+
+	// Sort tags so the resource is stable between runs
+	keys := make([]string, 0, len(r.Tags))
+	for k := range r.Tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		attrs = append(attrs, attribute.String(AttributePrefix+"station.tag."+k, r.Tags[k]))
+	}
+	return attrs
+}
+
+// newResource builds the OTel resource. OTEL_RESOURCE_ATTRIBUTES and OTEL_SERVICE_NAME
+// are applied last so they override the configured values.
+func newResource(ctx context.Context, r Resource) (*resource.Resource, error) {
+	return resource.New(ctx,
+		resource.WithTelemetrySDK(),
+		resource.WithAttributes(r.attributes()...),
+		resource.WithFromEnv(),
+	)
+}
@@ -0,0 +1,89 @@
+package otel
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+func TestNewResource(t *testing.T) {
+	r := Resource{
+		ServiceName:    "adsb2loki",
+		ServiceVersion: "v1.2.3",
+		StationName:    "home",
+		Lat:            51.5,
+		Lon:            -0.12,
+		HasLocation:    true,
+		AntennaHeight:  12.5,
+		SDR:            "rtl-sdr v4",
+		Tags:           map[string]string{"site": "roof"},
+	}
+
+	tests := []struct {
+		name string
+		env  map[string]string
+		want map[attribute.Key]attribute.Value
+	}{
+		{
+			name: "configured values",
+			want: map[attribute.Key]attribute.Value{
+				"service.name":                attribute.StringValue("adsb2loki"),
+				"service.version":             attribute.StringValue("v1.2.3"),
+				"service.instance.id":         attribute.StringValue("home"),
+				"adsb.station.name":           attribute.StringValue("home"),
+				"adsb.station.lat":            attribute.Float64Value(51.5),
+				"adsb.station.lon":            attribute.Float64Value(-0.12),
+				"adsb.station.antenna_height": attribute.Float64Value(12.5),
+				"adsb.station.sdr":            attribute.StringValue("rtl-sdr v4"),
+				"adsb.station.tag.site":       attribute.StringValue("roof"),
+			},
+		},
+		{
+			name: "environment overrides",
+			env: map[string]string{
+				"OTEL_SERVICE_NAME":        "adsb-north",
+				"OTEL_RESOURCE_ATTRIBUTES": "deployment.environment=prod,adsb.station.name=north",
+			},
+			want: map[attribute.Key]attribute.Value{
+				"service.name":           attribute.StringValue("adsb-north"),
+				"deployment.environment": attribute.StringValue("prod"),
+				"adsb.station.name":      attribute.StringValue("north"),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("OTEL_SERVICE_NAME", "")
+			t.Setenv("OTEL_RESOURCE_ATTRIBUTES", "")
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+
+			res, err := newResource(context.Background(), r)
+			if err != nil {
+				t.Fatalf("Failed to create resource: %v", err)
+			}
+
+			set := res.Set()
+			for key, want := range tt.want {
+				got, ok := set.Value(key)
+				if !ok {
+					t.Errorf("Expected attribute %s=%s, got none", key, want.Emit())
+					continue
+				}
+				if got != want {
+					t.Errorf("Expected attribute %s=%s, got %s", key, want.Emit(), got.Emit())
+				}
+			}
+		})
+	}
+}
+
+func TestResourceOmitsUnsetStationFields(t *testing.T) {
+	attrs := Resource{ServiceName: "adsb2loki"}.attributes()
+	if len(attrs) != 1 || attrs[0].Key != "service.name" {
+		t.Errorf("Expected only service.name, got %v", attrs)
+	}
+}
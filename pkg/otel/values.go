@@ -0,0 +1,82 @@
+package otel
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"sort"
+
+	"go.opentelemetry.io/otel/log"
+)
+
+// AttributePrefix is the namespace for aircraft fields exported as attributes
+const AttributePrefix = "adsb."
+
+// integerFields are the aircraft.json fields holding whole numbers: altitudes and rates in feet,
+// speeds in knots, temperatures, integrity codes and counters. Every other number is a float, even
+// when a value happens to be printed without decimals, so each field keeps a single type.
+var integerFields = map[string]bool{
+	"alt_baro": true, "alt_geom": true, "baro_rate": true, "geom_rate": true,
+	"nav_altitude_mcp": true, "nav_altitude_fms": true,
+	"ias": true, "tas": true, "wd": true, "ws": true, "oat": true, "tat": true,
+	"nic": true, "rc": true, "version": true, "nic_baro": true, "nac_p": true, "nac_v": true,
+	"sil": true, "gva": true, "sda": true, "alert": true, "spi": true, "dbFlags": true,
+	"messages": true,
+}
+
+// BodyValue converts a JSON log line to a typed map value so backends can index the fields
+// without re-parsing. Numbers are Int64 for integerFields and Float64 otherwise. Lines that are
+// not JSON objects are kept as strings.
+func BodyValue(line string) log.Value {
+	decoder := json.NewDecoder(bytes.NewReader([]byte(line)))
+	decoder.UseNumber()
+
+	var fields map[string]interface{}
+	if err := decoder.Decode(&fields); err != nil || fields == nil {
+		return log.StringValue(line)
+	}
+	return toValue("", fields)
+}
+
+// toValue converts the decoded JSON value of a field to a log value, typing numbers by key
+func toValue(key string, v interface{}) log.Value {
+	switch val := v.(type) {
+	case string:
+		return log.StringValue(val)
+	case bool:
+		return log.BoolValue(val)
+	case json.Number:
+		f, err := val.Float64()
+		if err != nil {
+			return log.StringValue(val.String())
+		}
+		if integerFields[key] {
+			return log.Int64Value(int64(math.Round(f)))
+		}
+		return log.Float64Value(f)
+	case []interface{}:
+		values := make([]log.Value, 0, len(val))
+		for _, item := range val {
+			values = append(values, toValue(key, item))
+		}
+		return log.SliceValue(values...)
+	case map[string]interface{}:
+		// Sort keys so the body is stable between records
+		keys := make([]string, 0, len(val))
+		for k := range val {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		kvs := make([]log.KeyValue, 0, len(val))
+		for _, k := range keys {
+			if val[k] == nil {
+				continue
+			}
+			kvs = append(kvs, log.KeyValue{Key: k, Value: toValue(k, val[k])})
+		}
+		return log.MapValue(kvs...)
+	default:
+		return log.Value{}
+	}
+}
@@ -0,0 +1,84 @@
+package otel
+
+import (
+	"testing"
+
+	"go.opentelemetry.io/otel/log"
+)
+
+// mapField finds a key in a map value
+func mapField(v log.Value, key string) (log.Value, bool) {
+	for _, kv := range v.AsMap() {
+		if kv.Key == key {
+			return kv.Value, true
+		}
+	}
+	return log.Value{}, false
+}
+
+func TestBodyValue(t *testing.T) {
+	body := BodyValue(`{"hex":"4ca614","alt_baro":39950,"gs":453.7,"track":300,"rssi":-21,"messages":1234,"alert":false,"nav_modes":["autopilot","tcas"],"lastPosition":{"lat":51,"nic":8},"wd":null}`)
+	if body.Kind() != log.KindMap {
+		t.Fatalf("Expected map body, got %v", body.Kind())
+	}
+
+	tests := []struct {
+		key  string
+		kind log.Kind
+	}{
+		{"hex", log.KindString},
+		{"alt_baro", log.KindInt64},
+		{"gs", log.KindFloat64},
+		{"track", log.KindFloat64}, // Printed without decimals, still a float
+		{"rssi", log.KindFloat64},
+		{"messages", log.KindInt64},
+		{"alert", log.KindBool},
+		{"nav_modes", log.KindSlice},
+		{"lastPosition", log.KindMap},
+	}
+	for _, tt := range tests {
+		v, ok := mapField(body, tt.key)
+		if !ok {
+			t.Errorf("Expected body to contain %s", tt.key)
+			continue
+		}
+		if v.Kind() != tt.kind {
+			t.Errorf("Expected %s to be %v, got %v", tt.key, tt.kind, v.Kind())
+		}
+	}
+
+	if v, _ := mapField(body, "alt_baro"); v.AsInt64() != 39950 {
+		t.Errorf("Expected alt_baro 39950, got %d", v.AsInt64())
+	}
+	if v, _ := mapField(body, "gs"); v.AsFloat64() != 453.7 {
+		t.Errorf("Expected gs 453.7, got %f", v.AsFloat64())
+	}
+	if v, _ := mapField(body, "track"); v.AsFloat64() != 300 {
+		t.Errorf("Expected track 300, got %v", v)
+	}
+	lastPosition, _ := mapField(body, "lastPosition")
+	if lat, _ := mapField(lastPosition, "lat"); lat.Kind() != log.KindFloat64 {
+		t.Errorf("Expected lastPosition.lat to be a float, got %v", lat.Kind())
+	}
+	if nic, _ := mapField(lastPosition, "nic"); nic.Kind() != log.KindInt64 {
+		t.Errorf("Expected lastPosition.nic to be an integer, got %v", nic.Kind())
+	}
+	if v, _ := mapField(body, "nav_modes"); len(v.AsSlice()) != 2 || v.AsSlice()[1].AsString() != "tcas" {
+		t.Errorf("Expected nav_modes [autopilot tcas], got %v", v)
+	}
+	if _, ok := mapField(body, "wd"); ok {
+		t.Error("Expected null fields to be dropped")
+	}
+}
+
+func TestBodyValueNonJSON(t *testing.T) {
+	body := BodyValue("plain text")
+	if body.Kind() != log.KindString || body.AsString() != "plain text" {
+		t.Errorf("Expected plain string body, got %v", body)
+	}
+
+	body = BodyValue(`["not", "an", "object"]`)
+	if body.Kind() != log.KindString {
+		t.Errorf("Expected non-object JSON to stay a string, got %v", body.Kind())
+	}
+}
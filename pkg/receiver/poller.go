@@ -0,0 +1,110 @@
+package receiver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/rknightion/adsb2loki/pkg/common"
+)
+
+// DefaultStatsInterval is how often stats.json is fetched. Decoders update its last1min period once a minute.
+const DefaultStatsInterval = time.Minute
+
+// StatsRecorder receives every fetched stats.json, e.g. to export metrics
+type StatsRecorder interface {
+	RecordReceiverStats(ctx context.Context, s *Stats)
+}
+
+// Poller fetches stats.json periodically, hands it to the recorders and pushes each new
+// last1min period to the logger
+type Poller struct {
+	URL       string
+	Interval  time.Duration
+	Logger    common.Logger // Optional
+	Recorders []StatsRecorder
+
+	lastEnd float64 // End of the last period pushed
+}
+
+// NewPoller creates a poller for the given stats.json URL
+func NewPoller(url string, interval time.Duration, logger common.Logger) *Poller {
+	return &Poller{URL: url, Interval: interval, Logger: logger}
+}
+
+// Run polls until ctx is cancelled, starting immediately
+func (p *Poller) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := p.Poll(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("Error polling receiver stats: %v", err)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Poll fetches stats.json once
+func (p *Poller) Poll(ctx context.Context) error {
+	s, err := FetchStats(ctx, p.URL)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range p.Recorders {
+		r.RecordReceiverStats(ctx, s)
+	}
+
+	// The last minute only changes once a minute, push each period once
+	if p.Logger == nil || s.Last1Min == nil || s.Last1Min.End == p.lastEnd {
+		return nil
+	}
+	entry, err := Entry(s)
+	if err != nil {
+		return err
+	}
+	if err := p.Logger.PushLogs(ctx, []common.LogEntry{entry}); err != nil {
+		return fmt.Errorf("failed to push receiver stats: %w", err)
+	}
+	p.lastEnd = s.Last1Min.End
+	return nil
+}
+
+// Entry converts the stats to a log entry with a source label of "stats", holding the
+// gauges and the last1min period, timestamped at the end of that period
+func Entry(s *Stats) (common.LogEntry, error) {
+	minute := Stats{
+		Now:                s.Now,
+		GainDB:             s.GainDB,
+		EstimatedPPM:       s.EstimatedPPM,
+		AircraftWithPos:    s.AircraftWithPos,
+		AircraftWithoutPos: s.AircraftWithoutPos,
+		Last1Min:           s.Last1Min,
+	}
+	line, err := json.Marshal(minute)
+	if err != nil {
+		return common.LogEntry{}, fmt.Errorf("failed to marshal receiver stats: %w", err)
+	}
+
+	ts := s.Time()
+	if s.Last1Min != nil && s.Last1Min.End > 0 {
+		ts = time.Unix(0, int64(s.Last1Min.End*float64(time.Second)))
+	}
+
+	return common.LogEntry{
+		Timestamp: ts,
+		Line:      string(line),
+		Labels: map[string]string{
+			"app":    "flightaware",
+			"source": "stats",
+		},
+	}, nil
+}
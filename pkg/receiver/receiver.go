@@ -0,0 +1,240 @@
+package receiver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// Receiver is receiver.json, describing the decoder and its station
+type Receiver struct {
+	Version string   `json:"version"`
+	Refresh int      `json:"refresh"` // Milliseconds between aircraft.json updates
+	History int      `json:"history"`
+	Lat     *float64 `json:"lat,omitempty"`
+	Lon     *float64 `json:"lon,omitempty"`
+}
+
+// RefreshInterval returns how often the decoder rewrites aircraft.json, or zero if unknown
+func (r *Receiver) RefreshInterval() time.Duration {
+	return time.Duration(r.Refresh) * time.Millisecond
+}
+
+// HasLocation reports whether the receiver location is configured in the decoder
+func (r *Receiver) HasLocation() bool {
+	return r.Lat != nil && r.Lon != nil
+}
+
+// Stats is stats.json, with counters over several periods
+type Stats struct {
+	Now                float64  `json:"now"`
+	GainDB             *float64 `json:"gain_db,omitempty"`
+	EstimatedPPM       *float64 `json:"estimated_ppm,omitempty"`
+	AircraftWithPos    *int     `json:"aircraft_with_pos,omitempty"`
+	AircraftWithoutPos *int     `json:"aircraft_without_pos,omitempty"`
+	Latest             *Period  `json:"latest,omitempty"`
+	Last1Min           *Period  `json:"last1min,omitempty"`
+	Last5Min           *Period  `json:"last5min,omitempty"`
+	Last15Min          *Period  `json:"last15min,omitempty"`
+	Total              *Period  `json:"total,omitempty"`
+}
+
+// Period holds the counters of one stats.json period
+type Period struct {
+	Start         float64  `json:"start"`
+	End           float64  `json:"end"`
+	Messages      int64    `json:"messages"`
+	MessagesValid *int64   `json:"messages_valid,omitempty"` // readsb only
+	MessagesByDF  []int64  `json:"messages_by_df,omitempty"` // readsb only, indexed by downlink format
+	Local         *Local   `json:"local,omitempty"`
+	Remote        *Remote  `json:"remote,omitempty"`
+	CPR           *CPR     `json:"cpr,omitempty"`
+	Tracks        *Tracks  `json:"tracks,omitempty"`
+	CPU           *CPU     `json:"cpu,omitempty"`
+	MaxDistance   *float64 `json:"max_distance,omitempty"` // Metres
+}
+
+// Local counts messages demodulated by the decoder's own SDR
+type Local struct {
+	SamplesProcessed int64    `json:"samples_processed"`
+	SamplesDropped   int64    `json:"samples_dropped"`
+	ModeAC           int64    `json:"modeac"`
+	ModeS            int64    `json:"modes"`
+	Bad              int64    `json:"bad"`
+	UnknownICAO      int64    `json:"unknown_icao"`
+	Accepted         []int64  `json:"accepted"` // By number of corrected bits
+	Signal           *float64 `json:"signal,omitempty"`
+	Noise            *float64 `json:"noise,omitempty"`
+	PeakSignal       *float64 `json:"peak_signal,omitempty"`
+	StrongSignals    int64    `json:"strong_signals"`
+}
+
+// Remote counts messages received from network inputs
+type Remote struct {
+	ModeAC      int64   `json:"modeac"`
+	ModeS       int64   `json:"modes"`
+	Bad         int64   `json:"bad"`
+	UnknownICAO int64   `json:"unknown_icao"`
+	Accepted    []int64 `json:"accepted"`
+}
+
+// CPR counts position decodes by outcome
+type CPR struct {
+	Surface               int64 `json:"surface"`
+	Airborne              int64 `json:"airborne"`
+	GlobalOK              int64 `json:"global_ok"`
+	GlobalBad             int64 `json:"global_bad"`
+	GlobalRange           int64 `json:"global_range"`
+	GlobalSpeed           int64 `json:"global_speed"`
+	GlobalSkipped         int64 `json:"global_skipped"`
+	LocalOK               int64 `json:"local_ok"`
+	LocalAircraftRelative int64 `json:"local_aircraft_relative"`
+	LocalReceiverRelative int64 `json:"local_receiver_relative"`
+	LocalSkipped          int64 `json:"local_skipped"`
+	LocalRange            int64 `json:"local_range"`
+	LocalSpeed            int64 `json:"local_speed"`
+	Filtered              int64 `json:"filtered"`
+}
+
+// Tracks counts the aircraft tracks created
+type Tracks struct {
+	All           int64 `json:"all"`
+	SingleMessage int64 `json:"single_message"`
+	Unreliable    int64 `json:"unreliable"`
+}
+
+// CPU is the time spent in each decoder thread, in milliseconds
+type CPU struct {
+	Demod      int64 `json:"demod"`
+	Reader     int64 `json:"reader"`
+	Background int64 `json:"background"`
+}
+
+// Count is a named counter, used to export groups of counters under one metric with a label
+type Count struct {
+	Name  string
+	Value int64
+}
+
+// Results returns the CPR decodes by result
+func (c *CPR) Results() []Count {
+	return []Count{
+		{"global_ok", c.GlobalOK},
+		{"global_bad", c.GlobalBad},
+		{"global_range", c.GlobalRange},
+		{"global_speed", c.GlobalSpeed},
+		{"global_skipped", c.GlobalSkipped},
+		{"local_ok", c.LocalOK},
+		{"local_aircraft_relative", c.LocalAircraftRelative},
+		{"local_receiver_relative", c.LocalReceiverRelative},
+		{"local_skipped", c.LocalSkipped},
+		{"local_range", c.LocalRange},
+		{"local_speed", c.LocalSpeed},
+		{"filtered", c.Filtered},
+	}
+}
+
+// ModeSResults returns the Mode S messages of a period by source (local or remote) and result
+func (p *Period) ModeSResults() map[string][]Count {
+	results := make(map[string][]Count)
+	if p.Local != nil {
+		results["local"] = modeSResults(p.Local.Accepted, p.Local.Bad, p.Local.UnknownICAO)
+	}
+	if p.Remote != nil {
+		results["remote"] = modeSResults(p.Remote.Accepted, p.Remote.Bad, p.Remote.UnknownICAO)
+	}
+	return results
+}
+
+func modeSResults(accepted []int64, bad, unknown int64) []Count {
+	var total int64
+	for _, n := range accepted {
+		total += n
+	}
+	return []Count{{"accepted", total}, {"bad", bad}, {"unknown_icao", unknown}}
+}
+
+// Time returns the time of the stats, from the decoder's clock
+func (s *Stats) Time() time.Time {
+	return time.Unix(0, int64(s.Now*float64(time.Second)))
+}
+
+// FileURL returns the URL of another file in the same directory as aircraft.json, e.g. stats.json.
+// The compressed and binCraft variants such as aircraft.binCraft.zst are accepted as well.
+func FileURL(aircraftURL, name string) (string, error) {
+	u, err := url.Parse(aircraftURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse aircraft.json URL: %w", err)
+	}
+	if !strings.HasPrefix(path.Base(u.Path), "aircraft.") {
+		return "", fmt.Errorf("cannot derive %s from %s, which doesn't end in /aircraft.json", name, aircraftURL)
+	}
+	u.Path = path.Join(path.Dir(u.Path), name)
+	u.RawQuery = ""
+	return u.String(), nil
+}
+
+// FetchReceiver fetches and decodes receiver.json
+func FetchReceiver(ctx context.Context, url string) (*Receiver, error) {
+	var r Receiver
+	if err := fetchJSON(ctx, url, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// FetchStats fetches and decodes stats.json
+func FetchStats(ctx context.Context, url string) (*Stats, error) {
+	var s Stats
+	if err := fetchJSON(ctx, url, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// fetchJSON fetches url, or reads it for file:// URLs, and decodes the JSON response into v
+func fetchJSON(ctx context.Context, rawURL string, v interface{}) error {
+	if u, err := url.Parse(rawURL); err == nil && u.Scheme == "file" {
+		return readJSON(u.Path, v)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to fetch %s: %w", rawURL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to fetch %s: status %d", rawURL, resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to decode %s: %w", rawURL, err)
+	}
+	return nil
+}
+
+// readJSON decodes the local file at path into v
+func readJSON(path string, v interface{}) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	defer f.Close()
+
+	if err := json.NewDecoder(f).Decode(v); err != nil {
+		return fmt.Errorf("failed to decode %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package receiver
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rknightion/adsb2loki/pkg/common"
+)
+
+// serveFile serves a testdata file for any path
+func serveFile(t *testing.T, name string) *httptest.Server {
+	t.Helper()
+	data, err := os.ReadFile("testdata/" + name)
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", name, err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(data)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestFileURL(t *testing.T) {
+	tests := []struct {
+		aircraftURL string
+		want        string
+		wantErr     bool
+	}{
+		{aircraftURL: "http://piaware/skyaware/data/aircraft.json", want: "http://piaware/skyaware/data/stats.json"},
+		{aircraftURL: "http://localhost:8080/data/aircraft.json?cache=1", want: "http://localhost:8080/data/stats.json"},
+		{aircraftURL: "http://localhost:8080/aircraft.json", want: "http://localhost:8080/stats.json"},
+		{aircraftURL: "http://localhost/tar1090/data/aircraft.binCraft.zst", want: "http://localhost/tar1090/data/stats.json"},
+		{aircraftURL: "http://localhost:8080/api/planes", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.aircraftURL, func(t *testing.T) {
+			got, err := FileURL(tt.aircraftURL, "stats.json")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if got != tt.want {
+				t.Errorf("Expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestFetchStatsFile(t *testing.T) {
+	path, err := filepath.Abs("testdata/stats.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := FetchStats(context.Background(), "file://"+path)
+	if err != nil {
+		t.Fatalf("Failed to read stats.json: %v", err)
+	}
+	if s.Last1Min == nil || s.Total == nil {
+		t.Errorf("Expected the last1min and total periods, got %+v", s)
+	}
+
+	if _, err := FetchStats(context.Background(), "file://"+filepath.Join(t.TempDir(), "stats.json")); err == nil {
+		t.Error("Expected error for a missing file, got nil")
+	}
+}
+
+func TestFetchReceiver(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"version":"readsb version: 3.14.1602","refresh":1000,"history":120,"lat":53.42,"lon":-6.27}`))
+	}))
+	defer server.Close()
+
+	r, err := FetchReceiver(context.Background(), server.URL)
+	if err != nil {
+		t.Fatalf("Failed to fetch receiver.json: %v", err)
+	}
+	if r.RefreshInterval() != time.Second || !r.HasLocation() || *r.Lat != 53.42 {
+		t.Errorf("Unexpected receiver %+v", r)
+	}
+}
+
+func TestFetchStatsError(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	if _, err := FetchStats(context.Background(), server.URL); err == nil {
+		t.Error("Expected an error for a missing stats.json")
+	}
+}
+
+// statsLogger collects the pushed entries
+type statsLogger struct {
+	entries []common.LogEntry
+}
+
+func (l *statsLogger) PushLogs(_ context.Context, entries []common.LogEntry) error {
+	l.entries = append(l.entries, entries...)
+	return nil
+}
+
+// statsRecorder keeps the recorded stats
+type statsRecorder struct {
+	stats []*Stats
+}
+
+func (r *statsRecorder) RecordReceiverStats(_ context.Context, s *Stats) {
+	r.stats = append(r.stats, s)
+}
+
+func TestPoller(t *testing.T) {
+	server := serveFile(t, "stats.json")
+	logger := &statsLogger{}
+	recorder := &statsRecorder{}
+
+	p := NewPoller(server.URL, time.Minute, logger)
+	p.Recorders = append(p.Recorders, recorder)
+
+	// The same period is pushed once but recorded every time
+	for i := 0; i < 2; i++ {
+		if err := p.Poll(context.Background()); err != nil {
+			t.Fatalf("Poll failed: %v", err)
+		}
+	}
+	if len(recorder.stats) != 2 {
+		t.Errorf("Expected 2 recorded stats, got %d", len(recorder.stats))
+	}
+	if len(logger.entries) != 1 {
+		t.Fatalf("Expected 1 entry, got %d", len(logger.entries))
+	}
+
+	entry := logger.entries[0]
+	if entry.Labels["source"] != "stats" || entry.Labels["app"] != "flightaware" {
+		t.Errorf("Expected the stats labels, got %v", entry.Labels)
+	}
+	if !entry.Timestamp.Equal(time.Unix(1716547437, 600000000)) {
+		t.Errorf("Expected the end of the last minute as timestamp, got %v", entry.Timestamp)
+	}
+
+	var line Stats
+	if err := json.Unmarshal([]byte(entry.Line), &line); err != nil {
+		t.Fatalf("Failed to decode entry: %v", err)
+	}
+	if line.Last1Min == nil || line.Last1Min.Messages != 28417 || *line.Last1Min.Local.Signal != -18.7 {
+		t.Errorf("Expected the last minute in the entry, got %+v", line.Last1Min)
+	}
+	if line.Total != nil || line.Last15Min != nil {
+		t.Error("Expected only the last minute in the entry")
+	}
+}
+
+func TestPeriodResults(t *testing.T) {
+	data, _ := os.ReadFile("testdata/stats.json")
+	var s Stats
+	if err := json.Unmarshal(data, &s); err != nil {
+		t.Fatalf("Failed to decode stats: %v", err)
+	}
+
+	local := s.Last1Min.ModeSResults()["local"]
+	if local[0] != (Count{"accepted", 27980}) || local[1] != (Count{"bad", 301223}) {
+		t.Errorf("Unexpected local results %v", local)
+	}
+	if cpr := s.Total.CPR.Results(); cpr[0] != (Count{"global_ok", 11480120}) {
+		t.Errorf("Unexpected CPR results %v", cpr)
+	}
+}
@@ -0,0 +1,170 @@
+package replay
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rknightion/adsb2loki/pkg/models"
+)
+
+// Record is one captured snapshot with the time it was fetched
+type Record struct {
+	Time time.Time             `json:"time"`
+	Data *models.AutoGenerated `json:"data"`
+}
+
+// Recorder appends every snapshot to a gzip compressed JSONL archive
+type Recorder struct {
+	mu   sync.Mutex
+	file *os.File
+	gz   *gzip.Writer
+	enc  *json.Encoder
+}
+
+// NewRecorder opens the archive for appending, creating it if needed.
+// Appending adds a new gzip member, which readers decode as one stream.
+func NewRecorder(path string) (*Recorder, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open recording: %w", err)
+	}
+
+	gz := gzip.NewWriter(file)
+	return &Recorder{file: file, gz: gz, enc: json.NewEncoder(gz)}, nil
+}
+
+// RecordSnapshot writes a snapshot fetched at ts, flushing so a crash loses at most the current record
+func (r *Recorder) RecordSnapshot(_ context.Context, data *models.AutoGenerated, ts time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.enc.Encode(Record{Time: ts, Data: data}); err != nil {
+		log.Printf("Failed to record snapshot: %v", err)
+		return
+	}
+	if err := r.gz.Flush(); err != nil {
+		log.Printf("Failed to flush recording: %v", err)
+	}
+}
+
+// Close finishes the gzip stream and closes the file
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.gz.Close(); err != nil {
+		r.file.Close()
+		return fmt.Errorf("failed to finish recording: %w", err)
+	}
+	return r.file.Close()
+}
+
+// Reader reads records from an archive, gzip compressed or plain JSONL
+type Reader struct {
+	dec *json.Decoder
+	gz  *gzip.Reader
+}
+
+// NewReader creates a reader, detecting gzip compression from the stream header
+func NewReader(r io.Reader) (*Reader, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(2)
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to read recording: %w", err)
+	}
+
+	if len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress recording: %w", err)
+		}
+		return &Reader{dec: json.NewDecoder(gz), gz: gz}, nil
+	}
+	return &Reader{dec: json.NewDecoder(br)}, nil
+}
+
+// Next returns the next record, or io.EOF at the end of the archive
+func (r *Reader) Next() (Record, error) {
+	var rec Record
+	if err := r.dec.Decode(&rec); err != nil {
+		if err == io.EOF {
+			return rec, io.EOF
+		}
+		return rec, fmt.Errorf("failed to decode record: %w", err)
+	}
+	if rec.Data == nil {
+		return rec, fmt.Errorf("record at %s has no data", rec.Time.Format(time.RFC3339))
+	}
+	return rec, nil
+}
+
+// Close releases the decompressor
+func (r *Reader) Close() error {
+	if r.gz != nil {
+		return r.gz.Close()
+	}
+	return nil
+}
+
+// Handler processes a replayed snapshot with its original fetch time
+type Handler func(ctx context.Context, data *models.AutoGenerated, ts time.Time) error
+
+// Replay feeds every record to fn with its original timestamp. Speed 1 replays in real time,
+// 10 ten times faster, and 0 or less as fast as possible. A snapshot that fn fails to process is
+// logged and skipped, like a failed poll, and the failures are reported together at the end.
+func Replay(ctx context.Context, r *Reader, speed float64, fn Handler) (int, error) {
+	var first time.Time
+	start := time.Now()
+	n := 0
+	var failed []error
+
+	for {
+		rec, err := r.Next()
+		if err == io.EOF {
+			if len(failed) > 0 {
+				return n, fmt.Errorf("%d of %d snapshots failed, first: %w", len(failed), n, failed[0])
+			}
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+
+		// Wait until the record is due relative to the first one
+		if speed > 0 {
+			if first.IsZero() {
+				first = rec.Time
+			}
+			due := start.Add(time.Duration(float64(rec.Time.Sub(first)) / speed))
+			if wait := time.Until(due); wait > 0 {
+				timer := time.NewTimer(wait)
+				select {
+				case <-timer.C:
+				case <-ctx.Done():
+					timer.Stop()
+					return n, ctx.Err()
+				}
+			}
+		}
+		if err := ctx.Err(); err != nil {
+			return n, err
+		}
+
+		n++
+		if err := fn(ctx, rec.Data, rec.Time); err != nil {
+			if ctx.Err() != nil {
+				return n, err
+			}
+			log.Printf("Failed to process snapshot of %s: %v", rec.Time.Format(time.RFC3339), err)
+			failed = append(failed, err)
+		}
+	}
+}
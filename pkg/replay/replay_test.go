@@ -0,0 +1,136 @@
+package replay
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rknightion/adsb2loki/pkg/models"
+)
+
+// recordTestArchive records n snapshots one second apart and returns the archive path
+func recordTestArchive(t *testing.T, n int) (string, time.Time) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "capture.jsonl.gz")
+	start := time.Date(2024, 5, 24, 10, 43, 51, 500000000, time.UTC)
+
+	// Two recorder sessions append separate gzip members to the same file
+	for _, part := range [][2]int{{0, n / 2}, {n / 2, n}} {
+		recorder, err := NewRecorder(path)
+		if err != nil {
+			t.Fatalf("Failed to create recorder: %v", err)
+		}
+		for i := part[0]; i < part[1]; i++ {
+			data := &models.AutoGenerated{
+				Now:      float64(start.Unix() + int64(i)),
+				Messages: 1000 + i,
+				Aircraft: []models.Aircraft{{Hex: "4ca614", Flight: "EIN581", AltBaro: float64(1000 * i)}},
+			}
+			recorder.RecordSnapshot(context.Background(), data, start.Add(time.Duration(i)*time.Second))
+		}
+		if err := recorder.Close(); err != nil {
+			t.Fatalf("Failed to close recorder: %v", err)
+		}
+	}
+	return path, start
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	path, start := recordTestArchive(t, 4)
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open archive: %v", err)
+	}
+	defer file.Close()
+	reader, err := NewReader(file)
+	if err != nil {
+		t.Fatalf("Failed to create reader: %v", err)
+	}
+	defer reader.Close()
+
+	var times []time.Time
+	var messages []int
+	n, err := Replay(context.Background(), reader, 0, func(_ context.Context, data *models.AutoGenerated, ts time.Time) error {
+		times = append(times, ts)
+		messages = append(messages, data.Messages)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Replay failed: %v", err)
+	}
+	if n != 4 {
+		t.Fatalf("Expected 4 snapshots, got %d", n)
+	}
+	for i, ts := range times {
+		if !ts.Equal(start.Add(time.Duration(i) * time.Second)) {
+			t.Errorf("Expected original timestamp at %d, got %v", i, ts)
+		}
+		if messages[i] != 1000+i {
+			t.Errorf("Expected messages %d, got %d", 1000+i, messages[i])
+		}
+	}
+}
+
+func TestReplaySpeed(t *testing.T) {
+	path, _ := recordTestArchive(t, 2)
+
+	file, _ := os.Open(path)
+	defer file.Close()
+	reader, _ := NewReader(file)
+
+	// Two records one second apart at 20x take about 50ms
+	begin := time.Now()
+	if _, err := Replay(context.Background(), reader, 20, func(context.Context, *models.AutoGenerated, time.Time) error { return nil }); err != nil {
+		t.Fatalf("Replay failed: %v", err)
+	}
+	if elapsed := time.Since(begin); elapsed < 40*time.Millisecond || elapsed > time.Second {
+		t.Errorf("Expected about 50ms at 20x, took %v", elapsed)
+	}
+}
+
+func TestReplayContinuesOnError(t *testing.T) {
+	path, _ := recordTestArchive(t, 4)
+
+	file, _ := os.Open(path)
+	defer file.Close()
+	reader, _ := NewReader(file)
+
+	failure := errors.New("push failed")
+	calls := 0
+	n, err := Replay(context.Background(), reader, 0, func(context.Context, *models.AutoGenerated, time.Time) error {
+		calls++
+		if calls%2 == 1 {
+			return failure
+		}
+		return nil
+	})
+	if n != 4 || calls != 4 {
+		t.Errorf("Expected all 4 snapshots replayed, got %d with %d calls", n, calls)
+	}
+	if !errors.Is(err, failure) || !strings.Contains(err.Error(), "2 of 4 snapshots failed") {
+		t.Errorf("Expected the failures to be reported together, got %v", err)
+	}
+}
+
+func TestReaderPlainJSONL(t *testing.T) {
+	input := `{"time":"2024-05-24T10:43:51Z","data":{"now":1716547431,"messages":5,"aircraft":[]}}
+{"time":"2024-05-24T10:43:56Z","data":null}
+`
+	reader, err := NewReader(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Failed to create reader: %v", err)
+	}
+
+	rec, err := reader.Next()
+	if err != nil || rec.Data.Messages != 5 {
+		t.Fatalf("Expected first record, got %+v and %v", rec, err)
+	}
+	if _, err := reader.Next(); err == nil {
+		t.Error("Expected an error for a record without data")
+	}
+}
@@ -0,0 +1,110 @@
+package sbs
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/rknightion/adsb2loki/pkg/models"
+)
+
+// Reconnection backoff
+const (
+	minBackoff = time.Second
+	maxBackoff = 30 * time.Second
+)
+
+// ErrNotConnected is reported by Client.Err before the first connection
+var ErrNotConnected = errors.New("not connected")
+
+// Client reads an SBS stream from a Unix socket or TCP address into a tracker, reconnecting
+// with backoff whenever the connection is lost
+type Client struct {
+	Network string // unix or tcp
+	Address string
+	Tracker *Tracker
+
+	mu  sync.Mutex
+	err error // Why the client is disconnected, nil while connected
+}
+
+// NewClient creates a client for the given network and address with a new tracker
+func NewClient(network, address string) *Client {
+	return &Client{Network: network, Address: address, Tracker: NewTracker(), err: ErrNotConnected}
+}
+
+// Run reads the stream until ctx is cancelled
+func (c *Client) Run(ctx context.Context) {
+	backoff := minBackoff
+	for ctx.Err() == nil {
+		connected, err := c.read(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		c.setErr(err)
+		if connected {
+			backoff = minBackoff
+		}
+		log.Printf("SBS stream %s: %v, reconnecting in %v", c.Address, err, backoff)
+
+		t := time.NewTimer(backoff)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return
+		}
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
+
+// Snapshot returns the aircraft seen within the tracker's timeout
+func (c *Client) Snapshot(now time.Time) *models.AutoGenerated {
+	return c.Tracker.Snapshot(now)
+}
+
+// Err returns why the client is disconnected, or nil while it is connected
+func (c *Client) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+func (c *Client) setErr(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.err = err
+}
+
+// read connects and reads messages until the connection fails, reporting whether it connected
+func (c *Client) read(ctx context.Context) (bool, error) {
+	dialer := net.Dialer{Timeout: 10 * time.Second}
+	conn, err := dialer.DialContext(ctx, c.Network, c.Address)
+	if err != nil {
+		return false, fmt.Errorf("failed to connect: %w", err)
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	c.setErr(nil)
+
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		m, err := Parse(scanner.Text())
+		if err != nil {
+			// Skip heartbeats and other message types
+			continue
+		}
+		c.Tracker.Update(m, time.Now())
+	}
+	if err := scanner.Err(); err != nil {
+		return true, fmt.Errorf("connection lost: %w", err)
+	}
+	return true, errors.New("connection closed")
+}
@@ -0,0 +1,61 @@
+package sbs
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rknightion/adsb2loki/pkg/testutil"
+)
+
+func TestClientUnixSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sbs.sock")
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer ln.Close()
+
+	// Each connection sends one aircraft and is then closed, forcing a reconnect
+	lines := []string{
+		"MSG,3,1,1,4CA7B5,1,,,,,,36000,,,51.4775,-0.46139,,,0,0,0,0\r\n",
+		"MSG,1,1,1,400A1B,1,,,,,BAW12   ,,,,,,,,,,,0\r\n",
+	}
+	go func() {
+		defer ln.Close()
+		for _, line := range lines {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Write([]byte("STA,,,,,,,,,,,,,,,,,,,,,\r\n" + line))
+			conn.Close()
+		}
+	}()
+
+	client := NewClient("unix", path)
+	if client.Err() == nil {
+		t.Error("Expected an error before connecting")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		client.Run(ctx)
+		close(done)
+	}()
+
+	testutil.WaitFor(t, "both aircraft", func() bool {
+		return len(client.Tracker.Snapshot(time.Now()).Aircraft) == 2
+	})
+	testutil.WaitFor(t, "the disconnect", func() bool { return client.Err() != nil })
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected Run to return after cancelling")
+	}
+}
@@ -0,0 +1,126 @@
+// Package sbs reads BaseStation (SBS) streams, the CSV format readsb and dump1090 serve on port
+// 30003, and turns them into aircraft.json snapshots
+package sbs
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrFormat is returned for lines that aren't SBS messages
+var ErrFormat = errors.New("invalid SBS message")
+
+// Message is one SBS line. Optional fields are nil when the message doesn't carry them.
+type Message struct {
+	Type         string // MSG, or MLAT for positions from multilateration
+	Transmission int    // 1 to 8
+	Hex          string
+	Callsign     string
+	Altitude     *float64 // Feet
+	GroundSpeed  *float64 // Knots
+	Track        *float64 // Degrees
+	Lat          *float64
+	Lon          *float64
+	VerticalRate *float64 // Feet per minute
+	Squawk       string
+	Alert        *bool
+	Emergency    *bool
+	SPI          *bool
+	OnGround     *bool
+}
+
+// Field indexes of an SBS line
+const (
+	fieldType         = 0
+	fieldTransmission = 1
+	fieldHex          = 4
+	fieldCallsign     = 10
+	fieldAltitude     = 11
+	fieldGroundSpeed  = 12
+	fieldTrack        = 13
+	fieldLat          = 14
+	fieldLon          = 15
+	fieldVerticalRate = 16
+	fieldSquawk       = 17
+	fieldAlert        = 18
+	fieldEmergency    = 19
+	fieldSPI          = 20
+	fieldOnGround     = 21
+	fieldCount        = 22
+)
+
+// Parse parses one SBS line. Lines other than MSG and MLAT, such as the AIR, ID and STA
+// messages of BaseStation itself, return ErrFormat.
+func Parse(line string) (Message, error) {
+	fields := strings.Split(strings.TrimRight(line, "\r\n"), ",")
+	if len(fields) < fieldCount {
+		return Message{}, fmt.Errorf("%w: %d fields", ErrFormat, len(fields))
+	}
+	if fields[fieldType] != "MSG" && fields[fieldType] != "MLAT" {
+		return Message{}, fmt.Errorf("%w: type %q", ErrFormat, fields[fieldType])
+	}
+
+	m := Message{
+		Type:     fields[fieldType],
+		Hex:      strings.ToLower(strings.TrimSpace(fields[fieldHex])),
+		Callsign: strings.TrimSpace(fields[fieldCallsign]),
+		Squawk:   strings.TrimSpace(fields[fieldSquawk]),
+	}
+	if m.Hex == "" {
+		return Message{}, fmt.Errorf("%w: no hex ident", ErrFormat)
+	}
+	var err error
+	if m.Transmission, err = strconv.Atoi(fields[fieldTransmission]); err != nil {
+		return Message{}, fmt.Errorf("%w: transmission type %q", ErrFormat, fields[fieldTransmission])
+	}
+
+	for _, f := range []struct {
+		index int
+		value **float64
+	}{
+		{fieldAltitude, &m.Altitude},
+		{fieldGroundSpeed, &m.GroundSpeed},
+		{fieldTrack, &m.Track},
+		{fieldLat, &m.Lat},
+		{fieldLon, &m.Lon},
+		{fieldVerticalRate, &m.VerticalRate},
+	} {
+		if *f.value, err = parseFloat(fields[f.index]); err != nil {
+			return Message{}, fmt.Errorf("%w: field %d: %w", ErrFormat, f.index, err)
+		}
+	}
+	m.Alert = parseFlag(fields[fieldAlert])
+	m.Emergency = parseFlag(fields[fieldEmergency])
+	m.SPI = parseFlag(fields[fieldSPI])
+	m.OnGround = parseFlag(fields[fieldOnGround])
+	return m, nil
+}
+
+// parseFloat parses an optional number
+func parseFloat(s string) (*float64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// parseFlag parses an optional flag, which BaseStation writes as -1 for true and 0 for false
+func parseFlag(s string) *bool {
+	switch strings.TrimSpace(s) {
+	case "-1", "1":
+		v := true
+		return &v
+	case "0":
+		v := false
+		return &v
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,96 @@
+package sbs
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		check   func(t *testing.T, m Message)
+		wantErr bool
+	}{
+		{
+			name: "identification",
+			line: "MSG,1,1,1,4CA7B5,1,2026/10/19,12:00:00.000,2026/10/19,12:00:00.000,RYR7GW  ,,,,,,,,,,,0\r\n",
+			check: func(t *testing.T, m Message) {
+				if m.Hex != "4ca7b5" || m.Callsign != "RYR7GW" || m.Transmission != 1 {
+					t.Errorf("Unexpected message %+v", m)
+				}
+				if m.OnGround == nil || *m.OnGround {
+					t.Errorf("Expected airborne, got %v", m.OnGround)
+				}
+			},
+		},
+		{
+			name: "position",
+			line: "MSG,3,1,1,4CA7B5,1,2026/10/19,12:00:00.000,2026/10/19,12:00:00.000,,36000,,,51.47750,-0.46139,,,0,0,0,0",
+			check: func(t *testing.T, m Message) {
+				if m.Altitude == nil || *m.Altitude != 36000 || *m.Lat != 51.4775 || *m.Lon != -0.46139 {
+					t.Errorf("Unexpected position %+v", m)
+				}
+				if m.GroundSpeed != nil || m.Squawk != "" {
+					t.Errorf("Expected no velocity or squawk, got %+v", m)
+				}
+			},
+		},
+		{
+			name: "velocity",
+			line: "MSG,4,1,1,4CA7B5,1,2026/10/19,12:00:00.000,2026/10/19,12:00:00.000,,,451,45,,,-64,,,,,",
+			check: func(t *testing.T, m Message) {
+				if *m.GroundSpeed != 451 || *m.Track != 45 || *m.VerticalRate != -64 {
+					t.Errorf("Unexpected velocity %+v", m)
+				}
+			},
+		},
+		{
+			name: "squawk",
+			line: "MSG,6,1,1,400A1B,1,2026/10/19,12:00:00.000,2026/10/19,12:00:00.000,,,,,,,,7700,-1,-1,0,-1",
+			check: func(t *testing.T, m Message) {
+				if m.Squawk != "7700" || !*m.Alert || !*m.Emergency || *m.SPI || !*m.OnGround {
+					t.Errorf("Unexpected squawk %+v", m)
+				}
+			},
+		},
+		{
+			name: "mlat",
+			line: "MLAT,3,1,1,~2B1C3D,1,2026/10/19,12:00:00.000,2026/10/19,12:00:00.000,,2500,,,-33.94611,151.17722,,,,,,",
+			check: func(t *testing.T, m Message) {
+				if m.Type != "MLAT" || m.Hex != "~2b1c3d" {
+					t.Errorf("Unexpected message %+v", m)
+				}
+			},
+		},
+		{name: "station", line: "STA,,1,1,4CA7B5,1,2026/10/19,12:00:00.000,2026/10/19,12:00:00.000,RM,,,,,,,,,,,", wantErr: true},
+		{name: "too short", line: "MSG,3,1,1,4CA7B5", wantErr: true},
+		{name: "no hex", line: "MSG,3,1,1,,1,,,,,,36000,,,,,,,,,,", wantErr: true},
+		{name: "invalid number", line: "MSG,3,1,1,4CA7B5,1,,,,,,high,,,,,,,,,,", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := Parse(tt.line)
+			if tt.wantErr {
+				if !errors.Is(err, ErrFormat) {
+					t.Errorf("Expected ErrFormat, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			tt.check(t, m)
+		})
+	}
+}
+
+func mustParse(t *testing.T, line string) Message {
+	t.Helper()
+	m, err := Parse(line)
+	if err != nil {
+		t.Fatalf("Failed to parse %q: %v", line, err)
+	}
+	return m
+}
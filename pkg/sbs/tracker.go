@@ -0,0 +1,120 @@
+package sbs
+
+import (
+	"sync"
+	"time"
+
+	"github.com/rknightion/adsb2loki/pkg/models"
+)
+
+// DefaultTimeout is how long an aircraft stays in snapshots after its last message
+const DefaultTimeout = time.Minute
+
+// emergencies maps the emergency squawks to the emergency of aircraft.json
+var emergencies = map[string]string{
+	"7500": "unlawful",
+	"7600": "nordo",
+	"7700": "general",
+}
+
+// Tracker merges SBS messages into the latest state of each aircraft. It is safe for concurrent use.
+type Tracker struct {
+	Timeout time.Duration
+
+	mu       sync.Mutex
+	aircraft models.Tracks
+	messages int
+}
+
+// NewTracker creates a tracker with the default timeout
+func NewTracker() *Tracker {
+	return &Tracker{Timeout: DefaultTimeout, aircraft: make(models.Tracks)}
+}
+
+// Update merges a message received at now. SBS messages carry a few fields each, the
+// others keep their previous values.
+func (t *Tracker) Update(m Message, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.messages++
+	tr, ok := t.aircraft[m.Hex]
+	if !ok {
+		tr = &models.Track{Aircraft: models.Aircraft{Hex: m.Hex, Mlat: []interface{}{}, Tisb: []interface{}{}}}
+		t.aircraft[m.Hex] = tr
+	}
+	tr.Seen = now
+	a := &tr.Aircraft
+	a.Messages++
+
+	if m.Callsign != "" {
+		a.Flight = m.Callsign
+	}
+	if m.OnGround != nil && *m.OnGround {
+		a.AltBaro = models.AltitudeGround
+	} else if m.Altitude != nil {
+		a.AltBaro = *m.Altitude
+	}
+	if m.GroundSpeed != nil {
+		a.Gs = *m.GroundSpeed
+	}
+	if m.Track != nil {
+		a.Track = *m.Track
+	}
+	if m.Lat != nil && m.Lon != nil {
+		a.Lat, a.Lon = *m.Lat, *m.Lon
+		tr.SeenPos = now
+		if m.Type == "MLAT" {
+			a.Type = "mlat"
+		} else if a.Type == "mlat" {
+			a.Type = ""
+		}
+	}
+	if m.VerticalRate != nil {
+		a.BaroRate = *m.VerticalRate
+	}
+	if m.Squawk != "" {
+		a.Squawk = m.Squawk
+	}
+	if m.Emergency != nil {
+		a.Emergency = emergency(*m.Emergency, a.Squawk)
+	}
+	if m.Alert != nil {
+		a.Alert = flag(*m.Alert)
+	}
+	if m.SPI != nil {
+		a.Spi = flag(*m.SPI)
+	}
+}
+
+// Snapshot returns the aircraft seen within the timeout as of now, ordered by hex, and removes the others
+func (t *Tracker) Snapshot(now time.Time) *models.AutoGenerated {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return &models.AutoGenerated{
+		Now:      float64(now.UnixNano()) / float64(time.Second),
+		Messages: t.messages,
+		Aircraft: t.aircraft.Snapshot(now, t.Timeout),
+	}
+}
+
+// emergency converts the emergency flag to the emergency of aircraft.json. SBS only has a flag,
+// the kind of emergency is told by the squawk.
+func emergency(v bool, squawk string) string {
+	if !v {
+		return "none"
+	}
+	if kind, ok := emergencies[squawk]; ok {
+		return kind
+	}
+	return "general"
+}
+
+// flag converts a flag to the 0 or 1 of aircraft.json
+func flag(v bool) int {
+	if v {
+		return 1
+	}
+	return 0
+}
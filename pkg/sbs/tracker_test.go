@@ -0,0 +1,99 @@
+package sbs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rknightion/adsb2loki/pkg/models"
+)
+
+func TestTracker(t *testing.T) {
+	tracker := NewTracker()
+	start := time.Unix(1760875200, 0)
+
+	tracker.Update(mustParse(t, "MSG,1,1,1,4CA7B5,1,,,,,RYR7GW  ,,,,,,,,,,,0"), start)
+	tracker.Update(mustParse(t, "MSG,3,1,1,4CA7B5,1,,,,,,36000,,,51.4775,-0.46139,,,0,0,0,0"), start.Add(time.Second))
+	tracker.Update(mustParse(t, "MSG,4,1,1,4CA7B5,1,,,,,,,451,45,,,-64,,,,,"), start.Add(2*time.Second))
+	tracker.Update(mustParse(t, "MSG,6,1,1,400A1B,1,,,,,,,,,,,,7700,-1,-1,0,-1"), start)
+
+	snapshot := tracker.Snapshot(start.Add(2500 * time.Millisecond))
+	if snapshot.Messages != 4 || len(snapshot.Aircraft) != 2 {
+		t.Fatalf("Unexpected snapshot %+v", snapshot)
+	}
+	if snapshot.Now != 1760875202.5 {
+		t.Errorf("Expected now 1760875202.5, got %v", snapshot.Now)
+	}
+
+	ground := snapshot.Aircraft[0]
+	if ground.Hex != "400a1b" || !ground.OnGround() || ground.Squawk != "7700" || ground.Alert != 1 || ground.HasPosition() {
+		t.Errorf("Unexpected aircraft %+v", ground)
+	}
+	if ground.Emergency != "general" {
+		t.Errorf("Expected the general emergency of squawk 7700, got %q", ground.Emergency)
+	}
+
+	a := snapshot.Aircraft[1]
+	if a.Callsign() != "RYR7GW" || a.Track != 45 || a.Lat != 51.4775 {
+		t.Errorf("Unexpected aircraft %+v", a)
+	}
+	if alt, _ := a.Altitude(); alt != 36000 {
+		t.Errorf("Expected altitude 36000, got %v", alt)
+	}
+	if gs, _ := models.Float(a.Gs); gs != 451 {
+		t.Errorf("Expected ground speed 451, got %v", a.Gs)
+	}
+	if a.Seen != 0.5 || a.SeenPos != 1.5 || a.Messages != 3 {
+		t.Errorf("Expected seen 0.5, seen_pos 1.5 and 3 messages, got %v, %v and %d", a.Seen, a.SeenPos, a.Messages)
+	}
+	if a.Emergency != "none" {
+		t.Errorf("Expected no emergency, got %q", a.Emergency)
+	}
+
+	// An MLAT position marks the aircraft as multilaterated
+	tracker.Update(mustParse(t, "MLAT,3,1,1,4CA7B5,1,,,,,,36025,,,51.48,-0.45,,,,,,"), start.Add(3*time.Second))
+	if a := tracker.Snapshot(start.Add(3 * time.Second)).Aircraft[1]; a.Type != "mlat" || a.Source() != "mlat" {
+		t.Errorf("Expected type mlat, got %q", a.Type)
+	}
+
+	// Messages without a position refresh seen, while seen_pos keeps ageing
+	tracker.Update(mustParse(t, "MSG,4,1,1,4CA7B5,1,,,,,,,450,46,,,-64,,,,,"), start.Add(5*time.Second))
+	if a := tracker.Snapshot(start.Add(5500 * time.Millisecond)).Aircraft[1]; a.Seen != 0.5 || a.SeenPos != 2.5 || a.Type != "mlat" {
+		t.Errorf("Expected seen 0.5 and seen_pos 2.5 of the MLAT position, got %v and %v, type %q", a.Seen, a.SeenPos, a.Type)
+	}
+
+	// An ADS-B position clears the MLAT type
+	tracker.Update(mustParse(t, "MSG,3,1,1,4CA7B5,1,,,,,,36050,,,51.49,-0.44,,,0,0,0,0"), start.Add(6*time.Second))
+	if a := tracker.Snapshot(start.Add(6 * time.Second)).Aircraft[1]; a.Type != "" || a.SeenPos != 0 {
+		t.Errorf("Expected a fresh ADS-B position, got type %q and seen_pos %v", a.Type, a.SeenPos)
+	}
+
+	// Aircraft expire after the timeout
+	snapshot = tracker.Snapshot(start.Add(time.Second + DefaultTimeout + time.Second))
+	if len(snapshot.Aircraft) != 1 || snapshot.Aircraft[0].Hex != "4ca7b5" {
+		t.Errorf("Expected only 4ca7b5 after the timeout, got %+v", snapshot.Aircraft)
+	}
+	snapshot = tracker.Snapshot(start.Add(6*time.Second + DefaultTimeout + time.Second))
+	if len(snapshot.Aircraft) != 0 {
+		t.Errorf("Expected all aircraft to expire, got %+v", snapshot.Aircraft)
+	}
+}
+
+func TestEmergency(t *testing.T) {
+	tests := []struct {
+		flag   bool
+		squawk string
+		want   string
+	}{
+		{false, "7700", "none"},
+		{true, "7500", "unlawful"},
+		{true, "7600", "nordo"},
+		{true, "7700", "general"},
+		{true, "", "general"},
+	}
+
+	for _, tt := range tests {
+		if got := emergency(tt.flag, tt.squawk); got != tt.want {
+			t.Errorf("Expected %q for %v and squawk %q, got %q", tt.want, tt.flag, tt.squawk, got)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package session
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rknightion/adsb2loki/pkg/models"
+)
+
+// DefaultGapTimeout is how long an aircraft can go unseen before its next sighting starts a new session
+const DefaultGapTimeout = 10 * time.Minute
+
+// Session represents one continuous sighting of an aircraft
+type Session struct {
+	ID              string
+	Hex             string
+	Callsign        string
+	FirstSeen       time.Time
+	LastSeen        time.Time
+	MaxAltitude     float64 // Highest altitude seen in feet, valid when HasAltitude is set
+	HasAltitude     bool
+	ClosestDistance float64 // Closest distance to the receiver in nautical miles, valid when HasDistance is set
+	HasDistance     bool
+	Samples         int
+}
+
+// Duration returns the time between the first and last sighting
+func (s Session) Duration() time.Duration {
+	return s.LastSeen.Sub(s.FirstSeen)
+}
+
+// Tracker assigns session IDs to aircraft sightings keyed by hex
+type Tracker struct {
+	mu         sync.Mutex
+	gapTimeout time.Duration
+	sessions   map[string]*Session
+}
+
+// NewTracker creates a new session tracker. A gap timeout of zero uses DefaultGapTimeout.
+func NewTracker(gapTimeout time.Duration) *Tracker {
+	if gapTimeout <= 0 {
+		gapTimeout = DefaultGapTimeout
+	}
+	return &Tracker{
+		gapTimeout: gapTimeout,
+		sessions:   make(map[string]*Session),
+	}
+}
+
+// GapTimeout returns the configured gap timeout
+func (t *Tracker) GapTimeout() time.Duration {
+	return t.gapTimeout
+}
+
+// Observe records a sighting of an aircraft at the given time and returns its current session.
+// The second return value is true when the sighting started a new session.
+func (t *Tracker) Observe(aircraft *models.Aircraft, ts time.Time) (Session, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	hex := strings.ToLower(aircraft.Hex)
+	s, ok := t.sessions[hex]
+	started := false
+	if !ok || ts.Sub(s.LastSeen) > t.gapTimeout {
+		s = &Session{
+			ID:        newID(hex, ts),
+			Hex:       hex,
+			FirstSeen: ts,
+		}
+		t.sessions[hex] = s
+		started = true
+	}
+
+	if ts.After(s.LastSeen) {
+		s.LastSeen = ts
+	}
+	s.Samples++
+
+	if callsign := aircraft.Callsign(); callsign != "" {
+		s.Callsign = callsign
+	}
+
+	if alt, ok := aircraft.Altitude(); ok && (!s.HasAltitude || alt > s.MaxAltitude) {
+		s.MaxAltitude = alt
+		s.HasAltitude = true
+	}
+
+	if aircraft.RDst > 0 && (!s.HasDistance || aircraft.RDst < s.ClosestDistance) {
+		s.ClosestDistance = aircraft.RDst
+		s.HasDistance = true
+	}
+
+	return *s, started
+}
+
+// Get returns the current session for a hex, if any
+func (t *Tracker) Get(hex string) (Session, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s, ok := t.sessions[strings.ToLower(hex)]
+	if !ok {
+		return Session{}, false
+	}
+	return *s, true
+}
+
+// Expire removes sessions that have not been seen within the gap timeout and returns them
+// ordered by last sighting
+func (t *Tracker) Expire(now time.Time) []Session {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var expired []Session
+	for hex, s := range t.sessions {
+		if now.Sub(s.LastSeen) > t.gapTimeout {
+			expired = append(expired, *s)
+			delete(t.sessions, hex)
+		}
+	}
+
+	sort.Slice(expired, func(i, j int) bool {
+		return expired[i].LastSeen.Before(expired[j].LastSeen)
+	})
+	return expired
+}
+
+// Len returns the number of active sessions
+func (t *Tracker) Len() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.sessions)
+}
+
+// newID builds a session ID that is stable for the lifetime of the session
+func newID(hex string, firstSeen time.Time) string {
+	return fmt.Sprintf("%s-%d", hex, firstSeen.Unix())
+}
@@ -0,0 +1,84 @@
+package session
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rknightion/adsb2loki/pkg/models"
+)
+
+func TestTrackerObserve(t *testing.T) {
+	tracker := NewTracker(5 * time.Minute)
+	start := time.Unix(1748083431, 0)
+
+	first, started := tracker.Observe(&models.Aircraft{Hex: "4CA614", Flight: "EIN581  ", AltBaro: float64(12000), RDst: 40}, start)
+	if !started {
+		t.Error("Expected first sighting to start a session")
+	}
+	if first.ID != "4ca614-1748083431" {
+		t.Errorf("Expected session ID 4ca614-1748083431, got %s", first.ID)
+	}
+
+	// Continuous sighting keeps the same session and updates the aggregates
+	second, started := tracker.Observe(&models.Aircraft{Hex: "4ca614", AltBaro: float64(39000), RDst: 12.5}, start.Add(time.Minute))
+	if started {
+		t.Error("Expected continuous sighting to keep the session")
+	}
+	if second.ID != first.ID {
+		t.Errorf("Expected session ID %s, got %s", first.ID, second.ID)
+	}
+	if second.MaxAltitude != 39000 {
+		t.Errorf("Expected max altitude 39000, got %f", second.MaxAltitude)
+	}
+	if second.ClosestDistance != 12.5 {
+		t.Errorf("Expected closest distance 12.5, got %f", second.ClosestDistance)
+	}
+	if second.Callsign != "EIN581" {
+		t.Errorf("Expected callsign EIN581, got %s", second.Callsign)
+	}
+	if second.Duration() != time.Minute {
+		t.Errorf("Expected duration 1m, got %v", second.Duration())
+	}
+	if second.Samples != 2 {
+		t.Errorf("Expected 2 samples, got %d", second.Samples)
+	}
+
+	// A sighting after the gap timeout starts a new session
+	later := start.Add(3 * time.Hour)
+	third, started := tracker.Observe(&models.Aircraft{Hex: "4ca614", AltBaro: float64(5000)}, later)
+	if !started {
+		t.Error("Expected sighting after the gap to start a new session")
+	}
+	if third.ID == first.ID {
+		t.Errorf("Expected a new session ID, got %s again", third.ID)
+	}
+	if third.MaxAltitude != 5000 || third.HasDistance {
+		t.Errorf("Expected fresh aggregates, got %+v", third)
+	}
+}
+
+func TestTrackerExpire(t *testing.T) {
+	tracker := NewTracker(time.Minute)
+	now := time.Now()
+
+	tracker.Observe(&models.Aircraft{Hex: "abc123"}, now.Add(-5*time.Minute))
+	tracker.Observe(&models.Aircraft{Hex: "def456"}, now)
+
+	expired := tracker.Expire(now)
+	if len(expired) != 1 || expired[0].Hex != "abc123" {
+		t.Fatalf("Expected abc123 to expire, got %+v", expired)
+	}
+	if tracker.Len() != 1 {
+		t.Errorf("Expected 1 active session, got %d", tracker.Len())
+	}
+	if _, ok := tracker.Get("DEF456"); !ok {
+		t.Error("Expected def456 to still be tracked")
+	}
+}
+
+func TestNewTrackerDefaultGap(t *testing.T) {
+	tracker := NewTracker(0)
+	if tracker.GapTimeout() != DefaultGapTimeout {
+		t.Errorf("Expected default gap timeout %v, got %v", DefaultGapTimeout, tracker.GapTimeout())
+	}
+}
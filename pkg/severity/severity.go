@@ -0,0 +1,107 @@
+package severity
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rknightion/adsb2loki/pkg/models"
+)
+
+// Key is the label or structured metadata key carrying the level of an entry
+const Key = "level"
+
+// Level is the severity of a log entry
+type Level string
+
+const (
+	Debug Level = "debug"
+	Info  Level = "info"
+	Warn  Level = "warn"
+	Error Level = "error"
+	Fatal Level = "fatal"
+)
+
+// rank orders the levels from least to most severe
+var rank = map[Level]int{
+	Debug: 1,
+	Info:  2,
+	Warn:  3,
+	Error: 4,
+	Fatal: 5,
+}
+
+// ParseLevel parses a level name, accepting "warning" as an alias for warn
+func ParseLevel(s string) (Level, error) {
+	level := Level(strings.ToLower(strings.TrimSpace(s)))
+	if level == "warning" {
+		level = Warn
+	}
+	if _, ok := rank[level]; !ok {
+		return "", fmt.Errorf("invalid level %q: must be debug, info, warn, error or fatal", s)
+	}
+	return level, nil
+}
+
+// Max returns the more severe of two levels
+func Max(a, b Level) Level {
+	if rank[b] > rank[a] {
+		return b
+	}
+	return a
+}
+
+// Rules classify aircraft into levels
+type Rules struct {
+	SquawkLevels   map[string]Level // Level per transponder code
+	EmergencyLevel Level            // Level when the emergency field is set to anything but none
+	MinNacP        int              // Reported NACp below this is degraded
+	MinSil         int              // Reported SIL below this is degraded
+	DegradedLevel  Level
+	StaleAfter     time.Duration // Positions older than this are stale
+	StaleLevel     Level
+}
+
+// DefaultRules returns the default classification rules
+func DefaultRules() Rules {
+	return Rules{
+		SquawkLevels: map[string]Level{
+			"7500": Fatal,
+			"7600": Error,
+			"7700": Fatal,
+		},
+		EmergencyLevel: Error,
+		MinNacP:        7,
+		MinSil:         2,
+		DegradedLevel:  Warn,
+		StaleAfter:     30 * time.Second,
+		StaleLevel:     Debug,
+	}
+}
+
+// Classify returns the level of an aircraft. Emergencies and degraded integrity raise the level,
+// a stale position lowers it to the stale level when nothing else applies.
+func (r Rules) Classify(aircraft *models.Aircraft) Level {
+	var level Level
+	if l, ok := r.SquawkLevels[aircraft.Squawk]; ok {
+		level = Max(level, l)
+	}
+	if aircraft.Emergency != "" && aircraft.Emergency != "none" && r.EmergencyLevel != "" {
+		level = Max(level, r.EmergencyLevel)
+	}
+
+	// Integrity fields are omitted when unknown, so only reported values count
+	if r.DegradedLevel != "" {
+		if (aircraft.NacP > 0 && aircraft.NacP < r.MinNacP) || (aircraft.Sil > 0 && aircraft.Sil < r.MinSil) {
+			level = Max(level, r.DegradedLevel)
+		}
+	}
+
+	if level != "" {
+		return level
+	}
+	if r.StaleAfter > 0 && r.StaleLevel != "" && time.Duration(aircraft.SeenPos*float64(time.Second)) > r.StaleAfter {
+		return r.StaleLevel
+	}
+	return Info
+}
@@ -0,0 +1,55 @@
+package severity
+
+import (
+	"testing"
+
+	"github.com/rknightion/adsb2loki/pkg/models"
+)
+
+func TestClassify(t *testing.T) {
+	rules := DefaultRules()
+
+	tests := []struct {
+		name     string
+		aircraft models.Aircraft
+		expected Level
+	}{
+		{"normal", models.Aircraft{Squawk: "1234", Emergency: "none", NacP: 9, Sil: 3, SeenPos: 1}, Info},
+		{"hijack", models.Aircraft{Squawk: "7500"}, Fatal},
+		{"radio failure", models.Aircraft{Squawk: "7600"}, Error},
+		{"general emergency", models.Aircraft{Squawk: "7700"}, Fatal},
+		{"emergency field", models.Aircraft{Emergency: "lifeguard"}, Error},
+		{"low nacp", models.Aircraft{NacP: 4, Sil: 3}, Warn},
+		{"low sil", models.Aircraft{NacP: 9, Sil: 1}, Warn},
+		{"unreported integrity", models.Aircraft{}, Info},
+		{"stale position", models.Aircraft{SeenPos: 45}, Debug},
+		{"stale emergency stays fatal", models.Aircraft{Squawk: "7700", SeenPos: 45}, Fatal},
+		{"degraded emergency", models.Aircraft{Squawk: "7600", NacP: 2}, Error},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if level := rules.Classify(&tt.aircraft); level != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, level)
+			}
+		})
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	if level, err := ParseLevel(" WARNING "); err != nil || level != Warn {
+		t.Errorf("Expected warn, got %s, %v", level, err)
+	}
+	if level, err := ParseLevel("fatal"); err != nil || level != Fatal {
+		t.Errorf("Expected fatal, got %s, %v", level, err)
+	}
+	if _, err := ParseLevel("critical"); err == nil {
+		t.Error("Expected error for unknown level")
+	}
+}
+
+func TestMax(t *testing.T) {
+	if Max(Warn, Error) != Error || Max(Fatal, Debug) != Fatal || Max("", Info) != Info {
+		t.Error("Expected Max to return the more severe level")
+	}
+}
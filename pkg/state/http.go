@@ -0,0 +1,107 @@
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Response is the aircraft.json compatible list of aircraft
+type Response struct {
+	Now      float64 `json:"now"`
+	Messages int     `json:"messages"`
+	Aircraft []Entry `json:"aircraft"`
+}
+
+// Register adds the API routes to a mux:
+// GET /api/aircraft and /data/aircraft.json list aircraft, GET /api/aircraft/{hex} returns one
+func (s *Store) Register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/aircraft", s.HandleList)
+	mux.HandleFunc("GET /data/aircraft.json", s.HandleList)
+	mux.HandleFunc("GET /api/aircraft/{hex}", s.HandleGet)
+}
+
+// HandleList serves the aircraft matching the bbox, min_alt, max_alt and category query parameters
+func (s *Store) HandleList(w http.ResponseWriter, r *http.Request) {
+	f, err := ParseFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	writeJSON(w, http.StatusOK, Response{
+		Now:      float64(now.UnixMilli()) / 1000,
+		Messages: s.Messages(),
+		Aircraft: s.List(f, now),
+	})
+}
+
+// HandleGet serves a single aircraft by hex
+func (s *Store) HandleGet(w http.ResponseWriter, r *http.Request) {
+	e, ok := s.Get(r.PathValue("hex"), time.Now())
+	if !ok {
+		http.Error(w, "aircraft not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, e)
+}
+
+// ParseFilter parses the filter query parameters:
+// bbox=MIN_LAT,MIN_LON,MAX_LAT,MAX_LON, min_alt and max_alt in feet, and a comma separated category list
+func ParseFilter(q url.Values) (Filter, error) {
+	var f Filter
+
+	if value := q.Get("bbox"); value != "" {
+		parts := strings.Split(value, ",")
+		if len(parts) != 4 {
+			return f, fmt.Errorf("invalid bbox %q: expected MIN_LAT,MIN_LON,MAX_LAT,MAX_LON", value)
+		}
+		var coords [4]float64
+		for i, part := range parts {
+			v, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+			if err != nil {
+				return f, fmt.Errorf("invalid bbox %q: %w", value, err)
+			}
+			coords[i] = v
+		}
+		f.BBox = &BBox{MinLat: coords[0], MinLon: coords[1], MaxLat: coords[2], MaxLon: coords[3]}
+	}
+
+	bounds := map[string]**float64{
+		"min_alt": &f.MinAltitude,
+		"max_alt": &f.MaxAltitude,
+	}
+	for key, target := range bounds {
+		value := q.Get(key)
+		if value == "" {
+			continue
+		}
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return f, fmt.Errorf("invalid %s %q: %w", key, value, err)
+		}
+		*target = &v
+	}
+
+	for _, value := range q["category"] {
+		for _, c := range strings.Split(value, ",") {
+			if c = strings.TrimSpace(c); c != "" {
+				f.Categories = append(f.Categories, c)
+			}
+		}
+	}
+
+	return f, nil
+}
+
+// writeJSON writes v as a JSON response
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
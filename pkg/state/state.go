@@ -0,0 +1,256 @@
+package state
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rknightion/adsb2loki/pkg/alert"
+	"github.com/rknightion/adsb2loki/pkg/models"
+	"github.com/rknightion/adsb2loki/pkg/session"
+	"github.com/rknightion/adsb2loki/pkg/severity"
+)
+
+// DefaultTTL is how long an aircraft stays in the table after it was last seen
+const DefaultTTL = time.Minute
+
+// maxAlerts caps the alerts kept per aircraft
+const maxAlerts = 10
+
+// maxTrail caps the positions kept per aircraft for drawing trails
+const maxTrail = 30
+
+// TrailPoint is a past position of an aircraft
+type TrailPoint struct {
+	Lat      float64   `json:"lat"`
+	Lon      float64   `json:"lon"`
+	Altitude *float64  `json:"alt,omitempty"`
+	Time     time.Time `json:"time"`
+}
+
+// Entry is the current state of one aircraft: the aircraft.json fields plus enrichment
+type Entry struct {
+	models.Aircraft
+	SessionID string         `json:"session_id,omitempty"`
+	FirstSeen time.Time      `json:"first_seen,omitzero"`
+	Level     severity.Level `json:"level,omitempty"`
+	Alerts    []alert.Alert  `json:"alerts,omitempty"`
+	Trail     []TrailPoint   `json:"trail,omitempty"` // Recent positions, oldest first
+
+	updated time.Time // When the aircraft was last reported, seen is relative to this
+}
+
+// Filter selects aircraft, zero values match everything
+type Filter struct {
+	BBox        *BBox
+	MinAltitude *float64
+	MaxAltitude *float64
+	Categories  []string
+}
+
+// BBox is a latitude/longitude bounding box
+type BBox struct {
+	MinLat, MinLon, MaxLat, MaxLon float64
+}
+
+// Contains reports whether a position is inside the box
+func (b BBox) Contains(lat, lon float64) bool {
+	return lat >= b.MinLat && lat <= b.MaxLat && lon >= b.MinLon && lon <= b.MaxLon
+}
+
+// Match reports whether an aircraft passes the filter
+func (f Filter) Match(e *Entry) bool {
+	if f.BBox != nil && (!e.HasPosition() || !f.BBox.Contains(e.Lat, e.Lon)) {
+		return false
+	}
+	if f.MinAltitude != nil || f.MaxAltitude != nil {
+		alt, ok := e.Altitude()
+		if !ok {
+			return false
+		}
+		if f.MinAltitude != nil && alt < *f.MinAltitude {
+			return false
+		}
+		if f.MaxAltitude != nil && alt > *f.MaxAltitude {
+			return false
+		}
+	}
+	if len(f.Categories) > 0 {
+		found := false
+		for _, c := range f.Categories {
+			if strings.EqualFold(c, e.Category) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// Store holds the latest state of every aircraft seen by any input
+type Store struct {
+	mu       sync.RWMutex
+	ttl      time.Duration
+	aircraft map[string]*Entry // Keyed by lowercase hex
+	messages int
+}
+
+// NewStore creates a new store keeping aircraft for ttl after they were last seen
+func NewStore(ttl time.Duration) *Store {
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	return &Store{
+		ttl:      ttl,
+		aircraft: make(map[string]*Entry),
+	}
+}
+
+// Update records the latest report of an aircraft at ts, keeping alerts raised earlier. When
+// several inputs report the same aircraft, a report older than the one held is ignored.
+func (s *Store) Update(aircraft *models.Aircraft, ts time.Time, sess session.Session, level severity.Level) {
+	hex := strings.ToLower(aircraft.Hex)
+	if hex == "" {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.aircraft[hex]
+	if !ok || (sess.ID != "" && e.SessionID != sess.ID) {
+		e = &Entry{}
+		s.aircraft[hex] = e
+	} else if seen := ts.Add(-seconds(aircraft.Seen)); seen.Before(e.lastSeen()) {
+		return
+	}
+	e.Aircraft = *aircraft
+	e.appendTrail(ts)
+	e.SessionID = sess.ID
+	e.FirstSeen = sess.FirstSeen
+	e.Level = level
+	e.updated = ts
+}
+
+// lastSeen returns when the aircraft was last heard, as opposed to when it was last reported
+func (e *Entry) lastSeen() time.Time {
+	return e.updated.Add(-seconds(e.Seen))
+}
+
+// seconds converts an age in seconds, as in aircraft.json, to a duration
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// RecordAlert attaches an alert to its aircraft
+func (s *Store) RecordAlert(a alert.Alert) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.aircraft[strings.ToLower(a.Hex)]
+	if !ok {
+		return
+	}
+	e.Alerts = append(e.Alerts, a)
+	if len(e.Alerts) > maxAlerts {
+		e.Alerts = e.Alerts[len(e.Alerts)-maxAlerts:]
+	}
+}
+
+// SetMessages keeps the receiver's message counter for aircraft.json compatible responses
+func (s *Store) SetMessages(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages = n
+}
+
+// Expire drops aircraft last seen longer than the TTL before now
+func (s *Store) Expire(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for hex, e := range s.aircraft {
+		if now.Sub(e.lastSeen()) > s.ttl {
+			delete(s.aircraft, hex)
+		}
+	}
+}
+
+// Get returns the current state of an aircraft
+func (s *Store) Get(hex string, now time.Time) (Entry, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	e, ok := s.aircraft[strings.ToLower(hex)]
+	if !ok {
+		return Entry{}, false
+	}
+	return e.at(now), true
+}
+
+// List returns the aircraft matching the filter, sorted by hex
+func (s *Store) List(f Filter, now time.Time) []Entry {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	entries := []Entry{}
+	for _, e := range s.aircraft {
+		if f.Match(e) {
+			entries = append(entries, e.at(now))
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Hex < entries[j].Hex })
+	return entries
+}
+
+// Messages returns the message counter of the latest snapshot
+func (s *Store) Messages() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.messages
+}
+
+// Len returns the number of aircraft in the table
+func (s *Store) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.aircraft)
+}
+
+// at returns a copy of the entry with seen and seen_pos aged to now, as aircraft.json would report them
+func (e *Entry) at(now time.Time) Entry {
+	c := *e
+	c.Alerts = append([]alert.Alert(nil), e.Alerts...)
+	c.Trail = append([]TrailPoint(nil), e.Trail...)
+	if age := now.Sub(e.updated).Seconds(); age > 0 {
+		c.Seen = math.Round((c.Seen+age)*10) / 10
+		if c.HasPosition() {
+			c.SeenPos = math.Round((c.SeenPos+age)*10) / 10
+		}
+	}
+	return c
+}
+
+// appendTrail adds the current position to the trail when it moved
+func (e *Entry) appendTrail(ts time.Time) {
+	if !e.HasPosition() {
+		return
+	}
+	if n := len(e.Trail); n > 0 && e.Trail[n-1].Lat == e.Lat && e.Trail[n-1].Lon == e.Lon {
+		return
+	}
+
+	p := TrailPoint{Lat: e.Lat, Lon: e.Lon, Time: ts.Add(-seconds(e.SeenPos))}
+	if alt, ok := e.Altitude(); ok {
+		p.Altitude = &alt
+	}
+	e.Trail = append(e.Trail, p)
+	if len(e.Trail) > maxTrail {
+		e.Trail = e.Trail[len(e.Trail)-maxTrail:]
+	}
+}
@@ -0,0 +1,206 @@
+package state
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/rknightion/adsb2loki/pkg/alert"
+	"github.com/rknightion/adsb2loki/pkg/models"
+	"github.com/rknightion/adsb2loki/pkg/session"
+	"github.com/rknightion/adsb2loki/pkg/severity"
+)
+
+// newTestStore creates a store with two aircraft reported at ts
+func newTestStore(ts time.Time) *Store {
+	s := NewStore(time.Minute)
+	s.Update(&models.Aircraft{Hex: "ABC123", Flight: "BAW1  ", Category: "A3", Lat: 51.5, Lon: -0.1, AltBaro: float64(35000), Seen: 0.5, SeenPos: 1},
+		ts, session.Session{ID: "abc123-1", FirstSeen: ts.Add(-time.Hour)}, severity.Info)
+	s.Update(&models.Aircraft{Hex: "def456", Category: "A1", AltBaro: "ground"}, ts, session.Session{}, severity.Info)
+	s.SetMessages(1000)
+	return s
+}
+
+func TestStoreGet(t *testing.T) {
+	ts := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	s := newTestStore(ts)
+	s.RecordAlert(alert.Alert{Hex: "abc123", Reason: alert.ReasonWatchlist})
+
+	e, ok := s.Get("abc123", ts.Add(2*time.Second))
+	if !ok {
+		t.Fatal("Expected aircraft abc123")
+	}
+	if e.SessionID != "abc123-1" || len(e.Alerts) != 1 {
+		t.Errorf("Unexpected enrichment %+v", e)
+	}
+	if e.Seen != 2.5 || e.SeenPos != 3 {
+		t.Errorf("Expected seen 2.5 and seen_pos 3, got %v and %v", e.Seen, e.SeenPos)
+	}
+
+	if _, ok := s.Get("ffffff", ts); ok {
+		t.Error("Expected unknown aircraft to be missing")
+	}
+}
+
+func TestStoreExpire(t *testing.T) {
+	ts := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	s := newTestStore(ts)
+
+	s.Expire(ts.Add(59 * time.Second))
+	if s.Len() != 2 {
+		t.Errorf("Expected 2 aircraft within the TTL, got %d", s.Len())
+	}
+
+	s.Expire(ts.Add(61 * time.Second))
+	if s.Len() != 0 {
+		t.Errorf("Expected all aircraft to expire, got %d", s.Len())
+	}
+}
+
+func TestParseFilter(t *testing.T) {
+	ts := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	s := newTestStore(ts)
+
+	tests := []struct {
+		name    string
+		query   string
+		want    []string
+		wantErr bool
+	}{
+		{name: "no filter", query: "", want: []string{"ABC123", "def456"}},
+		{name: "bbox", query: "bbox=51,-1,52,0", want: []string{"ABC123"}},
+		{name: "bbox excludes", query: "bbox=40,-1,41,0", want: []string{}},
+		{name: "min altitude", query: "min_alt=10000", want: []string{"ABC123"}},
+		{name: "max altitude includes ground", query: "max_alt=100", want: []string{"def456"}},
+		{name: "category", query: "category=a1,B2", want: []string{"def456"}},
+		{name: "invalid bbox", query: "bbox=1,2,3", wantErr: true},
+		{name: "invalid altitude", query: "min_alt=high", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, _ := url.ParseQuery(tt.query)
+			f, err := ParseFilter(q)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseFilter() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			entries := s.List(f, ts)
+			if len(entries) != len(tt.want) {
+				t.Fatalf("Expected %v, got %d aircraft", tt.want, len(entries))
+			}
+			for i, e := range entries {
+				if e.Hex != tt.want[i] {
+					t.Errorf("Expected %s at %d, got %s", tt.want[i], i, e.Hex)
+				}
+			}
+		})
+	}
+}
+
+func TestHTTP(t *testing.T) {
+	s := newTestStore(time.Now())
+	mux := http.NewServeMux()
+	s.Register(mux)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	tests := []struct {
+		name string
+		path string
+		want int
+	}{
+		{name: "list", path: "/api/aircraft", want: http.StatusOK},
+		{name: "aircraft.json", path: "/data/aircraft.json?category=A3", want: http.StatusOK},
+		{name: "single", path: "/api/aircraft/abc123", want: http.StatusOK},
+		{name: "unknown", path: "/api/aircraft/ffffff", want: http.StatusNotFound},
+		{name: "bad filter", path: "/api/aircraft?bbox=x", want: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := server.Client().Get(server.URL + tt.path)
+			if err != nil {
+				t.Fatalf("Request failed: %v", err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tt.want {
+				t.Errorf("Expected status %d, got %d", tt.want, resp.StatusCode)
+			}
+		})
+	}
+
+	// The list decodes as aircraft.json
+	resp, err := server.Client().Get(server.URL + "/data/aircraft.json")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var data models.AutoGenerated
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		t.Fatalf("Failed to decode as aircraft.json: %v", err)
+	}
+	if data.Messages != 1000 || len(data.Aircraft) != 2 || data.Now == 0 {
+		t.Errorf("Unexpected aircraft.json %+v", data)
+	}
+}
+
+func TestStoreUpdateKeepsFreshest(t *testing.T) {
+	ts := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	s := NewStore(time.Minute)
+	sess := session.Session{ID: "abc123-1"}
+
+	tests := []struct {
+		name   string
+		flight string
+		ts     time.Time
+		seen   float64
+		want   string
+	}{
+		{name: "first report", flight: "BAW1", ts: ts, seen: 1, want: "BAW1"},
+		{name: "older report from another input", flight: "OLD1", ts: ts.Add(time.Second), seen: 5, want: "BAW1"},
+		{name: "fresher report", flight: "BAW2", ts: ts.Add(time.Second), seen: 0.5, want: "BAW2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s.Update(&models.Aircraft{Hex: "abc123", Flight: tt.flight, Seen: tt.seen}, tt.ts, sess, "")
+			e, _ := s.Get("abc123", tt.ts)
+			if e.Flight != tt.want {
+				t.Errorf("Expected flight %s, got %s", tt.want, e.Flight)
+			}
+		})
+	}
+}
+
+func TestStoreTrail(t *testing.T) {
+	ts := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	s := NewStore(time.Minute)
+	sess := session.Session{ID: "abc123-1"}
+
+	positions := [][2]float64{{51.0, -0.1}, {51.0, -0.1}, {51.1, -0.1}, {0, 0}, {51.2, -0.1}}
+	for i, p := range positions {
+		s.Update(&models.Aircraft{Hex: "abc123", Lat: p[0], Lon: p[1]}, ts.Add(time.Duration(i)*time.Second), sess, "")
+	}
+
+	e, _ := s.Get("abc123", ts)
+	if len(e.Trail) != 3 {
+		t.Fatalf("Expected 3 distinct positions, got %+v", e.Trail)
+	}
+	if e.Trail[2].Lat != 51.2 {
+		t.Errorf("Expected newest position last, got %+v", e.Trail)
+	}
+
+	// A new session starts a new trail
+	s.Update(&models.Aircraft{Hex: "abc123", Lat: 52.0, Lon: -0.1}, ts.Add(time.Hour), session.Session{ID: "abc123-2"}, "")
+	if e, _ := s.Get("abc123", ts); len(e.Trail) != 1 {
+		t.Errorf("Expected a fresh trail for the new session, got %+v", e.Trail)
+	}
+}
@@ -0,0 +1,122 @@
+package stats
+
+import (
+	"sync"
+	"time"
+
+	"github.com/rknightion/adsb2loki/pkg/models"
+)
+
+// Snapshot summarises one aircraft.json snapshot
+type Snapshot struct {
+	Time         time.Time
+	Total        int
+	ByCategory   map[string]int // Aircraft without a category are counted as "unknown"
+	BySource     map[string]int
+	Positioned   int
+	Unpositioned int
+
+	// Rates derived from the previous snapshot, valid when HasRates is set
+	MessageRate  float64 // Messages per second received by the decoder
+	PositionRate float64 // New positions per second
+	HasRates     bool
+
+	// Per-aircraft samples for histograms
+	RSSI     []float64 // dBFS
+	Distance []float64 // Nautical miles from the receiver
+	Altitude []float64 // Feet
+}
+
+// Collector derives statistics from successive snapshots
+type Collector struct {
+	mu           sync.Mutex
+	latest       Snapshot
+	prevTime     time.Time
+	prevMessages int
+	hasPrev      bool
+}
+
+// NewCollector creates a new statistics collector
+func NewCollector() *Collector {
+	return &Collector{}
+}
+
+// Update computes the statistics for a snapshot taken at ts and keeps them as the latest
+func (c *Collector) Update(data *models.AutoGenerated, ts time.Time) Snapshot {
+	// Prefer the receiver's own clock for rates so fetch jitter doesn't skew them
+	now := ts
+	if data.Now > 0 {
+		now = time.Unix(0, int64(data.Now*float64(time.Second)))
+	}
+
+	s := Snapshot{
+		Time:       now,
+		Total:      len(data.Aircraft),
+		ByCategory: make(map[string]int),
+		BySource:   make(map[string]int),
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var elapsed float64
+	if c.hasPrev {
+		elapsed = now.Sub(c.prevTime).Seconds()
+	}
+
+	newPositions := 0
+	for i := range data.Aircraft {
+		aircraft := &data.Aircraft[i]
+
+		category := aircraft.Category
+		if category == "" {
+			category = "unknown"
+		}
+		s.ByCategory[category]++
+		s.BySource[aircraft.Source()]++
+
+		if aircraft.HasPosition() {
+			s.Positioned++
+			// A position younger than the time since the last snapshot is new
+			if elapsed > 0 && aircraft.SeenPos < elapsed {
+				newPositions++
+			}
+		} else {
+			s.Unpositioned++
+		}
+
+		if aircraft.Rssi != 0 {
+			s.RSSI = append(s.RSSI, aircraft.Rssi)
+		}
+		if aircraft.RDst > 0 {
+			s.Distance = append(s.Distance, aircraft.RDst)
+		}
+		if alt, ok := aircraft.Altitude(); ok {
+			s.Altitude = append(s.Altitude, alt)
+		}
+	}
+
+	// The message counter resets when the decoder restarts, skip rates for that snapshot
+	if elapsed > 0 && data.Messages >= c.prevMessages {
+		s.MessageRate = float64(data.Messages-c.prevMessages) / elapsed
+		s.PositionRate = float64(newPositions) / elapsed
+		s.HasRates = true
+	}
+
+	// Repeated snapshots with the same timestamp don't move the baseline
+	if !c.hasPrev || elapsed > 0 || data.Messages < c.prevMessages {
+		c.prevTime = now
+		c.prevMessages = data.Messages
+		c.hasPrev = true
+	}
+
+	c.latest = s
+	return s
+}
+
+// Latest returns the statistics of the most recent snapshot
+func (c *Collector) Latest() Snapshot {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.latest
+}
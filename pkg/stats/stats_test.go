@@ -0,0 +1,65 @@
+package stats
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rknightion/adsb2loki/pkg/models"
+)
+
+func TestCollectorUpdate(t *testing.T) {
+	c := NewCollector()
+
+	first := &models.AutoGenerated{
+		Now:      1748083431,
+		Messages: 1000,
+		Aircraft: []models.Aircraft{
+			{Hex: "4ca614", Category: "A5", Type: "adsb_icao", Lat: 51.5, Lon: -0.1, Rssi: -20.5, RDst: 40, AltBaro: float64(39000), SeenPos: 0.5},
+			{Hex: "abc123", Category: "A3", Mlat: []interface{}{"lat"}, Lat: 52.5, Lon: -1.1, Rssi: -30, SeenPos: 8},
+			{Hex: "def456", AltBaro: "ground"},
+		},
+	}
+
+	s := c.Update(first, time.Now())
+	if s.Total != 3 {
+		t.Errorf("Expected 3 aircraft, got %d", s.Total)
+	}
+	if s.ByCategory["A5"] != 1 || s.ByCategory["A3"] != 1 || s.ByCategory["unknown"] != 1 {
+		t.Errorf("Unexpected categories %v", s.ByCategory)
+	}
+	if s.BySource["adsb_icao"] != 1 || s.BySource["mlat"] != 1 || s.BySource["unknown"] != 1 {
+		t.Errorf("Unexpected sources %v", s.BySource)
+	}
+	if s.Positioned != 2 || s.Unpositioned != 1 {
+		t.Errorf("Expected 2 positioned and 1 unpositioned, got %d and %d", s.Positioned, s.Unpositioned)
+	}
+	if len(s.RSSI) != 2 || len(s.Distance) != 1 || len(s.Altitude) != 2 {
+		t.Errorf("Unexpected samples: rssi=%v distance=%v altitude=%v", s.RSSI, s.Distance, s.Altitude)
+	}
+	if s.HasRates {
+		t.Error("Expected no rates for the first snapshot")
+	}
+
+	// Five seconds later, 500 more messages and one fresh position
+	second := &models.AutoGenerated{Now: first.Now + 5, Messages: 1500, Aircraft: first.Aircraft}
+	s = c.Update(second, time.Now())
+	if !s.HasRates {
+		t.Fatal("Expected rates for the second snapshot")
+	}
+	if s.MessageRate != 100 {
+		t.Errorf("Expected 100 messages/s, got %f", s.MessageRate)
+	}
+	if s.PositionRate != 0.2 {
+		t.Errorf("Expected 0.2 positions/s, got %f", s.PositionRate)
+	}
+
+	// A decoder restart resets the message counter
+	restarted := &models.AutoGenerated{Now: second.Now + 5, Messages: 10}
+	if s := c.Update(restarted, time.Now()); s.HasRates {
+		t.Error("Expected no rates after a counter reset")
+	}
+
+	if c.Latest().Total != 0 {
+		t.Errorf("Expected latest snapshot to be the restarted one, got %d aircraft", c.Latest().Total)
+	}
+}
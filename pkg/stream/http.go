@@ -0,0 +1,171 @@
+package stream
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// keepAlive is how often idle connections are pinged so proxies don't close them
+const keepAlive = 30 * time.Second
+
+// writeTimeout bounds a single write to a subscriber
+const writeTimeout = 10 * time.Second
+
+// Register adds the stream routes to a mux: GET /api/stream for Server-Sent Events and GET /api/ws for WebSocket
+func (h *Hub) Register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/stream", h.HandleSSE)
+	mux.HandleFunc("GET /api/ws", h.HandleWebSocket)
+}
+
+// checkOrigin allows WebSocket connections from the server's own origin, from AllowedOrigins
+// and from clients that send no Origin, i.e. those that aren't browsers
+func (h *Hub) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	if strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	for _, allowed := range h.AllowedOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// subscribe parses the filter query parameters and subscribes, writing a 400 Bad Request when they are invalid
+func (h *Hub) subscribe(w http.ResponseWriter, r *http.Request) (*Subscriber, bool) {
+	q := r.URL.Query()
+	f, err := ParseFilter(q.Get("hex"), q.Get("types"), q.Get("geofence"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+	return h.Subscribe(f), true
+}
+
+// HandleSSE streams messages as Server-Sent Events, using the message type as the event name
+func (h *Hub) HandleSSE(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	sub, ok := h.subscribe(w, r)
+	if !ok {
+		return
+	}
+	defer h.Unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	// Bound each write, so a client that stops reading doesn't hold the handler forever
+	rc := http.NewResponseController(w)
+	write := func(event string) error {
+		_ = rc.SetWriteDeadline(time.Now().Add(writeTimeout))
+		if _, err := w.Write([]byte(event)); err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	}
+
+	ticker := time.NewTicker(keepAlive)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case m, ok := <-sub.Messages():
+			if !ok {
+				// Dropped for falling behind, the client is expected to reconnect
+				return
+			}
+			data, err := json.Marshal(m)
+			if err != nil {
+				log.Printf("Failed to marshal stream message: %v", err)
+				continue
+			}
+			if err := write("event: " + m.Kind + "\ndata: " + string(data) + "\n\n"); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if err := write(": keep-alive\n\n"); err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// HandleWebSocket streams messages as JSON text frames over a WebSocket
+func (h *Hub) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
+	sub, ok := h.subscribe(w, r)
+	if !ok {
+		return
+	}
+	defer h.Unsubscribe(sub)
+
+	upgrader := websocket.Upgrader{CheckOrigin: h.checkOrigin}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade has already written the error response
+		return
+	}
+	defer conn.Close()
+
+	// Read in the background so close frames and pongs are handled
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(keepAlive)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case m, ok := <-sub.Messages():
+			if !ok {
+				_ = conn.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "subscriber fell behind"),
+					time.Now().Add(writeTimeout))
+				return
+			}
+			_ = conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+			if err := conn.WriteJSON(m); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeTimeout)); err != nil {
+				return
+			}
+		case <-closed:
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
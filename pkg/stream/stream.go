@@ -0,0 +1,226 @@
+package stream
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rknightion/adsb2loki/pkg/alert"
+	"github.com/rknightion/adsb2loki/pkg/events"
+	"github.com/rknightion/adsb2loki/pkg/geo"
+	"github.com/rknightion/adsb2loki/pkg/models"
+)
+
+// DefaultBufferSize is how many messages a subscriber may fall behind before it is dropped
+const DefaultBufferSize = 256
+
+// Message kinds besides the lifecycle event types
+const (
+	KindPosition = "position"
+	KindAlert    = "alert"
+)
+
+// Message is a single update sent to subscribers
+type Message struct {
+	Kind     string           `json:"type"` // position, alert or a lifecycle event type such as takeoff
+	Time     time.Time        `json:"time"`
+	Hex      string           `json:"hex"`
+	Aircraft *models.Aircraft `json:"aircraft,omitempty"`
+	Event    *events.Event    `json:"event,omitempty"`
+	Alert    *alert.Alert     `json:"alert,omitempty"`
+}
+
+// PositionMessage creates a message for an aircraft report
+func PositionMessage(aircraft *models.Aircraft, ts time.Time) Message {
+	a := *aircraft
+	return Message{Kind: KindPosition, Time: ts, Hex: strings.ToLower(a.Hex), Aircraft: &a}
+}
+
+// EventMessage creates a message for a lifecycle event
+func EventMessage(e events.Event) Message {
+	return Message{Kind: string(e.Type), Time: e.Time, Hex: strings.ToLower(e.Hex), Event: &e}
+}
+
+// AlertMessage creates a message for an alert
+func AlertMessage(a alert.Alert) Message {
+	return Message{Kind: KindAlert, Time: a.Time, Hex: strings.ToLower(a.Hex), Alert: &a}
+}
+
+// position returns the position a message refers to, if any
+func (m Message) position() (float64, float64, bool) {
+	switch {
+	case m.Aircraft != nil && m.Aircraft.HasPosition():
+		return m.Aircraft.Lat, m.Aircraft.Lon, true
+	case m.Event != nil && (m.Event.Lat != 0 || m.Event.Lon != 0):
+		return m.Event.Lat, m.Event.Lon, true
+	case m.Alert != nil && (m.Alert.Lat != 0 || m.Alert.Lon != 0):
+		return m.Alert.Lat, m.Alert.Lon, true
+	}
+	return 0, 0, false
+}
+
+// Filter selects the messages a subscriber receives, zero values match everything
+type Filter struct {
+	Geofence *geo.Circle     // Only messages with a position inside the circle
+	Hexes    map[string]bool // Only these aircraft, lowercase
+	Kinds    map[string]bool // Only these message kinds
+}
+
+// Match reports whether a message passes the filter
+func (f Filter) Match(m Message) bool {
+	if len(f.Hexes) > 0 && !f.Hexes[m.Hex] {
+		return false
+	}
+	if len(f.Kinds) > 0 && !f.Kinds[m.Kind] {
+		return false
+	}
+	if f.Geofence != nil {
+		lat, lon, ok := m.position()
+		if !ok || !f.Geofence.Contains(lat, lon) {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseFilter parses the subscriber filter from query parameters:
+// hex and types as comma separated lists, geofence as LAT:LON:RADIUS_NM
+func ParseFilter(hexes, kinds, geofence string) (Filter, error) {
+	var f Filter
+
+	for _, hex := range splitList(hexes) {
+		if f.Hexes == nil {
+			f.Hexes = make(map[string]bool)
+		}
+		f.Hexes[strings.ToLower(hex)] = true
+	}
+	for _, kind := range splitList(kinds) {
+		if f.Kinds == nil {
+			f.Kinds = make(map[string]bool)
+		}
+		f.Kinds[strings.ToLower(kind)] = true
+	}
+
+	if geofence != "" {
+		parts := strings.Split(geofence, ":")
+		if len(parts) != 3 {
+			return f, fmt.Errorf("invalid geofence %q: expected LAT:LON:RADIUS_NM", geofence)
+		}
+		var values [3]float64
+		for i, part := range parts {
+			v, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+			if err != nil {
+				return f, fmt.Errorf("invalid geofence %q: %w", geofence, err)
+			}
+			values[i] = v
+		}
+		f.Geofence = &geo.Circle{Lat: values[0], Lon: values[1], Radius: values[2]}
+	}
+
+	return f, nil
+}
+
+// Subscriber receives the messages matching its filter until it is closed
+type Subscriber struct {
+	filter   Filter
+	messages chan Message
+}
+
+// Messages returns the channel of messages, closed when the subscriber falls behind or unsubscribes
+func (s *Subscriber) Messages() <-chan Message {
+	return s.messages
+}
+
+// Hub fans published messages out to subscribers
+type Hub struct {
+	// AllowedOrigins are the browser origins besides the server's own that may open a WebSocket,
+	// e.g. https://example.com, or * for any
+	AllowedOrigins []string
+
+	mu          sync.Mutex
+	bufferSize  int
+	subscribers map[*Subscriber]struct{}
+	dropped     uint64
+}
+
+// NewHub creates a new hub buffering up to bufferSize messages per subscriber
+func NewHub(bufferSize int) *Hub {
+	if bufferSize <= 0 {
+		bufferSize = DefaultBufferSize
+	}
+	return &Hub{
+		bufferSize:  bufferSize,
+		subscribers: make(map[*Subscriber]struct{}),
+	}
+}
+
+// Subscribe adds a subscriber with the given filter
+func (h *Hub) Subscribe(f Filter) *Subscriber {
+	s := &Subscriber{filter: f, messages: make(chan Message, h.bufferSize)}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.subscribers[s] = struct{}{}
+	return s
+}
+
+// Unsubscribe removes a subscriber and closes its channel
+func (h *Hub) Unsubscribe(s *Subscriber) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.remove(s)
+}
+
+// Publish sends a message to every matching subscriber without blocking.
+// Subscribers whose buffer is full have fallen too far behind and are dropped.
+func (h *Hub) Publish(m Message) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for s := range h.subscribers {
+		if !s.filter.Match(m) {
+			continue
+		}
+		select {
+		case s.messages <- m:
+		default:
+			h.remove(s)
+			h.dropped++
+		}
+	}
+}
+
+// Len returns the number of subscribers
+func (h *Hub) Len() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subscribers)
+}
+
+// Dropped returns the number of subscribers dropped for falling behind
+func (h *Hub) Dropped() uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.dropped
+}
+
+// remove removes a subscriber, the caller must hold the lock
+func (h *Hub) remove(s *Subscriber) {
+	if _, ok := h.subscribers[s]; ok {
+		delete(h.subscribers, s)
+		close(s.messages)
+	}
+}
+
+// splitList splits a comma separated value, dropping empty items
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
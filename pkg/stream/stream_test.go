@@ -0,0 +1,213 @@
+package stream
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/rknightion/adsb2loki/pkg/alert"
+	"github.com/rknightion/adsb2loki/pkg/events"
+	"github.com/rknightion/adsb2loki/pkg/models"
+)
+
+func TestFilter(t *testing.T) {
+	ts := time.Now()
+	inside := PositionMessage(&models.Aircraft{Hex: "ABC123", Lat: 51.47, Lon: -0.45}, ts)
+	outside := PositionMessage(&models.Aircraft{Hex: "def456", Lat: 40.0, Lon: -3.0}, ts)
+	takeoff := EventMessage(events.Event{Type: events.Takeoff, Hex: "abc123", Time: ts})
+	squawk := AlertMessage(alert.Alert{Reason: alert.ReasonSquawk, Hex: "def456", Time: ts, Lat: 51.48, Lon: -0.44})
+
+	tests := []struct {
+		name     string
+		hexes    string
+		kinds    string
+		geofence string
+		want     []bool // inside, outside, takeoff, squawk
+		wantErr  bool
+	}{
+		{name: "everything", want: []bool{true, true, true, true}},
+		{name: "hex list", hexes: "abc123", want: []bool{true, false, true, false}},
+		{name: "event types", kinds: "takeoff,alert", want: []bool{false, false, true, true}},
+		{name: "geofence", geofence: "51.47:-0.45:5", want: []bool{true, false, false, true}},
+		{name: "invalid geofence", geofence: "51.47:-0.45", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := ParseFilter(tt.hexes, tt.kinds, tt.geofence)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseFilter() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			for i, m := range []Message{inside, outside, takeoff, squawk} {
+				if got := f.Match(m); got != tt.want[i] {
+					t.Errorf("Match(%s %s) = %v, want %v", m.Kind, m.Hex, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestHubDropsSlowSubscribers(t *testing.T) {
+	hub := NewHub(2)
+	fast := hub.Subscribe(Filter{})
+	slow := hub.Subscribe(Filter{})
+
+	msg := PositionMessage(&models.Aircraft{Hex: "abc123"}, time.Now())
+	hub.Publish(msg)
+	<-fast.Messages()
+	hub.Publish(msg)
+	<-fast.Messages()
+	hub.Publish(msg)
+
+	if hub.Len() != 1 || hub.Dropped() != 1 {
+		t.Fatalf("Expected the slow subscriber to be dropped, got %d subscribers and %d dropped", hub.Len(), hub.Dropped())
+	}
+
+	// The slow subscriber can drain what it buffered before seeing the channel closed
+	n := 0
+	for range slow.Messages() {
+		n++
+	}
+	if n != 2 {
+		t.Errorf("Expected 2 buffered messages, got %d", n)
+	}
+
+	hub.Unsubscribe(fast)
+	if hub.Len() != 0 {
+		t.Errorf("Expected no subscribers, got %d", hub.Len())
+	}
+}
+
+// waitForSubscribers waits until the hub has n subscribers
+func waitForSubscribers(t *testing.T, hub *Hub, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for hub.Len() != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %d subscribers", n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSSE(t *testing.T) {
+	hub := NewHub(10)
+	mux := http.NewServeMux()
+	hub.Register(mux)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	resp, err := server.Client().Get(server.URL + "/api/stream?types=takeoff")
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Expected text/event-stream, got %q", ct)
+	}
+
+	waitForSubscribers(t, hub, 1)
+	hub.Publish(PositionMessage(&models.Aircraft{Hex: "abc123"}, time.Now()))
+	hub.Publish(EventMessage(events.Event{Type: events.Takeoff, Hex: "abc123", Time: time.Now()}))
+
+	reader := bufio.NewReader(resp.Body)
+	event, _ := reader.ReadString('\n')
+	data, _ := reader.ReadString('\n')
+	if event != "event: takeoff\n" {
+		t.Errorf("Expected takeoff event, got %q", event)
+	}
+
+	var m Message
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(data, "data: ")), &m); err != nil {
+		t.Fatalf("Failed to decode data %q: %v", data, err)
+	}
+	if m.Event == nil || m.Event.Type != events.Takeoff {
+		t.Errorf("Unexpected message %+v", m)
+	}
+}
+
+func TestWebSocket(t *testing.T) {
+	hub := NewHub(10)
+	mux := http.NewServeMux()
+	hub.Register(mux)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/api/ws?hex=abc123"
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	waitForSubscribers(t, hub, 1)
+	hub.Publish(PositionMessage(&models.Aircraft{Hex: "def456"}, time.Now()))
+	hub.Publish(PositionMessage(&models.Aircraft{Hex: "abc123", Flight: "BAW1"}, time.Now()))
+
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var m Message
+	if err := conn.ReadJSON(&m); err != nil {
+		t.Fatalf("Failed to read message: %v", err)
+	}
+	if m.Kind != KindPosition || m.Aircraft == nil || m.Aircraft.Flight != "BAW1" {
+		t.Errorf("Unexpected message %+v", m)
+	}
+
+	// Closing the connection unsubscribes
+	conn.Close()
+	waitForSubscribers(t, hub, 0)
+}
+
+func TestWebSocketOrigin(t *testing.T) {
+	hub := NewHub(10)
+	hub.AllowedOrigins = []string{"https://example.com"}
+	mux := http.NewServeMux()
+	hub.Register(mux)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	tests := []struct {
+		name    string
+		origin  string
+		allowed bool
+	}{
+		{name: "no origin", allowed: true},
+		{name: "same origin", origin: server.URL, allowed: true},
+		{name: "allowed origin", origin: "https://example.com", allowed: true},
+		{name: "other origin", origin: "https://evil.example", allowed: false},
+	}
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/api/ws"
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			if tt.origin != "" {
+				header.Set("Origin", tt.origin)
+			}
+			conn, _, err := websocket.DefaultDialer.Dial(url, header)
+			if conn != nil {
+				conn.Close()
+			}
+			if (err == nil) != tt.allowed {
+				t.Errorf("Expected allowed %v, got error %v", tt.allowed, err)
+			}
+		})
+	}
+}
+
+func TestInvalidFilterRejected(t *testing.T) {
+	hub := NewHub(10)
+	rec := httptest.NewRecorder()
+	hub.HandleSSE(rec, httptest.NewRequest(http.MethodGet, "/api/stream?geofence=bad", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400, got %d", rec.Code)
+	}
+}
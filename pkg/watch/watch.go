@@ -0,0 +1,47 @@
+// Package watch reports when a file is rewritten, so local aircraft.json files are processed
+// as soon as the decoder writes them rather than on a fixed interval
+package watch
+
+import (
+	"context"
+	"path/filepath"
+	"time"
+)
+
+// RetryInterval is how long to wait before watching a directory that doesn't exist (yet), e.g.
+// /run/readsb while readsb is restarting
+var RetryInterval = time.Second
+
+// File sends on the returned channel whenever the file at path is written and closed, or replaced
+// by renaming another file over it. Decoders write aircraft.json to a temporary file and rename it,
+// so the parent directory is watched rather than the file, whose inode changes with every write.
+// Changes are coalesced while the receiver is busy. The channel is closed when ctx is cancelled.
+func File(ctx context.Context, path string) (<-chan struct{}, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	changes := make(chan struct{}, 1)
+	go func() {
+		defer close(changes)
+		watchFile(ctx, filepath.Dir(path), filepath.Base(path), func() {
+			select {
+			case changes <- struct{}{}:
+			default:
+			}
+		})
+	}()
+	return changes, nil
+}
+
+// sleep waits for d or until ctx is cancelled, reporting whether ctx is still active
+func sleep(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,79 @@
+package watch
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"syscall"
+	"unsafe"
+)
+
+// dirEvents are the events of interest on the parent directory. Creating a file isn't one of
+// them, as the file is still empty at that point.
+const dirEvents = syscall.IN_CLOSE_WRITE | syscall.IN_MOVED_TO | syscall.IN_DELETE_SELF | syscall.IN_MOVE_SELF
+
+// watchFile uses inotify to watch dir for changes to name until ctx is cancelled. When dir is
+// removed, e.g. /run/readsb when readsb stops, it is watched again once it's recreated.
+func watchFile(ctx context.Context, dir, name string, notify func()) {
+	var lastErr string
+	for ctx.Err() == nil {
+		err := watchDir(ctx, dir, name, notify)
+		if ctx.Err() != nil {
+			return
+		}
+		// Log once while the directory is missing rather than on every retry
+		if err.Error() != lastErr {
+			log.Printf("Failed to watch %s, retrying: %v", dir, err)
+			lastErr = err.Error()
+		}
+		if !sleep(ctx, RetryInterval) {
+			return
+		}
+	}
+}
+
+// watchDir watches dir until it's removed or ctx is cancelled
+func watchDir(ctx context.Context, dir, name string, notify func()) error {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return os.NewSyscallError("inotify_init1", err)
+	}
+	// A non-blocking descriptor uses the runtime poller, so closing the file interrupts Read
+	f := os.NewFile(uintptr(fd), "inotify")
+	defer f.Close()
+
+	if _, err := syscall.InotifyAddWatch(fd, dir, dirEvents); err != nil {
+		return os.NewSyscallError("inotify_add_watch "+dir, err)
+	}
+	// The file may have been written while nothing was watching
+	if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+		notify()
+	}
+
+	stop := context.AfterFunc(ctx, func() { f.Close() })
+	defer stop()
+
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		n, err := f.Read(buf)
+		if err != nil {
+			return err
+		}
+		for off := 0; off+syscall.SizeofInotifyEvent <= n; {
+			event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[off]))
+			nameBytes := buf[off+syscall.SizeofInotifyEvent : off+syscall.SizeofInotifyEvent+int(event.Len)]
+			off += syscall.SizeofInotifyEvent + int(event.Len)
+
+			switch {
+			case event.Mask&(syscall.IN_DELETE_SELF|syscall.IN_MOVE_SELF|syscall.IN_IGNORED) != 0:
+				return os.ErrNotExist
+			case event.Mask&syscall.IN_Q_OVERFLOW != 0:
+				notify()
+			case string(bytes.TrimRight(nameBytes, "\x00")) == name:
+				notify()
+			}
+		}
+	}
+}
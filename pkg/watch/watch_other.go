@@ -0,0 +1,28 @@
+//go:build !linux
+
+package watch
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// pollInterval is how often the file is checked without inotify
+const pollInterval = 250 * time.Millisecond
+
+// watchFile polls the modification time and size of the file until ctx is cancelled
+func watchFile(ctx context.Context, dir, name string, notify func()) {
+	path := filepath.Join(dir, name)
+	var last os.FileInfo
+	for {
+		if fi, err := os.Stat(path); err == nil && (last == nil || !fi.ModTime().Equal(last.ModTime()) || fi.Size() != last.Size()) {
+			last = fi
+			notify()
+		}
+		if !sleep(ctx, pollInterval) {
+			return
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package watch
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// expectChange waits for a change, failing after a timeout
+func expectChange(t *testing.T, changes <-chan struct{}, what string) {
+	t.Helper()
+	select {
+	case <-changes:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected a change after %s", what)
+	}
+}
+
+// expectNoChange fails if a change arrives within a short time
+func expectNoChange(t *testing.T, changes <-chan struct{}, what string) {
+	t.Helper()
+	select {
+	case <-changes:
+		t.Fatalf("Unexpected change after %s", what)
+	case <-time.After(300 * time.Millisecond):
+	}
+}
+
+func TestFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "aircraft.json")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	changes, err := File(ctx, path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expectNoChange(t, changes, "starting without the file")
+
+	// Decoders write a temporary file and rename it over aircraft.json
+	tmp := filepath.Join(dir, "aircraft.json.tmp")
+	if err := os.WriteFile(tmp, []byte(`{"now": 1}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	expectNoChange(t, changes, "writing the temporary file")
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatal(err)
+	}
+	expectChange(t, changes, "renaming over the file")
+
+	if err := os.WriteFile(path, []byte(`{"now": 2}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	expectChange(t, changes, "writing the file in place")
+
+	if err := os.WriteFile(filepath.Join(dir, "stats.json"), []byte(`{}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	expectNoChange(t, changes, "writing another file")
+
+	cancel()
+	select {
+	case _, ok := <-changes:
+		if ok {
+			// A change may still have been pending, the channel closes next
+			if _, ok := <-changes; ok {
+				t.Error("Expected the channel to be closed")
+			}
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("Expected the channel to be closed after cancelling")
+	}
+}
+
+func TestFileDirectoryRecreated(t *testing.T) {
+	old := RetryInterval
+	RetryInterval = 10 * time.Millisecond
+	defer func() { RetryInterval = old }()
+
+	dir := filepath.Join(t.TempDir(), "readsb")
+	path := filepath.Join(dir, "aircraft.json")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// The directory doesn't exist yet, e.g. before readsb starts
+	changes, err := File(ctx, path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for i := range 2 {
+		if err := os.Mkdir(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(`{}`), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		expectChange(t, changes, "creating the directory")
+		if i == 0 {
+			if err := os.RemoveAll(dir); err != nil {
+				t.Fatal(err)
+			}
+			// Drop a change that may still be pending from the first directory
+			time.Sleep(50 * time.Millisecond)
+			select {
+			case <-changes:
+			default:
+			}
+		}
+	}
+}
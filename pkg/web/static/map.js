@@ -0,0 +1,192 @@
+// Live map of the aircraft tracked by adsb2loki, refreshed from /api/aircraft
+(function () {
+  'use strict';
+
+  const REFRESH_MS = 2000;
+
+  const map = L.map('map', { worldCopyJump: true }).setView([51.5, -0.1], 7);
+  L.tileLayer('https://{s}.tile.openstreetmap.org/{z}/{x}/{y}.png', {
+    maxZoom: 18,
+    attribution: '&copy; OpenStreetMap contributors',
+  }).addTo(map);
+
+  const layers = new Map(); // hex -> { marker, trail }
+  let selected = null;
+  let fitted = false;
+
+  function callsign(a) {
+    return (a.flight || '').trim() || a.hex;
+  }
+
+  function altitude(a) {
+    if (a.alt_baro === 'ground') return 'ground';
+    const alt = a.alt_baro !== undefined ? a.alt_baro : a.alt_geom;
+    return alt === undefined ? '' : String(alt);
+  }
+
+  function heading(a) {
+    return a.track || a.true_heading || a.mag_heading || 0;
+  }
+
+  function icon(a) {
+    const el = document.createElement('div');
+    el.className = 'plane' + (a.alerts && a.alerts.length ? ' alerting' : '');
+    // The glyph points east, rotate it to the track
+    el.style.transform = 'rotate(' + (heading(a) - 90) + 'deg)';
+    el.textContent = '✈';
+    return L.divIcon({ html: el.outerHTML, className: '', iconSize: [20, 20], iconAnchor: [10, 10] });
+  }
+
+  function update(aircraft) {
+    const seen = new Set();
+
+    for (const a of aircraft) {
+      if (!a.lat && !a.lon) continue;
+      seen.add(a.hex);
+
+      const trail = (a.trail || []).map((p) => [p.lat, p.lon]);
+      let layer = layers.get(a.hex);
+      if (!layer) {
+        const marker = L.marker([a.lat, a.lon], { icon: icon(a) })
+          .bindTooltip('', { permanent: true, direction: 'right', className: 'plane-label', offset: [8, 0] })
+          .on('click', () => select(a.hex))
+          .addTo(map);
+        const line = L.polyline(trail, { weight: 2, opacity: 0.6 }).addTo(map);
+        layer = { marker, trail: line };
+        layers.set(a.hex, layer);
+      }
+      layer.marker.setLatLng([a.lat, a.lon]).setIcon(icon(a));
+      layer.marker.setTooltipContent(callsign(a));
+      layer.trail.setLatLngs(trail);
+    }
+
+    // Remove aircraft that are no longer tracked
+    for (const [hex, layer] of layers) {
+      if (!seen.has(hex)) {
+        layer.marker.remove();
+        layer.trail.remove();
+        layers.delete(hex);
+      }
+    }
+
+    if (!fitted && layers.size > 0) {
+      const bounds = L.latLngBounds([...layers.values()].map((l) => l.marker.getLatLng()));
+      map.fitBounds(bounds.pad(0.1));
+      fitted = true;
+    }
+  }
+
+  function renderTable(aircraft) {
+    const tbody = document.querySelector('#aircraft tbody');
+    tbody.replaceChildren();
+
+    const sorted = [...aircraft].sort((a, b) => callsign(a).localeCompare(callsign(b)));
+    for (const a of sorted) {
+      const row = document.createElement('tr');
+      if (a.level) row.className = 'level-' + a.level;
+      if (a.hex === selected) row.classList.add('selected');
+      for (const value of [callsign(a), a.hex, altitude(a), a.gs !== undefined ? Math.round(a.gs) : '', a.t || '']) {
+        const cell = document.createElement('td');
+        cell.textContent = value;
+        row.appendChild(cell);
+      }
+      row.addEventListener('click', () => select(a.hex));
+      tbody.appendChild(row);
+    }
+  }
+
+  function renderAlerts(aircraft) {
+    const list = document.getElementById('alerts');
+    list.replaceChildren();
+
+    const alerts = aircraft.flatMap((a) => (a.alerts || []).map((alert) => ({ alert, hex: a.hex })));
+    alerts.sort((x, y) => new Date(y.alert.time) - new Date(x.alert.time));
+    if (alerts.length === 0) {
+      const item = document.createElement('li');
+      item.textContent = 'None';
+      list.appendChild(item);
+      return;
+    }
+    for (const { alert, hex } of alerts) {
+      const item = document.createElement('li');
+      item.className = 'level-error';
+      item.textContent = new Date(alert.time).toLocaleTimeString() + ' ' + alert.message;
+      item.addEventListener('click', () => select(hex));
+      list.appendChild(item);
+    }
+  }
+
+  function renderDetails(aircraft) {
+    const details = document.getElementById('details');
+    details.replaceChildren();
+
+    const a = aircraft.find((x) => x.hex === selected);
+    if (!a) {
+      const dd = document.createElement('dd');
+      dd.textContent = 'Click an aircraft';
+      details.appendChild(dd);
+      return;
+    }
+
+    const fields = [
+      ['Flight', callsign(a)],
+      ['Hex', a.hex],
+      ['Registration', a.r],
+      ['Type', [a.t, a.desc].filter(Boolean).join(' - ')],
+      ['Operator', a.ownOp],
+      ['Altitude', altitude(a)],
+      ['Speed', a.gs !== undefined ? Math.round(a.gs) + ' kt' : ''],
+      ['Track', a.track !== undefined ? Math.round(a.track) + '°' : ''],
+      ['Squawk', a.squawk],
+      ['Distance', a.r_dst !== undefined ? a.r_dst.toFixed(1) + ' nm' : ''],
+      ['RSSI', a.rssi !== undefined ? a.rssi.toFixed(1) + ' dBFS' : ''],
+      ['Source', a.type],
+      ['Level', a.level],
+      ['Session', a.session_id],
+    ];
+    for (const [name, value] of fields) {
+      if (value === undefined || value === '') continue;
+      const dt = document.createElement('dt');
+      dt.textContent = name;
+      const dd = document.createElement('dd');
+      dd.textContent = value;
+      details.append(dt, dd);
+    }
+  }
+
+  let latest = [];
+
+  function render() {
+    renderTable(latest);
+    renderAlerts(latest);
+    renderDetails(latest);
+  }
+
+  function select(hex) {
+    selected = hex;
+    const layer = layers.get(hex);
+    if (layer) map.panTo(layer.marker.getLatLng());
+    render();
+  }
+
+  async function refresh() {
+    try {
+      const resp = await fetch('api/aircraft');
+      if (!resp.ok) throw new Error(resp.status + ' ' + resp.statusText);
+      const data = await resp.json();
+      latest = data.aircraft;
+
+      const positioned = latest.filter((a) => a.lat || a.lon).length;
+      document.getElementById('summary').textContent =
+        latest.length + ' aircraft, ' + positioned + ' with position, updated ' + new Date(data.now * 1000).toLocaleTimeString();
+
+      update(latest);
+      render();
+    } catch (err) {
+      document.getElementById('summary').textContent = 'Failed to load aircraft: ' + err.message;
+    }
+  }
+
+  refresh();
+  setInterval(refresh, REFRESH_MS);
+})();
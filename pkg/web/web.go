@@ -0,0 +1,26 @@
+package web
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+// static holds the map page and its assets
+//
+//go:embed static
+var static embed.FS
+
+// Register adds the map UI to a mux at / and /static/
+func Register(mux *http.ServeMux) {
+	files, err := fs.Sub(static, "static")
+	if err != nil {
+		// The embedded directory is fixed at build time
+		panic(err)
+	}
+
+	mux.Handle("GET /static/", http.StripPrefix("/static/", http.FileServer(http.FS(files))))
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFileFS(w, r, files, "index.html")
+	})
+}
@@ -0,0 +1,50 @@
+package web
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRegister(t *testing.T) {
+	mux := http.NewServeMux()
+	Register(mux)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	tests := []struct {
+		name        string
+		path        string
+		want        int
+		contentType string
+		contains    string
+	}{
+		{name: "index", path: "/", want: http.StatusOK, contentType: "text/html", contains: `id="map"`},
+		{name: "script", path: "/static/map.js", want: http.StatusOK, contentType: "javascript", contains: "api/aircraft"},
+		{name: "stylesheet", path: "/static/map.css", want: http.StatusOK, contentType: "text/css"},
+		{name: "unknown path", path: "/nope", want: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := server.Client().Get(server.URL + tt.path)
+			if err != nil {
+				t.Fatalf("Request failed: %v", err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != tt.want {
+				t.Fatalf("Expected status %d, got %d", tt.want, resp.StatusCode)
+			}
+			if ct := resp.Header.Get("Content-Type"); !strings.Contains(ct, tt.contentType) {
+				t.Errorf("Expected content type %q, got %q", tt.contentType, ct)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			if !strings.Contains(string(body), tt.contains) {
+				t.Errorf("Expected body to contain %q", tt.contains)
+			}
+		})
+	}
+}